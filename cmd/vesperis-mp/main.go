@@ -36,7 +36,7 @@ func main() {
 		l.Debug("debug mode active")
 	}
 
-	db, err := database.Init(ctx, cf, l)
+	db, err := database.New(ctx, cf, l)
 	if err != nil {
 		l.Error("database initialization error", "error", err)
 		return
@@ -13,7 +13,9 @@ import (
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
 	"github.com/team-vesperis/vesperis-mp/internal/proxy/commands"
+	"github.com/team-vesperis/vesperis-mp/internal/proxy/discovery"
 	"github.com/team-vesperis/vesperis-mp/internal/proxy/listeners"
+	"github.com/team-vesperis/vesperis-mp/internal/proxy/registry"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 	"go.minekube.com/gate/pkg/gate"
 	"go.uber.org/zap/zapcore"
@@ -38,7 +40,7 @@ type Manager struct {
 	// The database used in the multiproxy manager.
 	// Contains a connection with Redis and Postgres.
 	// Combines both in functions for fast and safe usage.
-	db *database.Database
+	db database.Storage
 
 	// The config used in the mp.
 	// Determines the database connection variables, proxy id, etc.
@@ -47,9 +49,16 @@ type Manager struct {
 	multi *manager.MultiManager
 
 	task *task.TaskManager
+
+	drain *tasks.DrainManager
+
+	registry *registry.Registry
+
+	// Adds and removes the backends found by the discovery providers.
+	discovery *discovery.Manager
 }
 
-func Init(ctx context.Context, cf *config.Config, l *logger.Logger, db *database.Database) (*Manager, error) {
+func Init(ctx context.Context, cf *config.Config, l *logger.Logger, db database.Storage) (*Manager, error) {
 	m := &Manager{
 		ctx: logr.NewContext(ctx, zapr.NewLogger(l.GetGateLogger())),
 		cf:  cf,
@@ -83,14 +92,22 @@ func Init(ctx context.Context, cf *config.Config, l *logger.Logger, db *database
 	m.ownerGate = gate.Java()
 	event.Subscribe(m.ownerGate.Event(), 0, m.onShutdown)
 
-	m.task = task.InitTaskManager(m.db, m.l, m.multi.GetOwnerMultiProxy(), m.ownerGate, m.multi)
+	m.registry = registry.Init(m.ownerGate, m.multi, m.cf, m.l)
+
+	// started when gate is ready, the servers of the gate config go first
+	m.discovery = discovery.Init(m.registry, m.cf, m.l)
+	event.Subscribe(m.ownerGate.Event(), 0, m.onReady)
+
+	m.task = task.InitTaskManager(m.db, m.l, m.multi.GetOwnerMultiProxy(), m.ownerGate, m.multi, m.registry)
 
-	m.command, err = commands.Init(m.ownerGate, m.l, m.db, m.multi, m.task)
+	m.drain = tasks.InitDrainManager(m.task, m.cf)
+
+	m.command, err = commands.Init(m.ownerGate, m.l, m.db, m.multi, m.task, m.drain)
 	if err != nil {
 		return m, err
 	}
 
-	m.listener, err = listeners.Init(m.ownerGate.Event(), m.l, m.db, m.multi, m.ownerGate, m.task)
+	m.listener, err = listeners.Init(m.ownerGate.Event(), m.l, m.cf, m.db, m.multi, m.ownerGate, m.task, m.drain)
 	if err != nil {
 		return m, err
 	}
@@ -105,6 +122,10 @@ func (m *Manager) start() {
 	}
 }
 
+func (m *Manager) onReady(event *proxy.ReadyEvent) {
+	m.discovery.Start()
+}
+
 func (m *Manager) onShutdown(event *proxy.ShutdownEvent) {
 	m.close()
 }
@@ -112,6 +133,9 @@ func (m *Manager) onShutdown(event *proxy.ShutdownEvent) {
 func (m *Manager) close() {
 	m.l.Info("stopping mp")
 
+	m.discovery.Stop()
+	m.registry.Close()
+
 	err := m.multi.Close()
 	if err != nil {
 		m.l.Error("multimanager close error", "error", err)
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Backends without group are in the default group.
+const DefaultBackendGroup = "default"
+
+var ErrIncorrectBackendGroup = errors.New("incorrect backend group, only lowercase letters, numbers, dashes and underscores are allowed")
+
+// lowercase only and without dots, the groups are used as keys in the config
+var backendGroupRegex = regexp.MustCompile(`^[a-z0-9_-]{1,63}$`)
+
+// The group of the backend with the name, set in backends.<name>.group. If nothing or a wrong group is set, the default group is used.
+func (c *Config) GetBackendGroup(name string) string {
+	s := c.v.GetString("backends." + strings.ToLower(name) + ".group")
+	if s == "" {
+		return DefaultBackendGroup
+	}
+
+	g, err := GetBackendGroupName(s)
+	if err != nil {
+		c.l.Warn("incorrect backend group, using default", "backend", name, "group", s)
+		return DefaultBackendGroup
+	}
+
+	return g
+}
+
+// The tags of the backend with the name, set in backends.<name>.tags.
+func (c *Config) GetBackendTags(name string) []string {
+	var l []string
+	for _, t := range c.v.GetStringSlice("backends." + strings.ToLower(name) + ".tags") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			l = append(l, t)
+		}
+	}
+
+	return l
+}
+
+// The group players are sent to when they join. Empty when any backend can be used.
+func (c *Config) GetInitialGroup() string {
+	s := c.v.GetString("routing.initialGroup")
+	if s == "" {
+		return ""
+	}
+
+	g, err := GetBackendGroupName(s)
+	if err != nil {
+		c.l.Warn("incorrect initial group, using any backend", "group", s)
+		return ""
+	}
+
+	return g
+}
+
+// The group players are sent to when they are kicked from a backend. Uses the initial group when nothing is set.
+func (c *Config) GetFallbackGroup() string {
+	s := c.v.GetString("routing.fallbackGroup")
+	if s == "" {
+		return c.GetInitialGroup()
+	}
+
+	g, err := GetBackendGroupName(s)
+	if err != nil {
+		c.l.Warn("incorrect fallback group, using initial group", "group", s)
+		return c.GetInitialGroup()
+	}
+
+	return g
+}
+
+func GetBackendGroupName(s string) (string, error) {
+	if !backendGroupRegex.MatchString(s) {
+		return "", ErrIncorrectBackendGroup
+	}
+
+	return s, nil
+}
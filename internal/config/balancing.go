@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"slices"
+)
+
+// How a backend is chosen for a player.
+type BalancingStrategy string
+
+const (
+	// The backend with the least players.
+	BalancingStrategy_LeastPlayers BalancingStrategy = "least-players"
+	// Players are spread over the backends by their weight.
+	BalancingStrategy_Weighted BalancingStrategy = "weighted"
+	// The backends are chosen one after another.
+	BalancingStrategy_RoundRobin BalancingStrategy = "round-robin"
+	// The last backend the player was on, if it can be chosen. Otherwise the backend with the least players.
+	BalancingStrategy_StickyLastBackend BalancingStrategy = "sticky-last-backend"
+)
+
+var ErrIncorrectBalancingStrategy = errors.New("incorrect balancing strategy")
+
+var AllowedBalancingStrategies = []BalancingStrategy{
+	BalancingStrategy_LeastPlayers,
+	BalancingStrategy_Weighted,
+	BalancingStrategy_RoundRobin,
+	BalancingStrategy_StickyLastBackend,
+}
+
+// The strategy of the backend group. Groups without strategy use the default strategy.
+// If a wrong strategy is set, least-players is used.
+func (c *Config) GetBalancingStrategy(group string) BalancingStrategy {
+	s := c.v.GetString("balancing.groups." + group + ".strategy")
+	if s == "" {
+		s = c.v.GetString("balancing.strategy")
+	}
+
+	if s == "" {
+		return BalancingStrategy_LeastPlayers
+	}
+
+	bs, err := GetBalancingStrategy(s)
+	if err != nil {
+		c.l.Warn("incorrect balancing strategy, using least-players", "group", group, "strategy", s)
+		return BalancingStrategy_LeastPlayers
+	}
+
+	return bs
+}
+
+// The weights of the backends by name, used by the weighted strategy. Backends without weight have weight 1.
+func (c *Config) GetBalancingWeights(group string) map[string]int {
+	k := "balancing.groups." + group + ".weights"
+	if !c.v.IsSet(k) {
+		k = "balancing.weights"
+	}
+
+	m := make(map[string]int)
+	for name := range c.v.GetStringMap(k) {
+		m[name] = c.v.GetInt(k + "." + name)
+	}
+
+	return m
+}
+
+func GetBalancingStrategy(s string) (BalancingStrategy, error) {
+	bs := BalancingStrategy(s)
+	if !slices.Contains(AllowedBalancingStrategies, bs) {
+		return BalancingStrategy(""), ErrIncorrectBalancingStrategy
+	}
+
+	return bs, nil
+}
@@ -11,9 +11,15 @@ import (
 const p = "./config/mp.yml"
 
 type Config struct {
-	v *viper.Viper // nil until created with the load function
-	l *logger.Logger
-	m Mode
+	v  *viper.Viper // nil until created with the load function
+	l  *logger.Logger
+	m  Mode
+	s  StorageType
+	t  Transport
+	n  string
+	r  *RedisOptions
+	ps PostgresSSLMode
+	pn string
 }
 
 func Init(l *logger.Logger) (*Config, error) {
@@ -32,6 +38,36 @@ func Init(l *logger.Logger) (*Config, error) {
 		return nil, err
 	}
 
+	cfg.s, err = cfg.getStorageType()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.t, err = cfg.getTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.n, err = cfg.getNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.r, err = cfg.getRedisOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.ps, err = cfg.getPostgresSSLMode()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.pn, err = cfg.getProxyName()
+	if err != nil {
+		return nil, err
+	}
+
 	cfg.l.Info("initialized config", "duration", time.Since(now))
 	return cfg, nil
 }
@@ -67,6 +103,253 @@ func (c *Config) GetMode() Mode {
 	return c.m
 }
 
+func (c *Config) GetStorageType() StorageType {
+	return c.s
+}
+
+// Separates networks that share the same Redis and Postgres. Empty if not used.
+func (c *Config) GetNamespace() string {
+	return c.n
+}
+
+// The Postgres schema of the network. Every namespace uses its own schema.
+func (c *Config) GetPostgresSchema() string {
+	if c.n == "" {
+		return "public"
+	}
+
+	return c.n
+}
+
+func (c *Config) GetTransport() Transport {
+	return c.t
+}
+
+// Maximum amount of messages kept in each stream when using the streams transport.
+func (c *Config) GetStreamMaxLength() int64 {
+	l := c.v.GetInt64("databases.redis.streams.maxLength")
+	if l <= 0 {
+		return 10000
+	}
+
+	return l
+}
+
+// Maximum amount of players kept in memory. Online players are always kept, so the cache can be larger.
+func (c *Config) GetPlayerCacheMaxSize() int {
+	s := c.v.GetInt("cache.players.maxSize")
+	if s <= 0 {
+		return 10000
+	}
+
+	return s
+}
+
+// Offline players that haven't been used for this duration are removed from memory.
+func (c *Config) GetPlayerCacheTTL() time.Duration {
+	d := c.v.GetDuration("cache.players.ttl")
+	if d <= 0 {
+		return 30 * time.Minute
+	}
+
+	return d
+}
+
+// Failures in a row before calls to Redis or Postgres are stopped.
+func (c *Config) GetBreakerFailures() int {
+	f := c.v.GetInt("databases.degraded.breaker.failures")
+	if f <= 0 {
+		return 3
+	}
+
+	return f
+}
+
+// Time before a stopped storage is tried again.
+func (c *Config) GetBreakerCooldown() time.Duration {
+	d := c.v.GetDuration("databases.degraded.breaker.cooldown")
+	if d <= 0 {
+		return 10 * time.Second
+	}
+
+	return d
+}
+
+// Maximum amount of writes kept while the storage can't be reached. Writes over the maximum fail.
+func (c *Config) GetJournalMaxSize() int {
+	s := c.v.GetInt("databases.degraded.journal.maxSize")
+	if s <= 0 {
+		return 10000
+	}
+
+	return s
+}
+
+// How often a proxy shows it is still running.
+func (c *Config) GetLivenessInterval() time.Duration {
+	d := c.v.GetDuration("liveness.interval")
+	if d <= 0 {
+		return 2 * time.Second
+	}
+
+	return d
+}
+
+// A proxy that didn't show it is running for this duration is seen as crashed. Always longer than the interval.
+func (c *Config) GetLivenessTTL() time.Duration {
+	d := c.v.GetDuration("liveness.ttl")
+	if d <= c.GetLivenessInterval() {
+		return 3 * c.GetLivenessInterval()
+	}
+
+	return d
+}
+
+// How often the saved online value of players is compared with their presence.
+func (c *Config) GetPresenceReconcileInterval() time.Duration {
+	d := c.v.GetDuration("liveness.presenceReconcileInterval")
+	if d <= 0 {
+		return time.Minute
+	}
+
+	return d
+}
+
+// Every proxy registers the backends of the other proxies in gate, so players can switch to any backend without a proxy transfer.
+func (c *Config) IsSharedRegistryEnabled() bool {
+	return !c.v.IsSet("registry.shared") || c.v.GetBool("registry.shared")
+}
+
+// Players that join are sent to a backend of the proxy they joined. The backends of other proxies are only used when there are none.
+func (c *Config) IsPreferOwnBackendsEnabled() bool {
+	return !c.v.IsSet("registry.preferOwnBackends") || c.v.GetBool("registry.preferOwnBackends")
+}
+
+// How often the backends in gate are compared with the backends of the network, besides on every change.
+func (c *Config) GetRegistrySyncInterval() time.Duration {
+	d := c.v.GetDuration("registry.syncInterval")
+	if d <= 0 {
+		return 30 * time.Second
+	}
+
+	return d
+}
+
+// How often the backends of this proxy are pinged.
+func (c *Config) GetHealthCheckInterval() time.Duration {
+	d := c.v.GetDuration("healthCheck.interval")
+	if d <= 0 {
+		return 5 * time.Second
+	}
+
+	return d
+}
+
+// Time a backend gets to answer a ping.
+func (c *Config) GetHealthCheckTimeout() time.Duration {
+	d := c.v.GetDuration("healthCheck.timeout")
+	if d <= 0 {
+		return 3 * time.Second
+	}
+
+	return d
+}
+
+// Failed pings in a row before a backend is seen as offline.
+func (c *Config) GetHealthCheckFailures() int {
+	f := c.v.GetInt("healthCheck.failures")
+	if f <= 0 {
+		return 2
+	}
+
+	return f
+}
+
+// The latency and player count change with every ping, they are only saved each interval.
+// A change of the status or version is saved right away.
+func (c *Config) GetHealthCheckSaveInterval() time.Duration {
+	d := c.v.GetDuration("healthCheck.saveInterval")
+	if d <= 0 {
+		return 30 * time.Second
+	}
+
+	return d
+}
+
+// Maximum amount of players moved at once while draining. Parties are never split, so a batch can be larger.
+func (c *Config) GetDrainBatchSize() int {
+	s := c.v.GetInt("drain.batchSize")
+	if s <= 0 {
+		return 10
+	}
+
+	return s
+}
+
+// Time between the batches of a drain.
+func (c *Config) GetDrainInterval() time.Duration {
+	d := c.v.GetDuration("drain.interval")
+	if d <= 0 {
+		return time.Second
+	}
+
+	return d
+}
+
+// Time a drain started with the command waits for the proxy to become empty.
+func (c *Config) GetDrainTimeout() time.Duration {
+	d := c.v.GetDuration("drain.timeout")
+	if d <= 0 {
+		return 5 * time.Minute
+	}
+
+	return d
+}
+
+// Time the proxy drains before shutting down. Players that are still on the proxy are disconnected.
+func (c *Config) GetDrainShutdownTimeout() time.Duration {
+	d := c.v.GetDuration("drain.shutdownTimeout")
+	if d <= 0 {
+		return 20 * time.Second
+	}
+
+	return d
+}
+
+// Shown to players that are denied because of maintenance.
+func (c *Config) GetMaintenanceMessage() string {
+	m := c.v.GetString("maintenance.message")
+	if m == "" {
+		return "We are in maintenance. Please try again later."
+	}
+
+	return m
+}
+
+// Shown in the server list while the network or this proxy is in maintenance.
+func (c *Config) GetMaintenanceMotd() string {
+	m := c.v.GetString("maintenance.motd")
+	if m == "" {
+		return "In maintenance"
+	}
+
+	return m
+}
+
+// The roles of players that can join while in maintenance.
+func (c *Config) GetMaintenanceBypassRoles() []string {
+	if !c.v.IsSet("maintenance.bypassRoles") {
+		return []string{"admin", "moderator", "builder"}
+	}
+
+	return c.v.GetStringSlice("maintenance.bypassRoles")
+}
+
+// If redis should tell the proxies when another proxy crashed, instead of only checking every interval.
+func (c *Config) IsKeyspaceNotificationsEnabled() bool {
+	return !c.v.IsSet("liveness.keyspaceNotifications") || c.v.GetBool("liveness.keyspaceNotifications")
+}
+
 func (c *Config) GetViper() *viper.Viper {
 	return c.v
 }
@@ -79,27 +362,13 @@ func (c *Config) GetBind() string {
 	return c.v.GetString("config.bind")
 }
 
-func (c *Config) GetRedisUrl() string {
-	host := c.v.GetString("databases.redis.host")
-	port := c.v.GetString("databases.redis.port")
-	database := c.v.GetString("databases.redis.database")
-	password := c.v.GetString("databases.redis.password")
-
-	if password != "" {
-		return "redis://:" + password + "@" + host + ":" + port + "/" + database
-	}
-
-	return "redis://" + host + ":" + port + "/" + database
+// The name of this proxy, which stays the same after a restart. Empty if not used.
+func (c *Config) GetProxyName() string {
+	return c.pn
 }
 
-func (c *Config) GetPostgresUrl() string {
-	username := c.v.GetString("databases.postgres.username")
-	password := c.v.GetString("databases.postgres.password")
-	host := c.v.GetString("databases.postgres.host")
-	port := c.v.GetString("databases.postgres.port")
-	database := c.v.GetString("databases.postgres.database")
-
-	return "postgres://" + username + ":" + password + "@" + host + ":" + port + "/" + database
+func (c *Config) GetRedisOptions() *RedisOptions {
+	return c.r
 }
 
 func (c *Config) createDefaultConfig() error {
@@ -108,22 +377,233 @@ debug: false
 
 mode: default
 
+# Where all data is stored. Options: database, memory
+# memory keeps everything inside this proxy and is only meant for a single proxy during development.
+storage: database
+
+proxy:
+  # Stays the same after a restart, so the proxy keeps its id and can be found by its name in commands.
+  # A proxy that restarts takes over its own record. In kubernetes mode the pod name is used when empty,
+  # otherwise the proxy gets a random id on every start. Only letters, numbers, dots, dashes and underscores.
+  name: ""
+
+# Used in kubernetes mode. The proxies run as pods of a statefulset with a headless service,
+# every proxy is reached at <pod name>.<service>.<namespace>.svc.<cluster domain>:<port>.
+kubernetes:
+  # Empty uses the POD_NAMESPACE environment variable, otherwise default.
+  namespace: ""
+  service: proxy
+  port: 25565
+  clusterDomain: cluster.local
+
+network:
+  # Networks that share the same Redis and Postgres need a different namespace. Redis keys and channels get the namespace as prefix
+  # and the Postgres tables are created in a schema with the name of the namespace. Only lowercase letters, numbers and underscores, starting with a letter.
+  namespace: ""
+
+# How crashed proxies are found. Every proxy sets a key in redis each interval, which expires after the ttl.
+liveness:
+  interval: 2s
+  ttl: 6s
+  # Redis tells the other proxies right away when a key expired. Needs permission to change notify-keyspace-events,
+  # otherwise enable the Ex events on the redis servers. Without it, crashed proxies are found by checking every interval.
+  keyspaceNotifications: true
+  # The presence of online players is set with the same interval and ttl. The saved online value of players
+  # is fixed when it differs from the presence, which happens after a proxy crashed.
+  presenceReconcileInterval: 1m
+
+# Every proxy registers the backends of the other proxies in gate, so players can switch to any backend without a proxy transfer.
+# A backend with the same address as a backend of this proxy is not registered twice.
+registry:
+  shared: true
+  # Players that join are sent to a backend of the proxy they joined. The backends of other proxies are used when there are none.
+  preferOwnBackends: true
+  syncInterval: 30s
+
+# Backends found while running are added to this proxy and removed when they are gone. Every proxy asks the providers itself.
+discovery:
+  # Options: static, file, dns, kubernetes
+  providers: []
+  interval: 10s
+  static:
+    # backends:
+    #   - name: lobby-1
+    #     address: "10.0.0.5:25565"
+    #     group: lobby
+    #     tags:
+    #       - eu
+    backends: []
+  file:
+    # A json or yaml file with a backends list, like the static backends. Changes are picked up every interval.
+    path: ./config/backends.yml
+  dns:
+    # Every target of an srv record is a backend, named after the name and the host of the target.
+    # records:
+    #   - name: lobby
+    #     record: _minecraft._tcp.lobby.example.com
+    #     group: lobby
+    records: []
+    # host:port of the dns server. Empty uses the resolver of the system.
+    resolver: ""
+  kubernetes:
+    # Every ready address of the endpoints of a service is a backend, named after its pod.
+    # The port is the name or the number of the port, empty uses the first port.
+    # services:
+    #   - name: lobby
+    #     port: minecraft
+    #     group: lobby
+    services: []
+    # Empty uses the namespace of the proxies.
+    namespace: ""
+    apiServer: https://kubernetes.default.svc
+    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
+    caFile: /var/run/secrets/kubernetes.io/serviceaccount/ca.crt
+
+# Every proxy pings its backends like a client does for the server list. Players are only sent to backends that answered.
+healthCheck:
+  interval: 5s
+  timeout: 3s
+  # Failed pings in a row before a backend is offline.
+  failures: 2
+  # Latency and player count are saved each interval, a change of status is saved right away.
+  saveInterval: 30s
+
+# Backends are put in groups, like lobby or survival, and can have tags. Set by the name the backend has in gate.
+# Backends without group are in the default group. Groups only have lowercase letters, numbers, dashes and underscores.
+# Names with dots are read as nested keys, so backends with dots in their name can't be set here.
+# backends:
+#   lobby-1:
+#     group: lobby
+#     tags:
+#       - eu
+backends: {}
+
+routing:
+  # Group players are sent to when they join. Empty to use every backend.
+  initialGroup: ""
+  # Group players are sent to when they are kicked from a backend. Empty to use the initial group.
+  fallbackGroup: ""
+
+# How a backend is chosen when a player joins or is transferred without a backend.
+balancing:
+  # Options: least-players, weighted, round-robin, sticky-last-backend
+  strategy: least-players
+  # Used by weighted, by backend name. Backends without weight have weight 1.
+  weights: {}
+  # Backend groups can use another strategy and other weights.
+  # groups:
+  #   lobby:
+  #     strategy: round-robin
+  groups: {}
+
+# Players can't join the network, a proxy or a backend in maintenance, except for players with a bypass role.
+maintenance:
+  message: "We are in maintenance. Please try again later."
+  # Shown in the server list while the network or the proxy is in maintenance.
+  motd: "In maintenance"
+  # Options: admin, builder, default, moderator
+  bypassRoles:
+    - admin
+    - moderator
+    - builder
+
+# Draining moves all players to other proxies, for example before a restart. A draining proxy is put in maintenance,
+# so no new players are sent to it. Members of a party are moved to the same proxy.
+drain:
+  batchSize: 10
+  interval: 1s
+  # Used by the drain command.
+  timeout: 5m
+  # Used when the proxy shuts down.
+  shutdownTimeout: 20s
+
+# Players that are loaded in memory. Online players are always loaded, offline players only when needed.
+cache:
+  players:
+    maxSize: 10000
+    ttl: 30m
+
 # The behavior of the gate proxy. By standard not needed, but it can be used to change behavior that is not changed by this program.
 # config:
 
 
 databases:
+  # While Redis or Postgres can't be reached, loaded players keep being served and writes are queued until the storage is back.
+  degraded:
+    breaker:
+      # Failures in a row before calls are stopped.
+      failures: 3
+      # Time before a stopped storage is tried again.
+      cooldown: 10s
+    journal:
+      # Queued writes. Writes over the maximum fail.
+      maxSize: 10000
   redis:
+    # Options: standalone, sentinel, cluster
+    topology: standalone
+    # Used by standalone when no addresses are set.
     host: "localhost"
     port: 6379
+    # host:port of the server, the sentinels or the cluster nodes.
+    addresses: []
+    # Name of the master watched by the sentinels. Only used by sentinel.
+    masterName: ""
+    # Not supported by cluster.
     database: 0
+    # ACL user. Leave empty to use the default user.
+    username: ""
     password: ""
+    sentinel:
+      # Only needed when the sentinels use other credentials than the servers.
+      username: ""
+      password: ""
+    tls:
+      enabled: false
+      insecureSkipVerify: false
+      serverName: ""
+      # PEM files. The system certificates are used when no CA file is set.
+      caFile: ""
+      certFile: ""
+      keyFile: ""
+    # Zero uses the defaults of the client.
+    pool:
+      size: 0
+      minIdle: 0
+      maxIdleTime: 0s
+      maxRetries: 0
+    timeouts:
+      dial: 5s
+      read: 3s
+      write: 3s
+      pool: 4s
+    # How update messages are sent between proxies. Options: pubsub, streams
+    # streams keeps messages for proxies that are reconnecting, so their data doesn't get outdated.
+    transport: pubsub
+    streams:
+      # Amount of messages kept per stream. A proxy that missed more messages reloads its data.
+      maxLength: 10000
   postgres:
     username: ""
     password: ""
     host: "localhost"
     port: 5432
     database: "vesperis_mp"
+    # host:port of read replicas. Reads that don't need the latest data are spread over them. Writes always go to the primary.
+    replicas: []
+    tls:
+      # Options: disable, allow, prefer, require, verify-ca, verify-full
+      mode: prefer
+      caFile: ""
+      certFile: ""
+      keyFile: ""
+    # Zero uses the defaults of the client.
+    pool:
+      minConns: 0
+      maxConns: 0
+      maxConnLifetime: 0s
+      maxConnIdleTime: 0s
+    # Statements running longer are cancelled. Zero disables the timeout.
+    statementTimeout: 30s
 `)
 
 	err := os.MkdirAll("./config", os.ModePerm)
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Where backends are found while running.
+type DiscoveryProvider string
+
+const (
+	// The backends set in the config.
+	DiscoveryProvider_Static DiscoveryProvider = "static"
+	// The backends in a json or yaml file. The file is read again every interval.
+	DiscoveryProvider_File DiscoveryProvider = "file"
+	// The targets of dns srv records.
+	DiscoveryProvider_DNS DiscoveryProvider = "dns"
+	// The ready addresses of the endpoints of kubernetes services.
+	DiscoveryProvider_Kubernetes DiscoveryProvider = "kubernetes"
+)
+
+var ErrIncorrectDiscoveryProvider = errors.New("incorrect discovery provider")
+
+var AllowedDiscoveryProviders = []DiscoveryProvider{
+	DiscoveryProvider_Static,
+	DiscoveryProvider_File,
+	DiscoveryProvider_DNS,
+	DiscoveryProvider_Kubernetes,
+}
+
+// A backend set in the config or in the discovery file.
+type DiscoveryBackend struct {
+	Name    string
+	Address string
+	Group   string
+	Tags    []string
+}
+
+// Every target of the srv record is a backend. The backends are named after the name and the host of the target.
+type DiscoverySRVRecord struct {
+	Name   string
+	Record string
+	Group  string
+	Tags   []string
+}
+
+// Every ready address of the service is a backend. The port can be the name or the number of the port, empty uses the first port.
+type DiscoveryKubernetesService struct {
+	Name  string
+	Port  string
+	Group string
+	Tags  []string
+}
+
+// The providers that are used. Wrong providers are left out.
+func (c *Config) GetDiscoveryProviders() []DiscoveryProvider {
+	var l []DiscoveryProvider
+	for _, s := range c.v.GetStringSlice("discovery.providers") {
+		dp, err := GetDiscoveryProvider(s)
+		if err != nil {
+			c.l.Warn("incorrect discovery provider", "provider", s)
+			continue
+		}
+
+		l = append(l, dp)
+	}
+
+	return l
+}
+
+// How often the providers are asked for the backends.
+func (c *Config) GetDiscoveryInterval() time.Duration {
+	d := c.v.GetDuration("discovery.interval")
+	if d <= 0 {
+		return 10 * time.Second
+	}
+
+	return d
+}
+
+func (c *Config) GetDiscoveryStaticBackends() []DiscoveryBackend {
+	var l []DiscoveryBackend
+	err := c.v.UnmarshalKey("discovery.static.backends", &l)
+	if err != nil {
+		c.l.Warn("incorrect static discovery backends", "error", err)
+		return nil
+	}
+
+	return l
+}
+
+// The json or yaml file with a backends list, in the same format as the static backends.
+func (c *Config) GetDiscoveryFile() string {
+	s := c.v.GetString("discovery.file.path")
+	if s == "" {
+		return "./config/backends.yml"
+	}
+
+	return s
+}
+
+func (c *Config) GetDiscoverySRVRecords() []DiscoverySRVRecord {
+	var l []DiscoverySRVRecord
+	err := c.v.UnmarshalKey("discovery.dns.records", &l)
+	if err != nil {
+		c.l.Warn("incorrect dns discovery records", "error", err)
+		return nil
+	}
+
+	return l
+}
+
+// host:port of the dns server. Empty uses the resolver of the system.
+func (c *Config) GetDiscoveryDNSResolver() string {
+	return c.v.GetString("discovery.dns.resolver")
+}
+
+func (c *Config) GetDiscoveryKubernetesServices() []DiscoveryKubernetesService {
+	var l []DiscoveryKubernetesService
+	err := c.v.UnmarshalKey("discovery.kubernetes.services", &l)
+	if err != nil {
+		c.l.Warn("incorrect kubernetes discovery services", "error", err)
+		return nil
+	}
+
+	return l
+}
+
+// The namespace of the services. Uses the namespace of the proxies when nothing is set.
+func (c *Config) GetDiscoveryKubernetesNamespace() string {
+	s := c.v.GetString("discovery.kubernetes.namespace")
+	if s == "" {
+		return c.GetKubernetesNamespace()
+	}
+
+	return s
+}
+
+func (c *Config) GetDiscoveryKubernetesAPIServer() string {
+	s := c.v.GetString("discovery.kubernetes.apiServer")
+	if s == "" {
+		return "https://kubernetes.default.svc"
+	}
+
+	return strings.TrimSuffix(s, "/")
+}
+
+// The token of the service account. Not used when the file doesn't exist.
+func (c *Config) GetDiscoveryKubernetesTokenFile() string {
+	s := c.v.GetString("discovery.kubernetes.tokenFile")
+	if s == "" {
+		return "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+
+	return s
+}
+
+// The certificate of the api server. The certificates of the system are used when the file doesn't exist.
+func (c *Config) GetDiscoveryKubernetesCAFile() string {
+	s := c.v.GetString("discovery.kubernetes.caFile")
+	if s == "" {
+		return "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	}
+
+	return s
+}
+
+// The namespace the proxies run in. Uses the POD_NAMESPACE environment variable when nothing is set.
+func (c *Config) GetKubernetesNamespace() string {
+	s := c.v.GetString("kubernetes.namespace")
+	if s == "" {
+		s = os.Getenv("POD_NAMESPACE")
+	}
+
+	if s == "" {
+		return "default"
+	}
+
+	return s
+}
+
+// The headless service of the proxies. Every proxy can be reached with its pod name under the service.
+func (c *Config) GetKubernetesService() string {
+	s := c.v.GetString("kubernetes.service")
+	if s == "" {
+		return "proxy"
+	}
+
+	return s
+}
+
+func (c *Config) GetKubernetesPort() int {
+	p := c.v.GetInt("kubernetes.port")
+	if p <= 0 || p > 65535 {
+		return 25565
+	}
+
+	return p
+}
+
+func (c *Config) GetKubernetesClusterDomain() string {
+	s := c.v.GetString("kubernetes.clusterDomain")
+	if s == "" {
+		return "cluster.local"
+	}
+
+	return s
+}
+
+func GetDiscoveryProvider(s string) (DiscoveryProvider, error) {
+	dp := DiscoveryProvider(s)
+	if !slices.Contains(AllowedDiscoveryProviders, dp) {
+		return DiscoveryProvider(""), ErrIncorrectDiscoveryProvider
+	}
+
+	return dp, nil
+}
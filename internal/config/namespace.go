@@ -0,0 +1,21 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+)
+
+var ErrIncorrectNamespace = errors.New("incorrect network namespace, only lowercase letters, numbers and underscores are allowed and it has to start with a letter")
+
+// also used as postgres schema, which can't start with a digit
+var namespaceRegex = regexp.MustCompile(`^([a-z][a-z0-9_]*)?$`)
+
+// check config which network namespace is used. if nothing is set, there is no namespace
+func (c *Config) getNamespace() (string, error) {
+	ns := c.v.GetString("network.namespace")
+	if !namespaceRegex.MatchString(ns) {
+		return "", ErrIncorrectNamespace
+	}
+
+	return ns, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// How the connection to Postgres is secured. Same as the sslmode of libpq.
+type PostgresSSLMode string
+
+const (
+	PostgresSSLMode_Disable    PostgresSSLMode = "disable"
+	PostgresSSLMode_Allow      PostgresSSLMode = "allow"
+	PostgresSSLMode_Prefer     PostgresSSLMode = "prefer"
+	PostgresSSLMode_Require    PostgresSSLMode = "require"
+	PostgresSSLMode_VerifyCA   PostgresSSLMode = "verify-ca"
+	PostgresSSLMode_VerifyFull PostgresSSLMode = "verify-full"
+)
+
+var ErrIncorrectPostgresSSLMode = errors.New("incorrect postgres ssl mode")
+
+var AllowedPostgresSSLModes = []PostgresSSLMode{
+	PostgresSSLMode_Disable,
+	PostgresSSLMode_Allow,
+	PostgresSSLMode_Prefer,
+	PostgresSSLMode_Require,
+	PostgresSSLMode_VerifyCA,
+	PostgresSSLMode_VerifyFull,
+}
+
+// check config which ssl mode is used. if nothing is set, prefer is used
+func (c *Config) getPostgresSSLMode() (PostgresSSLMode, error) {
+	s := c.v.GetString("databases.postgres.tls.mode")
+	if s == "" {
+		return PostgresSSLMode_Prefer, nil
+	}
+
+	return GetPostgresSSLMode(s)
+}
+
+func GetPostgresSSLMode(s string) (PostgresSSLMode, error) {
+	m := PostgresSSLMode(s)
+	if !slices.Contains(AllowedPostgresSSLModes, m) {
+		return PostgresSSLMode(""), ErrIncorrectPostgresSSLMode
+	}
+
+	return m, nil
+}
+
+// The url of the primary. All writes go to the primary.
+func (c *Config) GetPostgresUrl() string {
+	return c.postgresUrl(net.JoinHostPort(c.v.GetString("databases.postgres.host"), c.v.GetString("databases.postgres.port")))
+}
+
+// The urls of the read replicas. Empty when no replicas are set.
+func (c *Config) GetPostgresReplicaUrls() []string {
+	var l []string
+	for _, address := range c.v.GetStringSlice("databases.postgres.replicas") {
+		l = append(l, c.postgresUrl(address))
+	}
+
+	return l
+}
+
+// Builds the url for the given host:port. The settings are the same for the primary and the replicas.
+func (c *Config) postgresUrl(address string) string {
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.v.GetString("databases.postgres.username"), c.v.GetString("databases.postgres.password")),
+		Host:   address,
+		Path:   "/" + c.v.GetString("databases.postgres.database"),
+	}
+
+	q := url.Values{}
+	q.Set("sslmode", string(c.ps))
+
+	files := map[string]string{
+		"sslrootcert": "databases.postgres.tls.caFile",
+		"sslcert":     "databases.postgres.tls.certFile",
+		"sslkey":      "databases.postgres.tls.keyFile",
+	}
+	for param, k := range files {
+		f := c.v.GetString(k)
+		if f != "" {
+			q.Set(param, f)
+		}
+	}
+
+	minConns := c.v.GetInt("databases.postgres.pool.minConns")
+	if minConns > 0 {
+		q.Set("pool_min_conns", strconv.Itoa(minConns))
+	}
+
+	maxConns := c.v.GetInt("databases.postgres.pool.maxConns")
+	if maxConns > 0 {
+		q.Set("pool_max_conns", strconv.Itoa(maxConns))
+	}
+
+	lifetime := c.v.GetDuration("databases.postgres.pool.maxConnLifetime")
+	if lifetime > 0 {
+		q.Set("pool_max_conn_lifetime", lifetime.String())
+	}
+
+	idle := c.v.GetDuration("databases.postgres.pool.maxConnIdleTime")
+	if idle > 0 {
+		q.Set("pool_max_conn_idle_time", idle.String())
+	}
+
+	// sent to postgres as runtime parameter, so it applies to every statement of the connection
+	timeout := c.v.GetDuration("databases.postgres.statementTimeout")
+	if timeout > 0 {
+		q.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
+
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"regexp"
+)
+
+var ErrIncorrectProxyName = errors.New("incorrect proxy name, only letters, numbers, dots, dashes and underscores are allowed")
+
+var proxyNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{0,63}$`)
+
+// check config which name the proxy has. in kubernetes mode the pod name is used when nothing is set,
+// otherwise the proxy has no name and gets a random id on every start
+func (c *Config) getProxyName() (string, error) {
+	n := c.v.GetString("proxy.name")
+	if n == "" && c.m == Mode_Kubernetes {
+		n = os.Getenv("POD_NAME")
+		if n == "" {
+			n, _ = os.Hostname()
+		}
+	}
+
+	if !proxyNameRegex.MatchString(n) {
+		return "", ErrIncorrectProxyName
+	}
+
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"time"
+)
+
+// How the proxies connect to Redis.
+type RedisTopology string
+
+const (
+	// A single Redis server.
+	RedisTopology_Standalone RedisTopology = "standalone"
+	// Redis servers watched by Sentinel. The client follows the master after a failover.
+	RedisTopology_Sentinel RedisTopology = "sentinel"
+	// A Redis Cluster. Keys are spread over multiple masters.
+	RedisTopology_Cluster RedisTopology = "cluster"
+)
+
+var (
+	ErrIncorrectRedisTopology = errors.New("incorrect redis topology")
+	ErrRedisMasterNameMissing = errors.New("redis sentinel needs a master name")
+	ErrRedisAddressesMissing  = errors.New("redis sentinel and cluster need at least one address")
+)
+
+var AllowedRedisTopologies = []RedisTopology{
+	RedisTopology_Standalone,
+	RedisTopology_Sentinel,
+	RedisTopology_Cluster,
+}
+
+// All settings needed to connect to Redis.
+type RedisOptions struct {
+	Topology RedisTopology
+	// host:port of the server, the sentinels or the cluster nodes
+	Addresses []string
+	// name of the master watched by the sentinels
+	MasterName string
+
+	Username string
+	Password string
+	// only needed when the sentinels use other credentials than the servers
+	SentinelUsername string
+	SentinelPassword string
+	// not supported by cluster
+	Database int
+
+	TLS                   bool
+	TLSInsecureSkipVerify bool
+	TLSServerName         string
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+
+	// zero values use the defaults of the client
+	PoolSize        int
+	MinIdleConns    int
+	MaxRetries      int
+	DialTimeout     time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	PoolTimeout     time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// check config which topology is used. if nothing is set, standalone is used
+func (c *Config) getRedisTopology() (RedisTopology, error) {
+	s := c.v.GetString("databases.redis.topology")
+	if s == "" {
+		return RedisTopology_Standalone, nil
+	}
+
+	return GetRedisTopology(s)
+}
+
+func GetRedisTopology(s string) (RedisTopology, error) {
+	t := RedisTopology(s)
+	if !slices.Contains(AllowedRedisTopologies, t) {
+		return RedisTopology(""), ErrIncorrectRedisTopology
+	}
+
+	return t, nil
+}
+
+func (c *Config) getRedisOptions() (*RedisOptions, error) {
+	t, err := c.getRedisTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	o := &RedisOptions{
+		Topology:         t,
+		Addresses:        c.v.GetStringSlice("databases.redis.addresses"),
+		MasterName:       c.v.GetString("databases.redis.masterName"),
+		Username:         c.v.GetString("databases.redis.username"),
+		Password:         c.v.GetString("databases.redis.password"),
+		SentinelUsername: c.v.GetString("databases.redis.sentinel.username"),
+		SentinelPassword: c.v.GetString("databases.redis.sentinel.password"),
+		Database:         c.v.GetInt("databases.redis.database"),
+
+		TLS:                   c.v.GetBool("databases.redis.tls.enabled"),
+		TLSInsecureSkipVerify: c.v.GetBool("databases.redis.tls.insecureSkipVerify"),
+		TLSServerName:         c.v.GetString("databases.redis.tls.serverName"),
+		TLSCAFile:             c.v.GetString("databases.redis.tls.caFile"),
+		TLSCertFile:           c.v.GetString("databases.redis.tls.certFile"),
+		TLSKeyFile:            c.v.GetString("databases.redis.tls.keyFile"),
+
+		PoolSize:        c.v.GetInt("databases.redis.pool.size"),
+		MinIdleConns:    c.v.GetInt("databases.redis.pool.minIdle"),
+		MaxRetries:      c.v.GetInt("databases.redis.pool.maxRetries"),
+		DialTimeout:     c.v.GetDuration("databases.redis.timeouts.dial"),
+		ReadTimeout:     c.v.GetDuration("databases.redis.timeouts.read"),
+		WriteTimeout:    c.v.GetDuration("databases.redis.timeouts.write"),
+		PoolTimeout:     c.v.GetDuration("databases.redis.timeouts.pool"),
+		ConnMaxIdleTime: c.v.GetDuration("databases.redis.pool.maxIdleTime"),
+	}
+
+	switch t {
+	case RedisTopology_Standalone:
+		// the old host and port settings are still used when no addresses are set
+		if len(o.Addresses) == 0 {
+			o.Addresses = []string{net.JoinHostPort(c.v.GetString("databases.redis.host"), c.v.GetString("databases.redis.port"))}
+		}
+	case RedisTopology_Sentinel:
+		if o.MasterName == "" {
+			return nil, ErrRedisMasterNameMissing
+		}
+		fallthrough
+	case RedisTopology_Cluster:
+		if len(o.Addresses) == 0 {
+			return nil, ErrRedisAddressesMissing
+		}
+	}
+
+	return o, nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+	"slices"
+)
+
+type StorageType string
+
+const (
+	// Redis & Postgres
+	StorageType_Database StorageType = "database"
+	// Everything is kept in memory and lost on shutdown. Only usable with a single proxy.
+	StorageType_Memory StorageType = "memory"
+)
+
+var ErrIncorrectStorageType = errors.New("incorrect storage type")
+
+var AllowedStorageTypes = []StorageType{
+	StorageType_Database,
+	StorageType_Memory,
+}
+
+// check config which storage is used. if nothing is set, the database is used
+func (c *Config) getStorageType() (StorageType, error) {
+	s := c.v.GetString("storage")
+	if s == "" {
+		return StorageType_Database, nil
+	}
+
+	return GetStorageType(s)
+}
+
+func GetStorageType(s string) (StorageType, error) {
+	st := StorageType(s)
+	if !slices.Contains(AllowedStorageTypes, st) {
+		return StorageType(""), ErrIncorrectStorageType
+	}
+
+	return st, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"slices"
+)
+
+// How update messages are sent between proxies.
+type Transport string
+
+const (
+	// Redis Pub/Sub. Messages sent while a proxy is not connected are lost.
+	Transport_PubSub Transport = "pubsub"
+	// Redis Streams. Every proxy keeps its own position and receives missed messages after a reconnect.
+	Transport_Streams Transport = "streams"
+)
+
+var ErrIncorrectTransport = errors.New("incorrect transport")
+
+var AllowedTransports = []Transport{
+	Transport_PubSub,
+	Transport_Streams,
+}
+
+// check config which transport is used. if nothing is set, pub/sub is used
+func (c *Config) getTransport() (Transport, error) {
+	s := c.v.GetString("databases.redis.transport")
+	if s == "" {
+		return Transport_PubSub, nil
+	}
+
+	return GetTransport(s)
+}
+
+func GetTransport(s string) (Transport, error) {
+	t := Transport(s)
+	if !slices.Contains(AllowedTransports, t) {
+		return Transport(""), ErrIncorrectTransport
+	}
+
+	return t, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Alive keys expire when they are not set again in time. They show that something, like a proxy, is still running.
+// With keyspace notifications enabled in redis, other proxies are told right away when a key expires.
+// Without them, the keys have to be checked.
+
+func (db *Database) redisAliveKeyTranslator(key string) string {
+	return db.ns + "alive:" + key
+}
+
+func (db *Database) SetAlive(key string, ttl time.Duration) error {
+	return db.guard(db.hm.bm, func() error {
+		return db.r.Set(db.ctx, db.redisAliveKeyTranslator(key), time.Now().UnixMilli(), ttl).Err()
+	})
+}
+
+// Sets the key only when it is not set. Returns false when the key is still set by something else.
+func (db *Database) SetAliveIfAbsent(key string, ttl time.Duration) (bool, error) {
+	return guardResult(db, db.hm.bm, func() (bool, error) {
+		return db.r.SetNX(db.ctx, db.redisAliveKeyTranslator(key), time.Now().UnixMilli(), ttl).Result()
+	})
+}
+
+func (db *Database) IsAlive(key string) (bool, error) {
+	return guardResult(db, db.hm.bm, func() (bool, error) {
+		n, err := db.r.Exists(db.ctx, db.redisAliveKeyTranslator(key)).Result()
+		return n > 0, err
+	})
+}
+
+func (db *Database) DeleteAlive(key string) error {
+	return db.guard(db.hm.bm, func() error {
+		return db.r.Del(db.ctx, db.redisAliveKeyTranslator(key)).Err()
+	})
+}
+
+const expiredListenerChannel = "__keyevent@*__:expired"
+
+// Calls the handler with the key of every alive key that expires. Enables the expired keyspace notifications in redis if possible.
+// In a cluster, only the expired keys of a single node are received, so the keys should still be checked.
+func (db *Database) CreateExpiredListener(handler func(key string)) {
+	db.enableExpiredNotifications()
+
+	db.lm.mu.Lock()
+	defer db.lm.mu.Unlock()
+
+	if db.listenerExists(expiredListenerChannel) {
+		db.l.Warn("database listener already existing", "channel", expiredListenerChannel)
+		return
+	}
+
+	pubsub := db.r.PSubscribe(db.ctx, expiredListenerChannel)
+	db.lm.m[expiredListenerChannel] = pubsub
+
+	prefix := db.redisAliveKeyTranslator("")
+	go func() {
+		for {
+			msg, ok := <-pubsub.Channel()
+			if !ok {
+				db.l.Debug("database redis expired listener closed")
+				return
+			}
+
+			k, ok := strings.CutPrefix(msg.Payload, prefix)
+			if ok {
+				handler(k)
+			}
+		}
+	}()
+}
+
+// Adds the expired events to the keyspace notifications, keeping the events that are already enabled.
+func (db *Database) enableExpiredNotifications() {
+	c, ok := db.r.(*redis.Client)
+	if !ok {
+		db.l.Debug("redis keyspace notifications have to be enabled on the servers", "events", "Ex")
+		return
+	}
+
+	res, err := c.ConfigGet(db.ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		db.l.Warn("redis get keyspace notifications error, dead proxies are found by checking", "error", err)
+		return
+	}
+
+	// A is an alias for all events, including the expired ones
+	events := res["notify-keyspace-events"]
+	all := strings.Contains(events, "A")
+	if strings.Contains(events, "E") && (all || strings.Contains(events, "x")) {
+		return
+	}
+
+	if !strings.Contains(events, "E") {
+		events += "E"
+	}
+	if !all && !strings.Contains(events, "x") {
+		events += "x"
+	}
+
+	err = c.ConfigSet(db.ctx, "notify-keyspace-events", events).Err()
+	if err != nil {
+		db.l.Warn("redis enable keyspace notifications error, dead proxies are found by checking", "error", err)
+	}
+}
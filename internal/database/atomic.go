@@ -0,0 +1,211 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+var ErrListValueNotFound = errors.New("value not found in list")
+
+// The list at the path, or an empty list if the field is missing or not a list. $1 is the path.
+func postgresListAtPath(dt DataType) string {
+	return "(CASE WHEN jsonb_typeof(" + dt.String() + "Data #> $1) = 'array' THEN " + dt.String() + "Data #> $1 ELSE '[]'::jsonb END)"
+}
+
+// Puts the value as it is stored in postgres after an atomic change in the cache.
+// Deleting the field instead would let a read that started before the change cache the old value again.
+func (db *Database) cacheDataField(dt DataType, id uuid.UUID, key, field string, jsonData []byte) {
+	err := db.r.HSet(db.ctx, key, field, jsonData).Err()
+	if err != nil {
+		db.l.Warn("redis "+dt.String()+" data set error", dt.String()+"Id", id, "field", field, "error", err)
+		return
+	}
+
+	err = db.r.HExpire(db.ctx, key, redisTTL, field).Err()
+	if err != nil {
+		db.l.Warn("redis "+dt.String()+" data set expiration error", dt.String()+"Id", id, "field", field, "error", err)
+	}
+}
+
+// Adds the value to the list field if it isn't already in it. Returns the list as it is stored after the change.
+func (db *Database) addToDataList(dt DataType, id uuid.UUID, key, field string, val uuid.UUID) ([]uuid.UUID, error) {
+	jsonVal, err := json.Marshal([]uuid.UUID{val})
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	list := postgresListAtPath(dt)
+	path := safeJsonPathForPostgres(field)
+	query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, CASE WHEN " + list + " @> $2::jsonb THEN " + list + " ELSE " + list + " || $2::jsonb END, true) WHERE " + dt.String() + "Id = $3 RETURNING " + dt.String() + "Data #> $1"
+
+	var jsonData []byte
+	err = db.p.QueryRow(db.ctx, query, path, jsonVal, id).Scan(&jsonData)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrDataNotFound
+		}
+
+		db.l.Error("postgres "+dt.String()+" data list add error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	db.cacheDataField(dt, id, key, field, jsonData)
+
+	var l []uuid.UUID
+	err = json.Unmarshal(jsonData, &l)
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data unmarshall error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Removes the value from the list field. Returns ErrListValueNotFound if the value is not in the list.
+// Returns the list as it is stored after the change.
+func (db *Database) removeFromDataList(dt DataType, id uuid.UUID, key, field string, val uuid.UUID) ([]uuid.UUID, error) {
+	jsonVal, err := json.Marshal(val)
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	jsonList, err := json.Marshal([]uuid.UUID{val})
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	list := postgresListAtPath(dt)
+	path := safeJsonPathForPostgres(field)
+	query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, COALESCE((SELECT jsonb_agg(e) FROM jsonb_array_elements(" + list + ") e WHERE e <> $2::jsonb), '[]'::jsonb), true) WHERE " + dt.String() + "Id = $3 AND " + list + " @> $4::jsonb RETURNING " + dt.String() + "Data #> $1"
+
+	var jsonData []byte
+	err = db.p.QueryRow(db.ctx, query, path, jsonVal, id, jsonList).Scan(&jsonData)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrListValueNotFound
+		}
+
+		db.l.Error("postgres "+dt.String()+" data list remove error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	db.cacheDataField(dt, id, key, field, jsonData)
+
+	var l []uuid.UUID
+	err = json.Unmarshal(jsonData, &l)
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data unmarshall error", dt.String()+"Id", id, "field", field, "error", err)
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Only sets the field if the stored value is equal to the expected value. Returns if the value has been set.
+func (db *Database) compareAndSetDataField(dt DataType, id uuid.UUID, key, field string, expected, val any) (bool, error) {
+	jsonExpected, err := json.Marshal(expected)
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+		return false, err
+	}
+
+	jsonVal, err := json.Marshal(val)
+	if err != nil {
+		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+		return false, err
+	}
+
+	path := safeJsonPathForPostgres(field)
+	query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, $2::jsonb, true) WHERE " + dt.String() + "Id = $3 AND " + dt.String() + "Data #> $1 = $4::jsonb"
+	tag, err := db.p.Exec(db.ctx, query, path, jsonVal, id, jsonExpected)
+	if err != nil {
+		db.l.Error("postgres "+dt.String()+" data compare and set error", dt.String()+"Id", id, "field", field, "error", err)
+		return false, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	db.cacheDataField(dt, id, key, field, jsonVal)
+	return true, nil
+}
+
+func (db *Database) AddToPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		return db.addToDataList(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), field.String(), val)
+	})
+}
+
+func (db *Database) AddToPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		return db.addToDataList(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), field.String(), val)
+	})
+}
+
+func (db *Database) AddToProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return db.queuedListWrite("proxy data list add "+proxyId.String(), func() ([]uuid.UUID, error) {
+		return db.addToDataList(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), field.String(), val)
+	})
+}
+
+func (db *Database) AddToBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return db.queuedListWrite("backend data list add "+backendId.String(), func() ([]uuid.UUID, error) {
+		return db.addToDataList(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), field.String(), val)
+	})
+}
+
+func (db *Database) RemoveFromPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		return db.removeFromDataList(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), field.String(), val)
+	})
+}
+
+func (db *Database) RemoveFromPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		return db.removeFromDataList(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), field.String(), val)
+	})
+}
+
+func (db *Database) RemoveFromProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return db.queuedListWrite("proxy data list remove "+proxyId.String(), func() ([]uuid.UUID, error) {
+		return db.removeFromDataList(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), field.String(), val)
+	})
+}
+
+func (db *Database) RemoveFromBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return db.queuedListWrite("backend data list remove "+backendId.String(), func() ([]uuid.UUID, error) {
+		return db.removeFromDataList(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), field.String(), val)
+	})
+}
+
+func (db *Database) CompareAndSetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, expected, val any) (bool, error) {
+	return guardResult(db, db.hm.bd, func() (bool, error) {
+		return db.compareAndSetDataField(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), field.String(), expected, val)
+	})
+}
+
+func (db *Database) CompareAndSetPartyDataField(partyId uuid.UUID, field key.PartyKey, expected, val any) (bool, error) {
+	return guardResult(db, db.hm.bd, func() (bool, error) {
+		return db.compareAndSetDataField(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), field.String(), expected, val)
+	})
+}
+
+func (db *Database) CompareAndSetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, expected, val any) (bool, error) {
+	return guardResult(db, db.hm.bd, func() (bool, error) {
+		return db.compareAndSetDataField(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), field.String(), expected, val)
+	})
+}
+
+func (db *Database) CompareAndSetBackendDataField(backendId uuid.UUID, field key.BackendKey, expected, val any) (bool, error) {
+	return guardResult(db, db.hm.bd, func() (bool, error) {
+		return db.compareAndSetDataField(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), field.String(), expected, val)
+	})
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -20,11 +23,25 @@ import (
 
 // The Database uses Postgres as main storage. Whenever possible, redis will help, to make searches faster. Redis is used for communication between proxies.
 type Database struct {
-	r   *redis.Client
+	r   redis.UniversalClient
 	p   *pgxpool.Pool
 	l   *logger.Logger
 	ctx context.Context
 	lm  *listenManager
+
+	t      config.Transport
+	maxLen int64
+
+	// prefix of all redis keys and channels, empty when no namespace is set
+	ns string
+
+	// read replicas of postgres, only used by stale reads
+	rp []*pgxpool.Pool
+	rn *atomic.Uint64
+	// set on the copy returned by Stale()
+	stale bool
+
+	hm *healthManager
 }
 
 var (
@@ -46,16 +63,34 @@ func Init(ctx context.Context, c *config.Config, l *logger.Logger) (*Database, e
 		return nil, err
 	}
 
+	rp, err := initPostgresReplicas(ctx, l, c)
+	if err != nil {
+		return nil, err
+	}
+
 	lm := &listenManager{
 		m: make(map[string]*redis.PubSub),
+		s: make(map[string]context.CancelFunc),
 	}
 
 	db := &Database{
-		r:   r,
-		l:   l,
-		lm:  lm,
-		ctx: ctx,
-		p:   p,
+		r:      r,
+		l:      l,
+		lm:     lm,
+		ctx:    ctx,
+		p:      p,
+		t:      c.GetTransport(),
+		maxLen: c.GetStreamMaxLength(),
+		rp:     rp,
+		rn:     &atomic.Uint64{},
+		hm: &healthManager{
+			bd: newBreaker(c.GetBreakerFailures(), c.GetBreakerCooldown(), newJournal(c.GetJournalMaxSize())),
+			bm: newBreaker(c.GetBreakerFailures(), c.GetBreakerCooldown(), newJournal(c.GetJournalMaxSize())),
+		},
+	}
+
+	if c.GetNamespace() != "" {
+		db.ns = c.GetNamespace() + ":"
 	}
 
 	// err = db.Test()
@@ -63,106 +98,137 @@ func Init(ctx context.Context, c *config.Config, l *logger.Logger) (*Database, e
 	// 	return db, err
 	// }
 
+	db.startHealthWatcher()
+
 	db.l.Info("initialized database", "duration", time.Since(now))
 	return db, nil
 }
 
 // handles all the listeners that are actively listening for messages
 type listenManager struct {
-	m  map[string]*redis.PubSub
+	m map[string]*redis.PubSub
+	// stream listeners, stopped by cancelling their context
+	s  map[string]context.CancelFunc
 	mu sync.Mutex
 }
 
 const redisTTL = 15 * time.Minute
 
-func (db *Database) GetData(key string, dest any) error {
-	val, err := db.r.HGet(db.ctx, DefaultDataType.String(), key).Result()
-	if err == nil && val != "" {
-		err := json.Unmarshal([]byte(val), dest)
-		if err == nil {
-			return nil
-		}
+// Returns a database that reads from the replicas. Used when the caller doesn't need the latest data,
+// for example when listing. Writes still go to the primary.
+func (db *Database) Stale() Storage {
+	if len(db.rp) == 0 {
+		return db
 	}
 
-	var jsonData []byte
-	query := `SELECT dataValue FROM data WHERE dataKey = $1`
+	s := *db
+	s.stale = true
+	return &s
+}
 
-	err = db.p.QueryRow(db.ctx, query, key).Scan(&jsonData)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return ErrDataNotFound
-		}
-		db.l.Error("postgres data get error", "key", key, "error", err)
-		return err
+// The pool used for reads. The replicas take turns, so the load is spread.
+func (db *Database) reader() *pgxpool.Pool {
+	if !db.stale || len(db.rp) == 0 {
+		return db.p
 	}
 
-	err = json.Unmarshal(jsonData, dest)
-	if err != nil {
-		db.l.Error("json data unmarshal error", "key", key, "error", err)
-		return err
-	}
+	return db.rp[db.rn.Add(1)%uint64(len(db.rp))]
+}
 
-	go func() {
-		err = db.r.HSet(db.ctx, DefaultDataType.String(), key, jsonData).Err()
+func (db *Database) GetData(key string, dest any) error {
+	return db.guard(db.hm.bd, func() error {
+		val, err := db.r.HGet(db.ctx, db.namespaced(DefaultDataType.String()), key).Result()
+		if err == nil && val != "" {
+			err := json.Unmarshal([]byte(val), dest)
+			if err == nil {
+				return nil
+			}
+		}
+
+		var jsonData []byte
+		query := `SELECT dataValue FROM data WHERE dataKey = $1`
+
+		err = db.reader().QueryRow(db.ctx, query, key).Scan(&jsonData)
 		if err != nil {
-			db.l.Warn("redis data set error", "key", key, "error", err)
-		} else {
-			err = db.r.HExpire(db.ctx, DefaultDataType.String(), redisTTL, key).Err()
-			if err != nil {
-				db.l.Warn("redis data set expiration error", "key", key, "error", err)
+			if err == pgx.ErrNoRows {
+				return ErrDataNotFound
 			}
+			db.l.Error("postgres data get error", "key", key, "error", err)
+			return err
 		}
-	}()
 
-	return nil
+		err = json.Unmarshal(jsonData, dest)
+		if err != nil {
+			db.l.Error("json data unmarshal error", "key", key, "error", err)
+			return err
+		}
+
+		go func() {
+			err = db.r.HSet(db.ctx, db.namespaced(DefaultDataType.String()), key, jsonData).Err()
+			if err != nil {
+				db.l.Warn("redis data set error", "key", key, "error", err)
+			} else {
+				err = db.r.HExpire(db.ctx, db.namespaced(DefaultDataType.String()), redisTTL, key).Err()
+				if err != nil {
+					db.l.Warn("redis data set expiration error", "key", key, "error", err)
+				}
+			}
+		}()
+
+		return nil
+	})
 }
 
 func (db *Database) SetData(key string, val any) error {
-	jsonVal, err := json.Marshal(val)
-	if err != nil {
-		db.l.Error("json data marshal error", "key", key, "error", err)
-		return err
-	}
+	return db.guardWrite(db.hm.bd, "data "+key, func() error {
+		jsonVal, err := json.Marshal(val)
+		if err != nil {
+			db.l.Error("json data marshal error", "key", key, "error", err)
+			return err
+		}
 
-	err = db.r.HSet(db.ctx, "data", key, jsonVal).Err()
-	if err != nil {
-		db.l.Warn("redis data set error", "key", key, "error", err)
-	} else {
-		err = db.r.HExpire(db.ctx, "data", redisTTL, key).Err()
+		err = db.r.HSet(db.ctx, db.namespaced(DefaultDataType.String()), key, jsonVal).Err()
 		if err != nil {
-			db.l.Warn("redis data set expiration error", "key", key, "error", err)
+			db.l.Warn("redis data set error", "key", key, "error", err)
+		} else {
+			err = db.r.HExpire(db.ctx, db.namespaced(DefaultDataType.String()), redisTTL, key).Err()
+			if err != nil {
+				db.l.Warn("redis data set expiration error", "key", key, "error", err)
+			}
 		}
-	}
 
-	query := `
-		UPDATE data
-		SET dataValue = $1
-		WHERE dataKey = $2
+		query := `
+		INSERT INTO data (dataKey, dataValue)
+		VALUES ($1, $2)
+		ON CONFLICT (dataKey) DO UPDATE SET dataValue = $2
 	`
-	_, err = db.p.Exec(db.ctx, query, jsonVal, key)
-	if err != nil {
-		db.l.Error("postgres data update error", "key", key, "error", err)
-		return err
-	}
+		_, err = db.p.Exec(db.ctx, query, key, jsonVal)
+		if err != nil {
+			db.l.Error("postgres data update error", "key", key, "error", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (db *Database) setData(dt DataType, id uuid.UUID, data any) error {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "error", err)
-		return err
-	}
+	return db.guardWrite(db.hm.bd, dt.String()+" data "+id.String(), func() error {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "error", err)
+			return err
+		}
 
-	query := `INSERT INTO ` + dt.String() + `_data (` + dt.String() + `Id, ` + dt.String() + `Data) VALUES ($1, $2::jsonb) ON CONFLICT (` + dt.String() + `Id) DO UPDATE SET ` + dt.String() + `Data = $2::jsonb`
-	_, err = db.p.Exec(db.ctx, query, id, jsonData)
-	if err != nil {
-		db.l.Error("postgres "+dt.String()+" data upsert error", dt.String()+"Id", id, "error", err)
-		return err
-	}
+		query := `INSERT INTO ` + dt.String() + `_data (` + dt.String() + `Id, ` + dt.String() + `Data, ` + dt.String() + `Version) VALUES ($1, $2::jsonb, $3) ON CONFLICT (` + dt.String() + `Id) DO UPDATE SET ` + dt.String() + `Data = $2::jsonb, ` + dt.String() + `Version = $3`
+		_, err = db.p.Exec(db.ctx, query, id, jsonData, latestDocumentVersion(dt))
+		if err != nil {
+			db.l.Error("postgres "+dt.String()+" data upsert error", dt.String()+"Id", id, "error", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (db *Database) SetPlayerData(playerId uuid.UUID, data *data.PlayerData) error {
@@ -182,17 +248,149 @@ func (db *Database) SetBackendData(backendId uuid.UUID, data *data.BackendData)
 }
 
 func (db *Database) getData(dt DataType, id uuid.UUID, dest any) error {
-	query := `SELECT ` + dt.String() + `Data FROM ` + dt.String() + `_data WHERE ` + dt.String() + `Id = $1`
-	err := db.p.QueryRow(db.ctx, query, id).Scan(dest)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return ErrDataNotFound
+	return db.guard(db.hm.bd, func() error {
+		var jsonData []byte
+		var version int
+
+		query := `SELECT ` + dt.String() + `Data, ` + dt.String() + `Version FROM ` + dt.String() + `_data WHERE ` + dt.String() + `Id = $1`
+		err := db.reader().QueryRow(db.ctx, query, id).Scan(&jsonData, &version)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return ErrDataNotFound
+			}
+			db.l.Error("postgres "+dt.String()+" data read error", dt+"Id", id, "error", err)
+			return err
 		}
-		db.l.Error("postgres "+dt.String()+" data read error", dt+"Id", id, "error", err)
-		return err
+
+		// written by a proxy running an older version
+		jsonData, upgraded, err := upgradeDocument(dt, jsonData, version)
+		if err != nil {
+			db.l.Error("upgrading "+dt.String()+" document error", dt.String()+"Id", id, "version", version, "error", err)
+			return err
+		}
+
+		if upgraded {
+			query := `UPDATE ` + dt.String() + `_data SET ` + dt.String() + `Data = $1::jsonb, ` + dt.String() + `Version = $2 WHERE ` + dt.String() + `Id = $3 AND ` + dt.String() + `Version = $4`
+			_, err := db.p.Exec(db.ctx, query, jsonData, latestDocumentVersion(dt), id, version)
+			if err != nil {
+				db.l.Warn("postgres update upgraded "+dt.String()+" document error", dt.String()+"Id", id, "error", err)
+			}
+		}
+
+		err = json.Unmarshal(jsonData, dest)
+		if err != nil {
+			db.l.Error("json "+dt.String()+" data unmarshal error", dt.String()+"Id", id, "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Gets the data of all ids in one query. Ids without data are not in the returned map.
+func (db *Database) getDatas(dt DataType, ids []uuid.UUID) (map[uuid.UUID][]byte, error) {
+	return guardResult(db, db.hm.bd, func() (map[uuid.UUID][]byte, error) {
+		query := `SELECT ` + dt.String() + `Id, ` + dt.String() + `Data, ` + dt.String() + `Version FROM ` + dt.String() + `_data WHERE ` + dt.String() + `Id = ANY($1)`
+		rows, err := db.reader().Query(db.ctx, query, ids)
+		if err != nil {
+			db.l.Error("postgres "+dt.String()+" datas read error", "error", err)
+			return nil, err
+		}
+		defer rows.Close()
+
+		m := make(map[uuid.UUID][]byte, len(ids))
+		b := &pgx.Batch{}
+		update := `UPDATE ` + dt.String() + `_data SET ` + dt.String() + `Data = $1::jsonb, ` + dt.String() + `Version = $2 WHERE ` + dt.String() + `Id = $3 AND ` + dt.String() + `Version = $4`
+		for rows.Next() {
+			var id uuid.UUID
+			var jsonData []byte
+			var version int
+
+			err := rows.Scan(&id, &jsonData, &version)
+			if err != nil {
+				db.l.Error("postgres scan "+dt.String()+" data error", "error", err)
+				return nil, err
+			}
+
+			// written by a proxy running an older version
+			jsonData, upgraded, err := upgradeDocument(dt, jsonData, version)
+			if err != nil {
+				db.l.Error("upgrading "+dt.String()+" document error", dt.String()+"Id", id, "version", version, "error", err)
+				return nil, err
+			}
+
+			if upgraded {
+				b.Queue(update, jsonData, latestDocumentVersion(dt), id, version)
+			}
+
+			m[id] = jsonData
+		}
+		if rows.Err() != nil {
+			db.l.Error("postgres "+dt.String()+" rows error", "error", rows.Err())
+			return nil, rows.Err()
+		}
+
+		// all upgraded documents are written back in one round trip
+		if b.Len() > 0 {
+			err := db.p.SendBatch(db.ctx, b).Close()
+			if err != nil {
+				db.l.Warn("postgres update upgraded "+dt.String()+" documents error", "error", err)
+			}
+		}
+
+		return m, nil
+	})
+}
+
+func unmarshalDatas[T any](m map[uuid.UUID][]byte) (map[uuid.UUID]*T, error) {
+	datas := make(map[uuid.UUID]*T, len(m))
+	for id, jsonData := range m {
+		var d T
+		err := json.Unmarshal(jsonData, &d)
+		if err != nil {
+			return nil, err
+		}
+
+		datas[id] = &d
 	}
 
-	return nil
+	return datas, nil
+}
+
+func (db *Database) GetPlayerDatas(playerIds []uuid.UUID) (map[uuid.UUID]*data.PlayerData, error) {
+	m, err := db.getDatas(PlayerDataType, playerIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalDatas[data.PlayerData](m)
+}
+
+func (db *Database) GetPartyDatas(partyIds []uuid.UUID) (map[uuid.UUID]*data.PartyData, error) {
+	m, err := db.getDatas(PartyDataType, partyIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalDatas[data.PartyData](m)
+}
+
+func (db *Database) GetProxyDatas(proxyIds []uuid.UUID) (map[uuid.UUID]*data.ProxyData, error) {
+	m, err := db.getDatas(ProxyDataType, proxyIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalDatas[data.ProxyData](m)
+}
+
+func (db *Database) GetBackendDatas(backendIds []uuid.UUID) (map[uuid.UUID]*data.BackendData, error) {
+	m, err := db.getDatas(BackendDataType, backendIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalDatas[data.BackendData](m)
 }
 
 func (db *Database) GetPlayerData(playerId uuid.UUID) (*data.PlayerData, error) {
@@ -202,13 +400,6 @@ func (db *Database) GetPlayerData(playerId uuid.UUID) (*data.PlayerData, error)
 		return nil, err
 	}
 
-	if data.InitializeDefaults() {
-		err := db.SetPlayerData(playerId, &data)
-		if err != nil {
-			db.l.Warn("failed to update player data with defaults", "playerId", playerId, "error", err)
-		}
-	}
-
 	return &data, nil
 }
 
@@ -243,105 +434,176 @@ func (db *Database) GetBackendData(backendId uuid.UUID) (*data.BackendData, erro
 }
 
 func (db *Database) setDataField(dt DataType, id uuid.UUID, key, field string, val any) error {
-	jsonVal, err := json.Marshal(val)
-	if err != nil {
-		db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
-		return err
-	}
+	return db.guardWrite(db.hm.bd, dt.String()+" data "+id.String()+" "+field, func() error {
+		jsonVal, err := json.Marshal(val)
+		if err != nil {
+			db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+			return err
+		}
 
-	go func() {
-		err = db.r.HSet(db.ctx, key, field, jsonVal).Err()
+		go func() {
+			err = db.r.HSet(db.ctx, key, field, jsonVal).Err()
+			if err != nil {
+				db.l.Warn("redis "+dt.String()+" data set error", dt.String()+"Id", id, "field", field, "error", err)
+			} else {
+				err = db.r.HExpire(db.ctx, key, redisTTL, field).Err()
+				if err != nil {
+					db.l.Warn("redis "+dt.String()+" data set expiration error", dt.String()+"Id", id, "field", field, "error", err)
+				}
+			}
+		}()
+
+		path := safeJsonPathForPostgres(field)
+		query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, $2::jsonb, true)WHERE " + dt.String() + "Id = $3"
+		_, err = db.p.Exec(db.ctx, query, path, jsonVal, id)
 		if err != nil {
-			db.l.Warn("redis "+dt.String()+" data set error", dt.String()+"Id", id, "field", field, "error", err)
-		} else {
-			err = db.r.HExpire(db.ctx, key, redisTTL, field).Err()
+			db.l.Error("postgres "+dt.String()+" data update error", dt.String()+"Id", id, "field", field, "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Sets all fields in one Postgres transaction. Either every field is changed or none.
+func (db *Database) setDataFields(dt DataType, id uuid.UUID, key string, fields map[string]any) error {
+	return db.guardWrite(db.hm.bd, dt.String()+" data "+id.String()+" fields", func() error {
+		values := make(map[string][]byte, len(fields))
+		for field, val := range fields {
+			jsonVal, err := json.Marshal(val)
 			if err != nil {
-				db.l.Warn("redis "+dt.String()+" data set expiration error", dt.String()+"Id", id, "field", field, "error", err)
+				db.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+				return err
 			}
+
+			values[field] = jsonVal
 		}
-	}()
 
-	path := safeJsonPathForPostgres(field)
-	query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, $2::jsonb, true)WHERE " + dt.String() + "Id = $3"
-	_, err = db.p.Exec(db.ctx, query, path, jsonVal, id)
-	if err != nil {
-		db.l.Error("postgres "+dt.String()+" data update error", dt.String()+"Id", id, "field", field, "error", err)
-		return err
-	}
+		query := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = jsonb_set(" + dt.String() + "Data, $1, $2::jsonb, true) WHERE " + dt.String() + "Id = $3"
+		err := pgx.BeginFunc(db.ctx, db.p, func(tx pgx.Tx) error {
+			for field, jsonVal := range values {
+				_, err := tx.Exec(db.ctx, query, safeJsonPathForPostgres(field), jsonVal, id)
+				if err != nil {
+					return err
+				}
+			}
 
-	return nil
+			return nil
+		})
+		if err != nil {
+			db.l.Error("postgres "+dt.String()+" data update fields error", dt.String()+"Id", id, "error", err)
+			return err
+		}
+
+		// not in the background, the fields are read again right after
+		_, err = db.r.Pipelined(db.ctx, func(pipe redis.Pipeliner) error {
+			for field, jsonVal := range values {
+				pipe.HSet(db.ctx, key, field, jsonVal)
+				pipe.HExpire(db.ctx, key, redisTTL, field)
+			}
+			return nil
+		})
+		if err != nil {
+			db.l.Warn("redis "+dt.String()+" data set fields error", dt.String()+"Id", id, "error", err)
+		}
+
+		return nil
+	})
+}
+
+func (db *Database) SetPlayerDataFields(playerId uuid.UUID, fields map[key.PlayerKey]any) error {
+	return db.setDataFields(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), stringFields(fields))
+}
+
+func (db *Database) SetPartyDataFields(partyId uuid.UUID, fields map[key.PartyKey]any) error {
+	return db.setDataFields(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), stringFields(fields))
+}
+
+func (db *Database) SetProxyDataFields(proxyId uuid.UUID, fields map[key.ProxyKey]any) error {
+	return db.setDataFields(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), stringFields(fields))
+}
+
+func (db *Database) SetBackendDataFields(backendId uuid.UUID, fields map[key.BackendKey]any) error {
+	return db.setDataFields(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), stringFields(fields))
 }
 
 func (db *Database) SetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, val any) error {
-	return db.setDataField(PlayerDataType, playerId, redisPlayerKeyTranslator(playerId), field.String(), val)
+	return db.setDataField(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), field.String(), val)
 }
 
 func (db *Database) SetPartyDataField(partyId uuid.UUID, field key.PartyKey, val any) error {
-	return db.setDataField(PartyDataType, partyId, redisPartyKeyTranslator(partyId), field.String(), val)
+	return db.setDataField(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), field.String(), val)
 }
 
 func (db *Database) SetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, val any) error {
-	return db.setDataField(ProxyDataType, proxyId, redisProxyKeyTranslator(proxyId), field.String(), val)
+	return db.setDataField(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), field.String(), val)
 }
 
 func (db *Database) SetBackendDataField(backendId uuid.UUID, field key.BackendKey, val any) error {
-	return db.setDataField(BackendDataType, backendId, redisBackendKeyTranslator(backendId), field.String(), val)
+	return db.setDataField(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), field.String(), val)
 }
 
 func (db *Database) getDataField(dt DataType, id uuid.UUID, key, field string, dest any) error {
-	val, err := db.r.HGet(db.ctx, key, field).Result()
-	if err == nil && val != "" {
-		err := json.Unmarshal([]byte(val), dest)
-		if err == nil {
-			return nil
+	return db.guard(db.hm.bd, func() error {
+		val, err := db.r.HGet(db.ctx, key, field).Result()
+		if err == nil && val != "" {
+			err := json.Unmarshal([]byte(val), dest)
+			if err == nil {
+				return nil
+			}
 		}
-	}
 
-	var jsonData []byte
-	query := "SELECT " + dt.String() + "Data #> $1 FROM " + dt.String() + "_data WHERE " + dt.String() + "Id = $2"
-
-	path := safeJsonPathForPostgres(field)
-	err = db.p.QueryRow(db.ctx, query, path, id).Scan(&jsonData)
-	if err != nil {
-		db.l.Error("postgres "+dt.String()+" data read error", dt+"Id", id, "error", err)
-		return err
-	}
+		var jsonData []byte
+		query := "SELECT " + dt.String() + "Data #> $1 FROM " + dt.String() + "_data WHERE " + dt.String() + "Id = $2"
 
-	err = json.Unmarshal(jsonData, dest)
-	if err != nil {
-		db.l.Error("json "+dt.String()+" data unmarshall error", dt+"Id", id, "error", err)
-		return err
-	}
+		path := safeJsonPathForPostgres(field)
+		err = db.reader().QueryRow(db.ctx, query, path, id).Scan(&jsonData)
+		if err != nil {
+			db.l.Error("postgres "+dt.String()+" data read error", dt+"Id", id, "error", err)
+			return err
+		}
 
-	go func() {
-		err = db.r.HSet(db.ctx, key, field, jsonData).Err()
+		err = json.Unmarshal(jsonData, dest)
 		if err != nil {
-			db.l.Warn("redis "+dt.String()+" data set error", dt.String()+"Id", id, "field", field, "error", err)
-		} else {
-			err = db.r.HExpire(db.ctx, key, redisTTL, field).Err()
+			db.l.Error("json "+dt.String()+" data unmarshall error", dt+"Id", id, "error", err)
+			return err
+		}
+
+		// a replica might be behind, so its values are not cached
+		if db.stale {
+			return nil
+		}
+
+		go func() {
+			err = db.r.HSet(db.ctx, key, field, jsonData).Err()
 			if err != nil {
-				db.l.Warn("redis "+dt.String()+" data set expiration error", dt.String()+"Id", id, "field", field, "error", err)
+				db.l.Warn("redis "+dt.String()+" data set error", dt.String()+"Id", id, "field", field, "error", err)
+			} else {
+				err = db.r.HExpire(db.ctx, key, redisTTL, field).Err()
+				if err != nil {
+					db.l.Warn("redis "+dt.String()+" data set expiration error", dt.String()+"Id", id, "field", field, "error", err)
+				}
 			}
-		}
-	}()
+		}()
 
-	return nil
+		return nil
+	})
 }
 
 func (db *Database) GetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, dest any) error {
-	return db.getDataField(PlayerDataType, playerId, redisPlayerKeyTranslator(playerId), field.String(), dest)
+	return db.getDataField(PlayerDataType, playerId, db.redisPlayerKeyTranslator(playerId), field.String(), dest)
 }
 
 func (db *Database) GetPartyDataField(partyId uuid.UUID, field key.PartyKey, dest any) error {
-	return db.getDataField(PartyDataType, partyId, redisPartyKeyTranslator(partyId), field.String(), dest)
+	return db.getDataField(PartyDataType, partyId, db.redisPartyKeyTranslator(partyId), field.String(), dest)
 }
 
 func (db *Database) GetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, dest any) error {
-	return db.getDataField(ProxyDataType, proxyId, redisProxyKeyTranslator(proxyId), field.String(), dest)
+	return db.getDataField(ProxyDataType, proxyId, db.redisProxyKeyTranslator(proxyId), field.String(), dest)
 }
 
 func (db *Database) GetBackendDataField(backendId uuid.UUID, field key.BackendKey, dest any) error {
-	return db.getDataField(BackendDataType, backendId, redisBackendKeyTranslator(backendId), field.String(), dest)
+	return db.getDataField(BackendDataType, backendId, db.redisBackendKeyTranslator(backendId), field.String(), dest)
 }
 
 func (db *Database) DeletePartyData(partyId uuid.UUID) error {
@@ -358,18 +620,64 @@ func (db *Database) DeleteBackendData(backendId uuid.UUID) error {
 }
 
 func (db *Database) deleteData(dt DataType, id uuid.UUID) error {
-	query := "DELETE FROM " + dt.String() + "_data WHERE " + dt.String() + "Id = $1"
-	_, err := db.p.Exec(db.ctx, query, id)
-	if err != nil {
-		if err != pgx.ErrNoRows {
-			return ErrDataNotFound
+	return db.guardWrite(db.hm.bd, dt.String()+" data "+id.String()+" delete", func() error {
+		query := "DELETE FROM " + dt.String() + "_data WHERE " + dt.String() + "Id = $1"
+		_, err := db.p.Exec(db.ctx, query, id)
+		if err != nil {
+			if err != pgx.ErrNoRows {
+				return ErrDataNotFound
+			}
+
+			db.l.Error("postgres delete "+dt.String()+" data error", "error", err)
+			return err
 		}
 
-		db.l.Error("postgres delete "+dt.String()+" data error", "error", err)
-		return err
-	}
+		return nil
+	})
+}
 
-	return nil
+func (db *Database) DeleteProxyDataFenced(proxyId uuid.UUID, lock *Lock) error {
+	return db.deleteDataFenced(ProxyDataType, proxyId, lock)
+}
+
+func (db *Database) DeleteBackendDataFenced(backendId uuid.UUID, lock *Lock) error {
+	return db.deleteDataFenced(BackendDataType, backendId, lock)
+}
+
+// The fencing token is read with a share lock in the same transaction, so the lock can't be taken by someone else before the delete is done.
+func (db *Database) deleteDataFenced(dt DataType, id uuid.UUID, lock *Lock) error {
+	return db.guard(db.hm.bd, func() error {
+		tx, err := db.p.Begin(db.ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(db.ctx)
+
+		var fence int64
+		err = tx.QueryRow(db.ctx, `SELECT fence FROM lock_fences WHERE name = $1 FOR SHARE`, lock.GetName()).Scan(&fence)
+		if err == pgx.ErrNoRows {
+			return ErrLockLost
+		}
+
+		if err != nil {
+			db.l.Error("postgres get lock fence error", "lock", lock.GetName(), "error", err)
+			return err
+		}
+
+		if lock.GetFence() < fence {
+			db.l.Warn("postgres rejected fenced delete, newer fence exists", dt.String()+"Id", id, "lock", lock.GetName(), "fence", lock.GetFence(), "newestFence", fence)
+			return ErrLockLost
+		}
+
+		query := "DELETE FROM " + dt.String() + "_data WHERE " + dt.String() + "Id = $1"
+		_, err = tx.Exec(db.ctx, query, id)
+		if err != nil {
+			db.l.Error("postgres fenced delete "+dt.String()+" data error", "error", err)
+			return err
+		}
+
+		return tx.Commit(db.ctx)
+	})
 }
 
 func (db *Database) GetAllPlayerIds() ([]uuid.UUID, error) {
@@ -389,62 +697,60 @@ func (db *Database) GetAllBackendsIds() ([]uuid.UUID, error) {
 }
 
 func (db *Database) getAllIds(dt DataType) ([]uuid.UUID, error) {
-	query := "SELECT " + dt.String() + "Id FROM " + dt.String() + "_data"
-	rows, err := db.p.Query(db.ctx, query)
-	if err != nil {
-		db.l.Error("postgres get all "+dt.String()+" ids error", "error", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var ids []uuid.UUID
-	for rows.Next() {
-		var id uuid.UUID
-		err := rows.Scan(&id)
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		query := "SELECT " + dt.String() + "Id FROM " + dt.String() + "_data"
+		rows, err := db.reader().Query(db.ctx, query)
 		if err != nil {
-			db.l.Error("postgres scan "+dt.String()+" id error", "error", err)
+			db.l.Error("postgres get all "+dt.String()+" ids error", "error", err)
 			return nil, err
 		}
+		defer rows.Close()
 
-		ids = append(ids, id)
-	}
-	if rows.Err() != nil {
-		db.l.Error("postgres "+dt.String()+" rows error", "error", rows.Err())
-		return nil, rows.Err()
-	}
-
-	return ids, nil
-}
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			err := rows.Scan(&id)
+			if err != nil {
+				db.l.Error("postgres scan "+dt.String()+" id error", "error", err)
+				return nil, err
+			}
 
-func (db *Database) AcquireLock(lockKey string, ttl time.Duration) (bool, error) {
-	return db.r.SetNX(db.ctx, lockKey, "1", ttl).Result()
-}
+			ids = append(ids, id)
+		}
+		if rows.Err() != nil {
+			db.l.Error("postgres "+dt.String()+" rows error", "error", rows.Err())
+			return nil, rows.Err()
+		}
 
-func (db *Database) ReleaseLock(lockKey string) error {
-	return db.r.Del(db.ctx, lockKey).Err()
+		return ids, nil
+	})
 }
 
 func (db *Database) Publish(channel string, message any) error {
-	err := db.r.Publish(db.ctx, channel, message).Err()
-	if err != nil {
-		db.l.Error("redis publish error", "channel", channel, "message", message, "error", err)
-	}
+	return db.guardWrite(db.hm.bm, "publish "+channel, func() error {
+		err := db.r.Publish(db.ctx, db.namespaced(channel), message).Err()
+		if err != nil {
+			db.l.Error("redis publish error", "channel", channel, "message", message, "error", err)
+			return err
+		}
 
-	return nil
+		return nil
+	})
 }
 
 func (db *Database) Subscribe(channel string) *redis.PubSub {
 	db.l.Debug("database redis pubsub subscribing to channel", "channel", channel)
-	return db.r.Subscribe(db.ctx, channel)
+	return db.r.Subscribe(db.ctx, db.namespaced(channel))
 }
 
 func (db *Database) SubscribeWithTimeout(channel string, timeout time.Duration) (*redis.Message, error) {
-	pubsub := db.r.Subscribe(db.ctx, channel)
+	pubsub := db.Subscribe(channel)
 	defer pubsub.Close()
 
 	ch := pubsub.Channel()
 	select {
 	case msg := <-ch:
+		msg.Channel = channel
 		return msg, nil
 	case <-time.After(timeout):
 		return nil, context.DeadlineExceeded
@@ -452,7 +758,12 @@ func (db *Database) SubscribeWithTimeout(channel string, timeout time.Duration)
 }
 
 // Combination of Publish & Subscribe. Publish message in a channel, wait for a return message with a time limit.
-func (db *Database) SendAndReturn(publishChannel, subscribeChannel string, message any, timeout time.Duration) (*redis.Message, error) {
+func (db *Database) SendAndReturn(publishChannel, subscribeChannel string, message any, timeout time.Duration) (*Message, error) {
+	// no answer can arrive while redis is unreachable
+	if db.hm.bm.getState() == BreakerState_Open {
+		return nil, ErrStorageUnavailable
+	}
+
 	pubsub := db.Subscribe(subscribeChannel)
 	defer pubsub.Close()
 
@@ -464,18 +775,18 @@ func (db *Database) SendAndReturn(publishChannel, subscribeChannel string, messa
 	ch := pubsub.Channel()
 	select {
 	case msg := <-ch:
-		return msg, nil
+		return &Message{Channel: subscribeChannel, Payload: msg.Payload}, nil
 	case <-time.After(timeout):
 		return nil, context.DeadlineExceeded
 	}
 }
 
 // Create a listener to listen for incoming calls. Is basically the same as the Subscribe function but it handles it for you. The listener can be stopped by using DeleteListener()
-func (db *Database) CreateListener(channel string, handler func(msg *redis.Message)) {
+func (db *Database) CreateListener(channel string, handler func(msg *Message)) {
 	db.lm.mu.Lock()
 	defer db.lm.mu.Unlock()
 
-	if _, exists := db.lm.m[channel]; exists {
+	if db.listenerExists(channel) {
 		db.l.Warn("database listener already existing", "channel", channel)
 		return
 	}
@@ -491,7 +802,7 @@ func (db *Database) CreateListener(channel string, handler func(msg *redis.Messa
 				return
 			}
 
-			handler(msg)
+			handler(&Message{Channel: channel, Payload: msg.Payload})
 		}
 	}()
 }
@@ -500,6 +811,13 @@ func (db *Database) DeleteListener(channel string) error {
 	db.lm.mu.Lock()
 	defer db.lm.mu.Unlock()
 
+	cancel, exists := db.lm.s[channel]
+	if exists {
+		delete(db.lm.s, channel)
+		cancel()
+		return nil
+	}
+
 	pubsub, exists := db.lm.m[channel]
 	if !exists {
 		return nil
@@ -517,11 +835,12 @@ func (db *Database) DeleteListener(channel string) error {
 
 func (db *Database) DeleteAllListeners() error {
 	db.lm.mu.Lock()
-	listeners := db.lm.m
+	channels := slices.Collect(maps.Keys(db.lm.m))
+	channels = slices.AppendSeq(channels, maps.Keys(db.lm.s))
 	db.lm.mu.Unlock()
 
 	var firstErr error
-	for channel := range listeners {
+	for _, channel := range channels {
 		err := db.DeleteListener(channel)
 		if err != nil && firstErr == nil {
 			firstErr = err
@@ -530,12 +849,20 @@ func (db *Database) DeleteAllListeners() error {
 
 	db.lm.mu.Lock()
 	db.lm.m = make(map[string]*redis.PubSub)
+	db.lm.s = make(map[string]context.CancelFunc)
 	db.lm.mu.Unlock()
 	return firstErr
 }
 
 // Close the database. Closes the connection with Redis and PostgreSQL
 func (db *Database) Close() error {
+	db.stopHealthWatcher()
+
+	// last chance for the queued writes
+	if db.Health().Journal > 0 && !db.replay() {
+		db.l.Warn("database closing with queued writes, they are lost", "journal", db.Health().Journal)
+	}
+
 	err := db.DeleteAllListeners()
 	if err != nil {
 		db.l.Error("database deleting all listeners error", "error", err)
@@ -554,6 +881,9 @@ func (db *Database) Close() error {
 
 	done := make(chan struct{})
 	go func() {
+		for _, p := range db.rp {
+			p.Close()
+		}
 		db.p.Close()
 		close(done)
 	}()
@@ -0,0 +1,475 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// While Redis or Postgres can't be reached, the database runs in degraded mode.
+// Circuit breakers stop calls to the unreachable storage, so they fail fast instead of waiting for timeouts.
+// Writes are queued in a local journal of their breaker and replayed in order when the storage is reachable again.
+// Every breaker has its own journal, so writes of a reachable storage are not held back by an unreachable one.
+// Reads fail with ErrStorageUnavailable, so already loaded data keeps being used.
+
+var (
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	ErrJournalFull        = errors.New("write journal full")
+	// The write has been queued and will be done when the storage is reachable again. The result is not known yet.
+	ErrWriteQueued = errors.New("write queued")
+)
+
+type Health string
+
+const (
+	// Everything is reachable and no writes are waiting.
+	Health_Healthy Health = "healthy"
+	// Redis or Postgres can't be reached or queued writes are still waiting to be replayed.
+	Health_Degraded Health = "degraded"
+)
+
+type BreakerState string
+
+const (
+	// Calls are passed through.
+	BreakerState_Closed BreakerState = "closed"
+	// Calls fail immediately.
+	BreakerState_Open BreakerState = "open"
+	// One call is passed through to test if the storage is reachable again.
+	BreakerState_HalfOpen BreakerState = "half-open"
+)
+
+type HealthInfo struct {
+	Health Health
+	// breaker of data reads and writes
+	Data BreakerState
+	// breaker of messages and locks
+	Messaging BreakerState
+	// amount of writes waiting to be replayed
+	Journal int
+}
+
+// Returns if the error is caused by a storage that can't be reached, instead of by the request itself.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrStorageUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrPoolTimeout) ||
+		errors.Is(err, redis.ErrClosed) {
+		return true
+	}
+
+	var ne net.Error
+	var ce *pgconn.ConnectError
+	return errors.As(err, &ne) || errors.As(err, &ce) || pgconn.Timeout(err)
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	mu       sync.Mutex
+
+	// failures in a row before the breaker opens
+	threshold int
+	// time the breaker stays open before a call is tried again
+	cooldown time.Duration
+
+	// called without holding the lock when the breaker opens or closes again, can be nil
+	changed func(state BreakerState)
+
+	// the writes through this breaker that are waiting for the storage
+	j *journal
+}
+
+func newBreaker(threshold int, cooldown time.Duration, j *journal) *breaker {
+	return &breaker{
+		state:     BreakerState_Closed,
+		threshold: threshold,
+		cooldown:  cooldown,
+		j:         j,
+	}
+}
+
+// Returns if a call may be made. After the cooldown, a single call is allowed to test the storage.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerState_Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+
+		b.state = BreakerState_HalfOpen
+		return true
+	case BreakerState_HalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// Records the result of an allowed call.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	old := b.state
+
+	if !isUnavailable(err) {
+		b.failures = 0
+		b.state = BreakerState_Closed
+	} else {
+		b.failures++
+		if b.state == BreakerState_HalfOpen || b.failures >= b.threshold {
+			b.state = BreakerState_Open
+			b.openedAt = time.Now()
+		}
+	}
+
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(old, state)
+}
+
+func (b *breaker) reset() {
+	b.mu.Lock()
+	old := b.state
+	b.failures = 0
+	b.state = BreakerState_Closed
+	b.mu.Unlock()
+
+	b.notify(old, BreakerState_Closed)
+}
+
+// Calls changed when the breaker opened, or closed after being open.
+func (b *breaker) notify(old, state BreakerState) {
+	if b.changed == nil || old == state {
+		return
+	}
+
+	if state == BreakerState_Open || (state == BreakerState_Closed && old != BreakerState_Closed) {
+		b.changed(state)
+	}
+}
+
+func (b *breaker) getState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// handles the breakers and the journal, shared by all copies of the database
+type healthManager struct {
+	// breaker of data reads and writes
+	bd *breaker
+	// breaker of messages and locks
+	bm *breaker
+
+	// called after recovering
+	rf []func()
+	mu sync.Mutex
+
+	// set when a breaker opens or a write is queued, cleared when the recover functions have been called
+	outage atomic.Bool
+	// only one recovery runs at a time, otherwise queued writes could be replayed twice
+	rm sync.Mutex
+
+	t *time.Ticker
+	d chan bool
+}
+
+type journalEntry struct {
+	name string
+	f    func() error
+	at   time.Time
+}
+
+// Writes that are waiting for the storage, oldest first.
+type journal struct {
+	l       *list.List
+	maxSize int
+	mu      sync.Mutex
+}
+
+func newJournal(maxSize int) *journal {
+	return &journal{
+		l:       list.New(),
+		maxSize: maxSize,
+	}
+}
+
+func (j *journal) add(name string, f func() error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.l.Len() >= j.maxSize {
+		return ErrJournalFull
+	}
+
+	j.l.PushBack(&journalEntry{name: name, f: f, at: time.Now()})
+	return nil
+}
+
+func (j *journal) front() *journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e := j.l.Front()
+	if e == nil {
+		return nil
+	}
+
+	return e.Value.(*journalEntry)
+}
+
+func (j *journal) pop() {
+	j.mu.Lock()
+	e := j.l.Front()
+	if e != nil {
+		j.l.Remove(e)
+	}
+	j.mu.Unlock()
+}
+
+func (j *journal) len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.l.Len()
+}
+
+// Runs a call through the breaker. Errors of an unreachable storage are returned as ErrStorageUnavailable.
+func (db *Database) guard(b *breaker, f func() error) error {
+	if !b.allow() {
+		return ErrStorageUnavailable
+	}
+
+	err := f()
+	b.record(err)
+	if isUnavailable(err) && !errors.Is(err, ErrStorageUnavailable) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+
+	return err
+}
+
+func guardResult[T any](db *Database, b *breaker, f func() (T, error)) (T, error) {
+	var res T
+	err := db.guard(b, func() error {
+		var err error
+		res, err = f()
+		return err
+	})
+
+	return res, err
+}
+
+// The player lists of proxies and backends are changed while logging in, so these changes are queued.
+// Returns ErrWriteQueued when queued, the caller has to change its own list.
+func (db *Database) queuedListWrite(name string, f func() ([]uuid.UUID, error)) ([]uuid.UUID, error) {
+	var l []uuid.UUID
+	err := db.guardQueuedWrite(db.hm.bd, name, func() error {
+		var err error
+		l, err = f()
+		return err
+	})
+
+	return l, err
+}
+
+// Runs a write through the breaker. When the storage can't be reached, the write is queued and nil is returned.
+func (db *Database) guardWrite(b *breaker, name string, f func() error) error {
+	_, err := db.write(b, name, f)
+	return err
+}
+
+// Like guardWrite, but for writes of which the caller needs the result. ErrWriteQueued is returned when the write is queued.
+func (db *Database) guardQueuedWrite(b *breaker, name string, f func() error) error {
+	queued, err := db.write(b, name, f)
+	if err != nil {
+		return err
+	}
+
+	if queued {
+		return ErrWriteQueued
+	}
+
+	return nil
+}
+
+// Writes are also queued while older writes of the same breaker are waiting, so they are done in order.
+// Returns if the write has been queued.
+func (db *Database) write(b *breaker, name string, f func() error) (bool, error) {
+	if b.j.len() == 0 {
+		err := db.guard(b, f)
+		if !errors.Is(err, ErrStorageUnavailable) {
+			return false, err
+		}
+	}
+
+	err := b.j.add(name, f)
+	if err != nil {
+		db.l.Error("database journal full, write lost", "write", name, "size", b.j.maxSize)
+		return false, err
+	}
+
+	db.hm.outage.Store(true)
+	db.l.Debug("database write queued", "write", name)
+	return true, nil
+}
+
+func (db *Database) Health() HealthInfo {
+	h := HealthInfo{
+		Health:    Health_Healthy,
+		Data:      db.hm.bd.getState(),
+		Messaging: db.hm.bm.getState(),
+		Journal:   db.hm.bd.j.len() + db.hm.bm.j.len(),
+	}
+
+	if h.Data != BreakerState_Closed || h.Messaging != BreakerState_Closed || h.Journal > 0 {
+		h.Health = Health_Degraded
+	}
+
+	return h
+}
+
+// Registers a function that is called when the storage is reachable again and all queued writes are replayed.
+// Messages sent while the storage was unreachable are lost, so the function should read the data again.
+func (db *Database) OnRecover(f func()) {
+	db.hm.mu.Lock()
+	db.hm.rf = append(db.hm.rf, f)
+	db.hm.mu.Unlock()
+}
+
+// Recovers as soon as a breaker closes again, also when a normal call closed it. While in degraded mode,
+// checks every second if the storage is reachable again.
+func (db *Database) startHealthWatcher() {
+	db.hm.t = time.NewTicker(time.Second)
+	db.hm.d = make(chan bool)
+	db.hm.bd.changed = db.onBreakerChanged
+	db.hm.bm.changed = db.onBreakerChanged
+
+	go func() {
+		for {
+			select {
+			case <-db.hm.d:
+				return
+			case <-db.hm.t.C:
+				if db.Health().Health == Health_Healthy && !db.hm.outage.Load() {
+					continue
+				}
+
+				db.recover()
+			}
+		}
+	}()
+}
+
+func (db *Database) onBreakerChanged(state BreakerState) {
+	switch state {
+	case BreakerState_Open:
+		db.hm.outage.Store(true)
+		db.l.Warn("database breaker opened, running in degraded mode")
+	case BreakerState_Closed:
+		go db.recover()
+	}
+}
+
+func (db *Database) stopHealthWatcher() {
+	db.hm.t.Stop()
+	db.hm.d <- true
+}
+
+// Pings the storages the breaker guards. Data is kept in Postgres and cached in Redis, messages only use Redis.
+func (db *Database) ping(b *breaker) error {
+	ctx, cancel := context.WithTimeout(db.ctx, 2*time.Second)
+	defer cancel()
+
+	err := db.r.Ping(ctx).Err()
+	if err != nil || b == db.hm.bm {
+		return err
+	}
+
+	return db.p.Ping(ctx)
+}
+
+// Replays the queued writes and calls the recover functions when the storage can be reached again.
+// The recover functions are called once per outage.
+func (db *Database) recover() {
+	if !db.hm.rm.TryLock() {
+		return
+	}
+	defer db.hm.rm.Unlock()
+
+	if !db.replay() {
+		return
+	}
+
+	if !db.hm.outage.CompareAndSwap(true, false) {
+		return
+	}
+
+	db.hm.mu.Lock()
+	l := append([]func(){}, db.hm.rf...)
+	db.hm.mu.Unlock()
+
+	for _, f := range l {
+		f()
+	}
+}
+
+// Replays the queued writes of both breakers. Returns if all writes have been replayed.
+func (db *Database) replay() bool {
+	// both are tried, the journal of one breaker doesn't wait for the other
+	data := db.replayJournal(db.hm.bd, "data")
+	messaging := db.replayJournal(db.hm.bm, "messaging")
+	return data && messaging
+}
+
+// Replays the queued writes of the breaker when its storage can be reached. Stops when the storage is gone again.
+// Returns if all writes have been replayed.
+func (db *Database) replayJournal(b *breaker, name string) bool {
+	err := db.ping(b)
+	if err != nil {
+		db.l.Debug("database still unavailable", "breaker", name, "journal", b.j.len(), "error", err)
+		return false
+	}
+
+	b.reset()
+
+	now := time.Now()
+	replayed := 0
+	for e := b.j.front(); e != nil; e = b.j.front() {
+		err := e.f()
+		if isUnavailable(err) {
+			db.l.Warn("database unavailable again while replaying journal", "breaker", name, "replayed", replayed, "left", b.j.len(), "error", err)
+			return false
+		}
+
+		if err != nil {
+			db.l.Error("database journal replay error, write dropped", "breaker", name, "write", e.name, "queuedAt", e.at, "error", err)
+		}
+
+		b.j.pop()
+		replayed++
+	}
+
+	db.l.Info("database available again", "breaker", name, "replayed", replayed, "duration", time.Since(now))
+	return true
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerChanged(t *testing.T) {
+	var changes []BreakerState
+	b := newBreaker(2, 10*time.Millisecond, newJournal(1))
+	b.changed = func(state BreakerState) {
+		changes = append(changes, state)
+	}
+
+	b.record(ErrStorageUnavailable)
+	if b.getState() != BreakerState_Closed || len(changes) != 0 {
+		t.Fatalf("opened before the threshold: %v %v", b.getState(), changes)
+	}
+
+	b.record(ErrStorageUnavailable)
+	if b.getState() != BreakerState_Open || len(changes) != 1 || changes[0] != BreakerState_Open {
+		t.Fatalf("not opened at the threshold: %v %v", b.getState(), changes)
+	}
+
+	if b.allow() {
+		t.Fatal("call allowed while open")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// the half open probe of a normal call closes the breaker
+	if !b.allow() {
+		t.Fatal("probe not allowed after the cooldown")
+	}
+
+	b.record(nil)
+	if b.getState() != BreakerState_Closed || len(changes) != 2 || changes[1] != BreakerState_Closed {
+		t.Fatalf("not closed after the probe: %v %v", b.getState(), changes)
+	}
+
+	// closing a closed breaker is not a change
+	b.record(nil)
+	b.reset()
+	if len(changes) != 2 {
+		t.Fatalf("changed while already closed: %v", changes)
+	}
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// A lock can only be held by one owner at a time. The owner is recognized by a random token,
+// so a lock that expired and got taken by someone else can't be released or renewed by the old owner.
+// The lease is renewed in the background while the lock is held.
+// Every time a lock is taken, its fencing token increases. Operations protected by the lock receive the lock and the storage
+// rejects them when a newer fencing token exists, so an owner that lost the lock without noticing (for example after a long pause)
+// can't do them anymore. The database keeps the fencing tokens in Postgres, next to the data they protect.
+
+var (
+	ErrLockHeld = errors.New("lock held by another owner")
+	ErrLockLost = errors.New("lock lost")
+)
+
+// what the storage needs to do for a lock after it has been taken
+type lockStore interface {
+	renewLock(name, token string, ttl time.Duration) (bool, error)
+	releaseLock(name, token string) error
+	// returns if the lock is still held by the token and no newer fencing token exists
+	checkLock(name, token string, fence int64) (bool, error)
+}
+
+type Lock struct {
+	name  string
+	token string
+	fence int64
+	ttl   time.Duration
+
+	s lockStore
+	l *logger.Logger
+
+	// cancelled when the lock is lost or released
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newLock(s lockStore, l *logger.Logger, name, token string, fence int64, ttl time.Duration) *Lock {
+	ctx, cancel := context.WithCancel(context.Background())
+	lock := &Lock{
+		name:   name,
+		token:  token,
+		fence:  fence,
+		ttl:    ttl,
+		s:      s,
+		l:      l,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go lock.renew()
+	return lock
+}
+
+func newLockToken() string {
+	return uuid.New().String()
+}
+
+func (l *Lock) GetName() string {
+	return l.name
+}
+
+// Increases every time the lock is taken. Pass it to the operations that are protected by the lock.
+func (l *Lock) GetFence() int64 {
+	return l.fence
+}
+
+// Done when the lock is lost or released.
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Returns ErrLockLost if the lock is not held anymore or has been taken by someone else in the meantime.
+// Call before every protected operation.
+func (l *Lock) Check() error {
+	if l.ctx.Err() != nil {
+		return ErrLockLost
+	}
+
+	ok, err := l.s.checkLock(l.name, l.token, l.fence)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		l.cancel()
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+// Releases the lock if it is still held. Stops the renewal.
+func (l *Lock) Release() error {
+	if l.ctx.Err() != nil {
+		return nil
+	}
+
+	l.cancel()
+	return l.s.releaseLock(l.name, l.token)
+}
+
+// Renews the lease three times per ttl. The lock is lost when it can't be renewed before it expires.
+func (l *Lock) renew() {
+	t := time.NewTicker(l.ttl / 3)
+	defer t.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-t.C:
+			ok, err := l.s.renewLock(l.name, l.token, l.ttl)
+			if err != nil {
+				l.l.Warn("lock renew error", "lock", l.name, "error", err)
+				if time.Since(renewed) < l.ttl {
+					continue
+				}
+			}
+
+			if !ok {
+				l.l.Warn("lock lost", "lock", l.name, "fence", l.fence)
+				l.cancel()
+				return
+			}
+
+			renewed = time.Now()
+		}
+	}
+}
+
+// Tries to become the leader until ctx is done. While this proxy is the leader, run is called with the lock.
+// run should return when the context of the lock is done. The leadership is given up when run returns.
+func Lead(ctx context.Context, s Storage, name string, ttl time.Duration, run func(lock *Lock)) {
+	for {
+		lock, err := s.TryLock(name, ttl)
+		if err == nil {
+			run(lock)
+			lock.Release()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ttl / 3):
+		}
+	}
+}
+
+// Both keys share the hash tag, so the scripts also work in a cluster.
+func (db *Database) redisLockKeys(name string) []string {
+	k := db.namespaced("lock:{" + name + "}")
+	return []string{k, k + ":fence"}
+}
+
+var acquireLockScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+var setFenceScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+var checkLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] and redis.call("GET", KEYS[2]) == ARGV[2] then
+	return 1
+end
+return 0
+`)
+
+// Takes the lock if no one else holds it. Returns ErrLockHeld if it is held.
+// The fencing token is increased in Postgres, so it keeps increasing when redis loses its keys.
+func (db *Database) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	token := newLockToken()
+	keys := db.redisLockKeys(name)
+	ok, err := guardResult(db, db.hm.bm, func() (bool, error) {
+		return acquireLockScript.Run(db.ctx, db.r, keys, token, ttl.Milliseconds()).Bool()
+	})
+	if err != nil {
+		db.l.Error("redis acquire lock error", "lock", name, "error", err)
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	fence, err := db.nextFence(name)
+	if err != nil {
+		db.releaseLock(name, token)
+		return nil, err
+	}
+
+	// the fencing token in redis is used to check the lock without asking postgres
+	ok, err = guardResult(db, db.hm.bm, func() (bool, error) {
+		return setFenceScript.Run(db.ctx, db.r, keys, token, strconv.FormatInt(fence, 10)).Bool()
+	})
+	if err != nil || !ok {
+		db.l.Warn("redis set lock fence error", "lock", name, "fence", fence, "error", err)
+		db.releaseLock(name, token)
+		return nil, ErrLockLost
+	}
+
+	return newLock(db, db.l, name, token, fence, ttl), nil
+}
+
+func (db *Database) nextFence(name string) (int64, error) {
+	return guardResult(db, db.hm.bd, func() (int64, error) {
+		query := `INSERT INTO lock_fences (name, fence) VALUES ($1, 1) ON CONFLICT (name) DO UPDATE SET fence = lock_fences.fence + 1 RETURNING fence`
+
+		var fence int64
+		err := db.p.QueryRow(db.ctx, query, name).Scan(&fence)
+		if err != nil {
+			db.l.Error("postgres increase lock fence error", "lock", name, "error", err)
+			return 0, err
+		}
+
+		return fence, nil
+	})
+}
+
+func (db *Database) renewLock(name, token string, ttl time.Duration) (bool, error) {
+	return guardResult(db, db.hm.bm, func() (bool, error) {
+		return renewLockScript.Run(db.ctx, db.r, db.redisLockKeys(name), token, ttl.Milliseconds()).Bool()
+	})
+}
+
+func (db *Database) releaseLock(name, token string) error {
+	return db.guard(db.hm.bm, func() error {
+		return releaseLockScript.Run(db.ctx, db.r, db.redisLockKeys(name), token).Err()
+	})
+}
+
+func (db *Database) checkLock(name, token string, fence int64) (bool, error) {
+	return guardResult(db, db.hm.bm, func() (bool, error) {
+		return checkLockScript.Run(db.ctx, db.r, db.redisLockKeys(name), token, strconv.FormatInt(fence, 10)).Bool()
+	})
+}
@@ -0,0 +1,1030 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Memory is a Storage that keeps everything inside this process. Values are stored as json, just like the Database does, so both behave the same.
+// Data is lost on close and nothing is shared with other proxies.
+type Memory struct {
+	data  map[string][]byte
+	docs  map[DataType]map[uuid.UUID][]byte
+	locks map[string]*memoryLock
+	// last fencing token per lock, kept after the lock is released
+	fences map[string]int64
+	// expiration of the alive keys
+	alive map[string]time.Time
+	// expiration of the presence of online players
+	presence map[uuid.UUID]time.Time
+	mu       sync.RWMutex
+
+	l  *logger.Logger
+	lm *memoryListenManager
+}
+
+type memoryLock struct {
+	token string
+	exp   time.Time
+}
+
+func InitMemory(l *logger.Logger) *Memory {
+	now := time.Now()
+
+	m := &Memory{
+		data: make(map[string][]byte),
+		docs: map[DataType]map[uuid.UUID][]byte{
+			PlayerDataType:  make(map[uuid.UUID][]byte),
+			PartyDataType:   make(map[uuid.UUID][]byte),
+			ProxyDataType:   make(map[uuid.UUID][]byte),
+			BackendDataType: make(map[uuid.UUID][]byte),
+		},
+		locks:    make(map[string]*memoryLock),
+		fences:   make(map[string]int64),
+		alive:    make(map[string]time.Time),
+		presence: make(map[uuid.UUID]time.Time),
+		l:        l,
+		lm: &memoryListenManager{
+			s: make(map[string]map[chan *Message]struct{}),
+			m: make(map[string]chan *Message),
+		},
+	}
+
+	m.l.Info("initialized memory storage", "duration", time.Since(now))
+	return m
+}
+
+// handles all the subscribers of the in memory pub/sub
+type memoryListenManager struct {
+	// every subscriber per channel, including listeners
+	s map[string]map[chan *Message]struct{}
+	// listeners per channel
+	m  map[string]chan *Message
+	mu sync.Mutex
+}
+
+// same buffer size as a redis pubsub channel
+const memoryChannelSize = 100
+
+func (m *Memory) GetData(key string, dest any) error {
+	m.mu.RLock()
+	val, ok := m.data[key]
+	m.mu.RUnlock()
+
+	if !ok {
+		return ErrDataNotFound
+	}
+
+	err := json.Unmarshal(val, dest)
+	if err != nil {
+		m.l.Error("json data unmarshal error", "key", key, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *Memory) SetData(key string, val any) error {
+	jsonVal, err := json.Marshal(val)
+	if err != nil {
+		m.l.Error("json data marshal error", "key", key, "error", err)
+		return err
+	}
+
+	m.mu.Lock()
+	m.data[key] = jsonVal
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) setData(dt DataType, id uuid.UUID, data any) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	m.mu.Lock()
+	m.docs[dt][id] = jsonData
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) SetPlayerData(playerId uuid.UUID, data *data.PlayerData) error {
+	return m.setData(PlayerDataType, playerId, data)
+}
+
+func (m *Memory) SetPartyData(partyId uuid.UUID, data *data.PartyData) error {
+	return m.setData(PartyDataType, partyId, data)
+}
+
+func (m *Memory) SetProxyData(proxyId uuid.UUID, data *data.ProxyData) error {
+	return m.setData(ProxyDataType, proxyId, data)
+}
+
+func (m *Memory) SetBackendData(backendId uuid.UUID, data *data.BackendData) error {
+	return m.setData(BackendDataType, backendId, data)
+}
+
+func (m *Memory) getData(dt DataType, id uuid.UUID, dest any) error {
+	m.mu.RLock()
+	jsonData, ok := m.docs[dt][id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return ErrDataNotFound
+	}
+
+	err := json.Unmarshal(jsonData, dest)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data unmarshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *Memory) getDatas(dt DataType, ids []uuid.UUID) map[uuid.UUID][]byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	datas := make(map[uuid.UUID][]byte, len(ids))
+	for _, id := range ids {
+		jsonData, ok := m.docs[dt][id]
+		if ok {
+			datas[id] = jsonData
+		}
+	}
+
+	return datas
+}
+
+func (m *Memory) GetPlayerDatas(playerIds []uuid.UUID) (map[uuid.UUID]*data.PlayerData, error) {
+	return unmarshalDatas[data.PlayerData](m.getDatas(PlayerDataType, playerIds))
+}
+
+func (m *Memory) GetPartyDatas(partyIds []uuid.UUID) (map[uuid.UUID]*data.PartyData, error) {
+	return unmarshalDatas[data.PartyData](m.getDatas(PartyDataType, partyIds))
+}
+
+func (m *Memory) GetProxyDatas(proxyIds []uuid.UUID) (map[uuid.UUID]*data.ProxyData, error) {
+	return unmarshalDatas[data.ProxyData](m.getDatas(ProxyDataType, proxyIds))
+}
+
+func (m *Memory) GetBackendDatas(backendIds []uuid.UUID) (map[uuid.UUID]*data.BackendData, error) {
+	return unmarshalDatas[data.BackendData](m.getDatas(BackendDataType, backendIds))
+}
+
+func (m *Memory) GetPlayerData(playerId uuid.UUID) (*data.PlayerData, error) {
+	var data data.PlayerData
+	err := m.getData(PlayerDataType, playerId, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (m *Memory) GetPartyData(partyId uuid.UUID) (*data.PartyData, error) {
+	var data data.PartyData
+	err := m.getData(PartyDataType, partyId, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (m *Memory) GetProxyData(proxyId uuid.UUID) (*data.ProxyData, error) {
+	var data data.ProxyData
+	err := m.getData(ProxyDataType, proxyId, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func (m *Memory) GetBackendData(backendId uuid.UUID) (*data.BackendData, error) {
+	var data data.BackendData
+	err := m.getData(BackendDataType, backendId, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// Works like jsonb_set in Postgres: missing parents are not created and an unknown id is ignored.
+func (m *Memory) setDataField(dt DataType, id uuid.UUID, field string, val any) error {
+	return m.setDataFields(dt, id, map[string]any{field: val})
+}
+
+// Sets all fields at once while holding the lock, so no one sees only a part of the changes.
+func (m *Memory) setDataFields(dt DataType, id uuid.UUID, fields map[string]any) error {
+	values := make(map[string]any, len(fields))
+	for field, val := range fields {
+		jsonVal, err := json.Marshal(val)
+		if err != nil {
+			m.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "field", field, "error", err)
+			return err
+		}
+
+		var v any
+		err = json.Unmarshal(jsonVal, &v)
+		if err != nil {
+			return err
+		}
+
+		values[field] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jsonData, ok := m.docs[dt][id]
+	if !ok {
+		return nil
+	}
+
+	var doc map[string]any
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data unmarshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	for field, v := range values {
+		parts := strings.Split(field, ".")
+		parent := doc
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := parent[part].(map[string]any)
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = next
+		}
+
+		if parent != nil {
+			parent[parts[len(parts)-1]] = v
+		}
+	}
+
+	jsonData, err = json.Marshal(doc)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	m.docs[dt][id] = jsonData
+	return nil
+}
+
+func (m *Memory) SetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, val any) error {
+	return m.setDataField(PlayerDataType, playerId, field.String(), val)
+}
+
+func (m *Memory) SetPartyDataField(partyId uuid.UUID, field key.PartyKey, val any) error {
+	return m.setDataField(PartyDataType, partyId, field.String(), val)
+}
+
+func (m *Memory) SetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, val any) error {
+	return m.setDataField(ProxyDataType, proxyId, field.String(), val)
+}
+
+func (m *Memory) SetBackendDataField(backendId uuid.UUID, field key.BackendKey, val any) error {
+	return m.setDataField(BackendDataType, backendId, field.String(), val)
+}
+
+func (m *Memory) SetPlayerDataFields(playerId uuid.UUID, fields map[key.PlayerKey]any) error {
+	return m.setDataFields(PlayerDataType, playerId, stringFields(fields))
+}
+
+func (m *Memory) SetPartyDataFields(partyId uuid.UUID, fields map[key.PartyKey]any) error {
+	return m.setDataFields(PartyDataType, partyId, stringFields(fields))
+}
+
+func (m *Memory) SetProxyDataFields(proxyId uuid.UUID, fields map[key.ProxyKey]any) error {
+	return m.setDataFields(ProxyDataType, proxyId, stringFields(fields))
+}
+
+func (m *Memory) SetBackendDataFields(backendId uuid.UUID, fields map[key.BackendKey]any) error {
+	return m.setDataFields(BackendDataType, backendId, stringFields(fields))
+}
+
+func (m *Memory) getDataField(dt DataType, id uuid.UUID, field string, dest any) error {
+	m.mu.RLock()
+	jsonData, ok := m.docs[dt][id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return ErrDataNotFound
+	}
+
+	var doc any
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data unmarshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	for _, part := range strings.Split(field, ".") {
+		parent, ok := doc.(map[string]any)
+		if !ok {
+			return ErrDataFieldNotFound
+		}
+
+		doc, ok = parent[part]
+		if !ok {
+			return ErrDataFieldNotFound
+		}
+	}
+
+	jsonVal, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(jsonVal, dest)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data unmarshall error", dt.String()+"Id", id, "field", field, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *Memory) GetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, dest any) error {
+	return m.getDataField(PlayerDataType, playerId, field.String(), dest)
+}
+
+func (m *Memory) GetPartyDataField(partyId uuid.UUID, field key.PartyKey, dest any) error {
+	return m.getDataField(PartyDataType, partyId, field.String(), dest)
+}
+
+func (m *Memory) GetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, dest any) error {
+	return m.getDataField(ProxyDataType, proxyId, field.String(), dest)
+}
+
+func (m *Memory) GetBackendDataField(backendId uuid.UUID, field key.BackendKey, dest any) error {
+	return m.getDataField(BackendDataType, backendId, field.String(), dest)
+}
+
+// Changes a single field while holding the lock, so the change is atomic.
+// The function receives the current value (nil if missing) and returns the new value, or nil to leave it unchanged.
+func (m *Memory) updateDataField(dt DataType, id uuid.UUID, field string, fn func(cur any) (any, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jsonData, ok := m.docs[dt][id]
+	if !ok {
+		return ErrDataNotFound
+	}
+
+	var doc map[string]any
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data unmarshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	parts := strings.Split(field, ".")
+	parent := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := parent[part].(map[string]any)
+		if !ok {
+			return ErrDataFieldNotFound
+		}
+		parent = next
+	}
+
+	last := parts[len(parts)-1]
+	v, err := fn(parent[last])
+	if err != nil || v == nil {
+		return err
+	}
+	parent[last] = v
+
+	jsonData, err = json.Marshal(doc)
+	if err != nil {
+		m.l.Error("json "+dt.String()+" data marshal error", dt.String()+"Id", id, "error", err)
+		return err
+	}
+
+	m.docs[dt][id] = jsonData
+	return nil
+}
+
+// Converts a value into the form it has after being stored as json.
+func memoryJsonValue(val any) (any, error) {
+	jsonVal, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	err = json.Unmarshal(jsonVal, &v)
+	return v, err
+}
+
+func memoryList(cur any) []any {
+	l, ok := cur.([]any)
+	if !ok {
+		return []any{}
+	}
+
+	return l
+}
+
+func memoryUUIDList(l []any) ([]uuid.UUID, error) {
+	jsonVal, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	err = json.Unmarshal(jsonVal, &ids)
+	return ids, err
+}
+
+func (m *Memory) addToDataList(dt DataType, id uuid.UUID, field string, val uuid.UUID) ([]uuid.UUID, error) {
+	v, err := memoryJsonValue(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []any
+	err = m.updateDataField(dt, id, field, func(cur any) (any, error) {
+		result = memoryList(cur)
+		if !slices.Contains(result, v) {
+			result = append(result, v)
+		}
+
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return memoryUUIDList(result)
+}
+
+func (m *Memory) removeFromDataList(dt DataType, id uuid.UUID, field string, val uuid.UUID) ([]uuid.UUID, error) {
+	v, err := memoryJsonValue(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []any
+	err = m.updateDataField(dt, id, field, func(cur any) (any, error) {
+		result = memoryList(cur)
+		i := slices.Index(result, v)
+		if i == -1 {
+			return nil, ErrListValueNotFound
+		}
+
+		result = slices.Delete(result, i, i+1)
+		return result, nil
+	})
+	if err == ErrDataNotFound || err == ErrDataFieldNotFound {
+		return nil, ErrListValueNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memoryUUIDList(result)
+}
+
+func (m *Memory) compareAndSetDataField(dt DataType, id uuid.UUID, field string, expected, val any) (bool, error) {
+	jsonExpected, err := json.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+
+	v, err := memoryJsonValue(val)
+	if err != nil {
+		return false, err
+	}
+
+	set := false
+	err = m.updateDataField(dt, id, field, func(cur any) (any, error) {
+		if cur == nil {
+			return nil, nil
+		}
+
+		jsonCur, err := json.Marshal(cur)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(jsonCur, jsonExpected) {
+			return nil, nil
+		}
+
+		set = true
+		return v, nil
+	})
+	if err == ErrDataNotFound || err == ErrDataFieldNotFound {
+		return false, nil
+	}
+
+	return set, err
+}
+
+func (m *Memory) AddToPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.addToDataList(PlayerDataType, playerId, field.String(), val)
+}
+
+func (m *Memory) AddToPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.addToDataList(PartyDataType, partyId, field.String(), val)
+}
+
+func (m *Memory) AddToProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.addToDataList(ProxyDataType, proxyId, field.String(), val)
+}
+
+func (m *Memory) AddToBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.addToDataList(BackendDataType, backendId, field.String(), val)
+}
+
+func (m *Memory) RemoveFromPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.removeFromDataList(PlayerDataType, playerId, field.String(), val)
+}
+
+func (m *Memory) RemoveFromPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.removeFromDataList(PartyDataType, partyId, field.String(), val)
+}
+
+func (m *Memory) RemoveFromProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.removeFromDataList(ProxyDataType, proxyId, field.String(), val)
+}
+
+func (m *Memory) RemoveFromBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error) {
+	return m.removeFromDataList(BackendDataType, backendId, field.String(), val)
+}
+
+func (m *Memory) CompareAndSetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, expected, val any) (bool, error) {
+	return m.compareAndSetDataField(PlayerDataType, playerId, field.String(), expected, val)
+}
+
+func (m *Memory) CompareAndSetPartyDataField(partyId uuid.UUID, field key.PartyKey, expected, val any) (bool, error) {
+	return m.compareAndSetDataField(PartyDataType, partyId, field.String(), expected, val)
+}
+
+func (m *Memory) CompareAndSetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, expected, val any) (bool, error) {
+	return m.compareAndSetDataField(ProxyDataType, proxyId, field.String(), expected, val)
+}
+
+func (m *Memory) CompareAndSetBackendDataField(backendId uuid.UUID, field key.BackendKey, expected, val any) (bool, error) {
+	return m.compareAndSetDataField(BackendDataType, backendId, field.String(), expected, val)
+}
+
+func (m *Memory) DeletePartyData(partyId uuid.UUID) error {
+	return m.deleteData(PartyDataType, partyId)
+}
+
+func (m *Memory) DeleteProxyData(proxyId uuid.UUID) error {
+	return m.deleteData(ProxyDataType, proxyId)
+}
+
+func (m *Memory) DeleteBackendData(backendId uuid.UUID) error {
+	return m.deleteData(BackendDataType, backendId)
+}
+
+func (m *Memory) deleteData(dt DataType, id uuid.UUID) error {
+	m.mu.Lock()
+	delete(m.docs[dt], id)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) DeleteProxyDataFenced(proxyId uuid.UUID, lock *Lock) error {
+	return m.deleteDataFenced(ProxyDataType, proxyId, lock)
+}
+
+func (m *Memory) DeleteBackendDataFenced(backendId uuid.UUID, lock *Lock) error {
+	return m.deleteDataFenced(BackendDataType, backendId, lock)
+}
+
+func (m *Memory) deleteDataFenced(dt DataType, id uuid.UUID, lock *Lock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lock.GetFence() < m.fences[lock.GetName()] {
+		return ErrLockLost
+	}
+
+	delete(m.docs[dt], id)
+	return nil
+}
+
+func (m *Memory) GetAllPlayerIds() ([]uuid.UUID, error) {
+	return m.getAllIds(PlayerDataType)
+}
+
+func (m *Memory) GetAllPartyIds() ([]uuid.UUID, error) {
+	return m.getAllIds(PartyDataType)
+}
+
+func (m *Memory) GetAllProxyIds() ([]uuid.UUID, error) {
+	return m.getAllIds(ProxyDataType)
+}
+
+func (m *Memory) GetAllBackendsIds() ([]uuid.UUID, error) {
+	return m.getAllIds(BackendDataType)
+}
+
+func (m *Memory) getAllIds(dt DataType) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for id := range m.docs[dt] {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) TryLock(name string, ttl time.Duration) (*Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ml, ok := m.locks[name]
+	if ok && time.Now().Before(ml.exp) {
+		return nil, ErrLockHeld
+	}
+
+	token := newLockToken()
+	m.fences[name]++
+	m.locks[name] = &memoryLock{token: token, exp: time.Now().Add(ttl)}
+	return newLock(m, m.l, name, token, m.fences[name], ttl), nil
+}
+
+func (m *Memory) renewLock(name, token string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ml, ok := m.locks[name]
+	if !ok || ml.token != token || time.Now().After(ml.exp) {
+		return false, nil
+	}
+
+	ml.exp = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (m *Memory) releaseLock(name, token string) error {
+	m.mu.Lock()
+	ml, ok := m.locks[name]
+	if ok && ml.token == token {
+		delete(m.locks, name)
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) checkLock(name, token string, fence int64) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ml, ok := m.locks[name]
+	return ok && ml.token == token && time.Now().Before(ml.exp) && m.fences[name] == fence, nil
+}
+
+// Converts the message the same way redis would, so listeners receive the same payload.
+func memoryPayload(message any) string {
+	switch v := message.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (m *Memory) Publish(channel string, message any) error {
+	msg := &Message{
+		Channel: channel,
+		Payload: memoryPayload(message),
+	}
+
+	m.lm.mu.Lock()
+	defer m.lm.mu.Unlock()
+
+	for ch := range m.lm.s[channel] {
+		select {
+		case ch <- msg:
+		default:
+			m.l.Warn("memory publish subscriber is full, dropping message", "channel", channel, "message", msg.Payload)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) subscribe(channel string) chan *Message {
+	m.lm.mu.Lock()
+	defer m.lm.mu.Unlock()
+
+	return m.addSubscriber(channel)
+}
+
+// must be called while holding m.lm.mu
+func (m *Memory) addSubscriber(channel string) chan *Message {
+	ch := make(chan *Message, memoryChannelSize)
+	if m.lm.s[channel] == nil {
+		m.lm.s[channel] = make(map[chan *Message]struct{})
+	}
+	m.lm.s[channel][ch] = struct{}{}
+
+	return ch
+}
+
+// must be called while holding m.lm.mu
+func (m *Memory) unsubscribe(channel string, ch chan *Message) {
+	delete(m.lm.s[channel], ch)
+	if len(m.lm.s[channel]) == 0 {
+		delete(m.lm.s, channel)
+	}
+	close(ch)
+}
+
+// Combination of Publish & Subscribe. Publish message in a channel, wait for a return message with a time limit.
+func (m *Memory) SendAndReturn(publishChannel, subscribeChannel string, message any, timeout time.Duration) (*Message, error) {
+	ch := m.subscribe(subscribeChannel)
+	defer func() {
+		m.lm.mu.Lock()
+		m.unsubscribe(subscribeChannel, ch)
+		m.lm.mu.Unlock()
+	}()
+
+	err := m.Publish(publishChannel, message)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(timeout):
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// Nothing gets lost inside one process, so durable channels are the same as normal channels.
+func (m *Memory) PublishDurable(channel string, message any) error {
+	return m.Publish(channel, message)
+}
+
+func (m *Memory) CreateDurableListener(channel, consumer string, handler func(msg *Message), resync func()) {
+	m.CreateListener(channel, handler)
+}
+
+func (m *Memory) DeleteDurableConsumer(channel, consumer string) error {
+	return nil
+}
+
+// Create a listener to listen for incoming calls. The listener can be stopped by using DeleteListener()
+func (m *Memory) CreateListener(channel string, handler func(msg *Message)) {
+	m.lm.mu.Lock()
+	defer m.lm.mu.Unlock()
+
+	if _, exists := m.lm.m[channel]; exists {
+		m.l.Warn("memory listener already existing", "channel", channel)
+		return
+	}
+
+	ch := m.addSubscriber(channel)
+	m.lm.m[channel] = ch
+
+	go func() {
+		for {
+			msg, ok := <-ch
+			if !ok {
+				m.l.Debug("memory pubsub channel closed", "channel", channel)
+				return
+			}
+
+			handler(msg)
+		}
+	}()
+}
+
+func (m *Memory) DeleteListener(channel string) error {
+	m.lm.mu.Lock()
+	defer m.lm.mu.Unlock()
+
+	ch, exists := m.lm.m[channel]
+	if !exists {
+		return nil
+	}
+
+	delete(m.lm.m, channel)
+	m.unsubscribe(channel, ch)
+	return nil
+}
+
+func (m *Memory) DeleteAllListeners() error {
+	m.lm.mu.Lock()
+	defer m.lm.mu.Unlock()
+
+	for channel, ch := range m.lm.m {
+		delete(m.lm.m, channel)
+		m.unsubscribe(channel, ch)
+	}
+
+	return nil
+}
+
+func (m *Memory) SetAlive(key string, ttl time.Duration) error {
+	m.mu.Lock()
+	m.alive[key] = time.Now().Add(ttl)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) SetAliveIfAbsent(key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exp, ok := m.alive[key]
+	if ok && time.Now().Before(exp) {
+		return false, nil
+	}
+
+	m.alive[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (m *Memory) IsAlive(key string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exp, ok := m.alive[key]
+	return ok && time.Now().Before(exp), nil
+}
+
+func (m *Memory) DeleteAlive(key string) error {
+	m.mu.Lock()
+	delete(m.alive, key)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Nothing else shares the memory storage, so there are no other proxies to watch.
+func (m *Memory) CreateExpiredListener(handler func(key string)) {}
+
+// The memory storage is always reachable.
+func (m *Memory) Health() HealthInfo {
+	return HealthInfo{
+		Health:    Health_Healthy,
+		Data:      BreakerState_Closed,
+		Messaging: BreakerState_Closed,
+	}
+}
+
+func (m *Memory) OnRecover(f func()) {}
+
+// The memory storage is always up to date.
+func (m *Memory) Stale() Storage {
+	return m
+}
+
+// Close the memory storage. Stops all listeners, the stored data is lost.
+func (m *Memory) Close() error {
+	err := m.DeleteAllListeners()
+	if err != nil {
+		return err
+	}
+
+	m.l.Info("memory storage closed successfully")
+	return nil
+}
+
+// The player documents are searched directly, there are never many players in memory.
+func (m *Memory) GetPlayerIdByUsername(username string) (uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, jsonData := range m.docs[PlayerDataType] {
+		var d struct {
+			Username string `json:"username"`
+		}
+
+		err := json.Unmarshal(jsonData, &d)
+		if err != nil {
+			continue
+		}
+
+		if strings.EqualFold(d.Username, username) {
+			return id, nil
+		}
+	}
+
+	return uuid.Nil, ErrDataNotFound
+}
+
+func (m *Memory) SetPlayerUsernameIndex(playerId uuid.UUID, oldUsername, username string) error {
+	return nil
+}
+
+func (m *Memory) SetPresence(playerIds []uuid.UUID, ttl time.Duration) error {
+	m.mu.Lock()
+	exp := time.Now().Add(ttl)
+	for _, id := range playerIds {
+		m.presence[id] = exp
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) RemovePresence(playerId uuid.UUID) error {
+	m.mu.Lock()
+	delete(m.presence, playerId)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) GetPresentPlayerIds() ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var ids []uuid.UUID
+	for id, exp := range m.presence {
+		if now.Before(exp) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) IsPresent(playerId uuid.UUID) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	exp, ok := m.presence[playerId]
+	return ok && time.Now().Before(exp), nil
+}
+
+func (m *Memory) RemoveExpiredPresence() ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var ids []uuid.UUID
+	for id, exp := range m.presence {
+		if !now.Before(exp) {
+			delete(m.presence, id)
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) GetOnlinePlayerIds() ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for id, jsonData := range m.docs[PlayerDataType] {
+		var d struct {
+			Online bool `json:"online"`
+		}
+
+		err := json.Unmarshal(jsonData, &d)
+		if err != nil || !d.Online {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,14 @@
+package database
+
+import "testing"
+
+func TestMemory(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		m := InitMemory(newTestLogger(t))
+		t.Cleanup(func() {
+			m.Close()
+		})
+
+		return m
+	})
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// A schema migration changes the Postgres tables. Migrations are applied in order of their version and only once.
+type Migration struct {
+	Version int
+	Name    string
+	Sql     string
+}
+
+// A document migration upgrades the stored json of one data type to the given version.
+// The transform receives the document of the previous version and changes it in place.
+type DocumentMigration struct {
+	DataType  DataType
+	Version   int
+	Name      string
+	Transform func(doc map[string]any) error
+}
+
+var (
+	ErrSchemaTooNew          = errors.New("database schema is newer than this proxy supports")
+	ErrDuplicateMigration    = errors.New("migration version already registered")
+	ErrIncorrectMigrationVer = errors.New("migration version must be higher than 0")
+)
+
+// all data types that are stored as json documents
+var documentDataTypes = []DataType{
+	PlayerDataType,
+	PartyDataType,
+	ProxyDataType,
+	BackendDataType,
+}
+
+// Registers a schema migration. Needs to be done before the database is initialized.
+func RegisterMigration(m Migration) error {
+	if m.Version < 1 {
+		return ErrIncorrectMigrationVer
+	}
+
+	if slices.ContainsFunc(schemaMigrations, func(o Migration) bool { return o.Version == m.Version }) {
+		return ErrDuplicateMigration
+	}
+
+	schemaMigrations = append(schemaMigrations, m)
+	slices.SortFunc(schemaMigrations, func(a, b Migration) int { return a.Version - b.Version })
+	return nil
+}
+
+// Registers a document migration. Needs to be done before the database is initialized.
+func RegisterDocumentMigration(dm DocumentMigration) error {
+	if dm.Version < 1 {
+		return ErrIncorrectMigrationVer
+	}
+
+	l := documentMigrations[dm.DataType]
+	if slices.ContainsFunc(l, func(o DocumentMigration) bool { return o.Version == dm.Version }) {
+		return ErrDuplicateMigration
+	}
+
+	l = append(l, dm)
+	slices.SortFunc(l, func(a, b DocumentMigration) int { return a.Version - b.Version })
+	documentMigrations[dm.DataType] = l
+	return nil
+}
+
+// The version every stored document of the data type should have.
+func latestDocumentVersion(dt DataType) int {
+	l := documentMigrations[dt]
+	if len(l) == 0 {
+		return 0
+	}
+
+	return l[len(l)-1].Version
+}
+
+func latestSchemaVersion() int {
+	if len(schemaMigrations) == 0 {
+		return 0
+	}
+
+	return schemaMigrations[len(schemaMigrations)-1].Version
+}
+
+// Upgrades a document from the given version to the latest version. Returns the same json if nothing had to change.
+func upgradeDocument(dt DataType, jsonData []byte, version int) ([]byte, bool, error) {
+	if version >= latestDocumentVersion(dt) {
+		return jsonData, false, nil
+	}
+
+	var doc map[string]any
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+
+	for _, dm := range documentMigrations[dt] {
+		if dm.Version <= version {
+			continue
+		}
+
+		err := dm.Transform(doc)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	jsonData, err = json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return jsonData, true, nil
+}
+
+// key used for the postgres advisory lock, so only one proxy migrates at a time
+const migrationLockKey = 7_405_823_911
+
+// Applies every missing schema migration and upgrades all stored documents.
+// Other proxies starting at the same moment wait until this one is done.
+func migrate(ctx context.Context, p *pgxpool.Pool, l *logger.Logger) error {
+	now := time.Now()
+
+	conn, err := p.Acquire(ctx)
+	if err != nil {
+		l.Error("postgres migration acquire connection error", "error", err)
+		return err
+	}
+	defer conn.Release()
+
+	// the statement timeout of the config is for normal queries, waiting for the lock and migrating can take longer
+	_, err = conn.Exec(ctx, "SET statement_timeout = 0")
+	if err != nil {
+		l.Error("postgres migration disable statement timeout error", "error", err)
+		return err
+	}
+
+	// the connection goes back to the pool, so the timeout of the config is set again
+	defer func() {
+		_, err := conn.Exec(context.Background(), "RESET statement_timeout")
+		if err != nil {
+			l.Warn("postgres migration reset statement timeout error", "error", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey)
+	if err != nil {
+		l.Error("postgres migration acquire lock error", "error", err)
+		return err
+	}
+
+	defer func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		if err != nil {
+			l.Warn("postgres migration release lock error", "error", err)
+		}
+	}()
+
+	err = migrateSchema(ctx, conn.Conn(), l)
+	if err != nil {
+		return err
+	}
+
+	for _, dt := range documentDataTypes {
+		err = migrateDocuments(ctx, conn.Conn(), l, dt)
+		if err != nil {
+			return err
+		}
+	}
+
+	l.Debug("postgres migrations done", "schemaVersion", latestSchemaVersion(), "duration", time.Since(now))
+	return nil
+}
+
+func migrateSchema(ctx context.Context, conn *pgx.Conn, l *logger.Logger) error {
+	table := `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		appliedAt TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	`
+	_, err := conn.Exec(ctx, table)
+	if err != nil {
+		l.Error("postgres creating schema version table error", "error", err)
+		return err
+	}
+
+	var current int
+	err = conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		l.Error("postgres get schema version error", "error", err)
+		return err
+	}
+
+	if current > latestSchemaVersion() {
+		l.Error("postgres schema is newer than this proxy", "schemaVersion", current, "supportedVersion", latestSchemaVersion())
+		return ErrSchemaTooNew
+	}
+
+	for _, m := range schemaMigrations {
+		if m.Version <= current {
+			continue
+		}
+
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			_, err := tx.Exec(ctx, m.Sql)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(ctx, "INSERT INTO schema_version (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			l.Error("postgres schema migration error", "version", m.Version, "name", m.Name, "error", err)
+			return err
+		}
+
+		l.Info("applied postgres schema migration", "version", m.Version, "name", m.Name)
+	}
+
+	return nil
+}
+
+func migrateDocuments(ctx context.Context, conn *pgx.Conn, l *logger.Logger, dt DataType) error {
+	latest := latestDocumentVersion(dt)
+	if latest == 0 {
+		return nil
+	}
+
+	type document struct {
+		id      uuid.UUID
+		data    []byte
+		version int
+	}
+
+	query := "SELECT " + dt.String() + "Id, " + dt.String() + "Data, " + dt.String() + "Version FROM " + dt.String() + "_data WHERE " + dt.String() + "Version < $1"
+	rows, err := conn.Query(ctx, query, latest)
+	if err != nil {
+		l.Error("postgres get outdated "+dt.String()+" documents error", "error", err)
+		return err
+	}
+
+	docs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (document, error) {
+		var d document
+		err := row.Scan(&d.id, &d.data, &d.version)
+		return d, err
+	})
+	if err != nil {
+		l.Error("postgres scan outdated "+dt.String()+" documents error", "error", err)
+		return err
+	}
+
+	update := "UPDATE " + dt.String() + "_data SET " + dt.String() + "Data = $1::jsonb, " + dt.String() + "Version = $2 WHERE " + dt.String() + "Id = $3 AND " + dt.String() + "Version = $4"
+	for _, d := range docs {
+		jsonData, _, err := upgradeDocument(dt, d.data, d.version)
+		if err != nil {
+			l.Error("upgrading "+dt.String()+" document error", dt.String()+"Id", d.id, "version", d.version, "error", err)
+			return err
+		}
+
+		_, err = conn.Exec(ctx, update, jsonData, latest, d.id, d.version)
+		if err != nil {
+			l.Error("postgres update upgraded "+dt.String()+" document error", dt.String()+"Id", d.id, "error", err)
+			return err
+		}
+	}
+
+	if len(docs) > 0 {
+		l.Info("upgraded "+dt.String()+" documents", "amount", len(docs), "version", latest)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUpgradeDocument(t *testing.T) {
+	old := []byte(`{"name": "lobby", "address": "127.0.0.1:25566", "health": null}`)
+
+	jsonData, changed, err := upgradeDocument(BackendDataType, old, 0)
+	if err != nil || !changed {
+		t.Fatalf("upgrade document: got changed %v, error %v", changed, err)
+	}
+
+	var doc map[string]any
+	err = json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		t.Fatalf("unmarshal upgraded document: %v", err)
+	}
+
+	if doc["group"] != "" || doc["managed"] != false || doc["discovery"] != "" {
+		t.Fatalf("upgraded document: got %v", doc)
+	}
+
+	if tags, ok := doc["tags"].([]any); !ok || len(tags) != 0 {
+		t.Fatalf("upgraded document tags: got %v", doc["tags"])
+	}
+
+	if _, ok := doc["health"]; ok {
+		t.Fatalf("upgraded document health: got %v", doc["health"])
+	}
+
+	_, changed, err = upgradeDocument(BackendDataType, jsonData, latestDocumentVersion(BackendDataType))
+	if err != nil || changed {
+		t.Fatalf("upgrade latest document: got changed %v, error %v", changed, err)
+	}
+}
@@ -0,0 +1,159 @@
+package database
+
+import "time"
+
+// Never change a migration that has been released. Add a new one with a higher version instead.
+var schemaMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create data tables",
+		Sql: `
+		CREATE TABLE IF NOT EXISTS player_data (playerId UUID PRIMARY KEY, playerData JSONB NOT NULL);
+		CREATE TABLE IF NOT EXISTS party_data (partyId UUID PRIMARY KEY, partyData JSONB NOT NULL);
+		CREATE TABLE IF NOT EXISTS proxy_data (proxyId UUID PRIMARY KEY, proxyData JSONB NOT NULL);
+		CREATE TABLE IF NOT EXISTS backend_data (backendId UUID PRIMARY KEY, backendData JSONB NOT NULL);
+		CREATE TABLE IF NOT EXISTS data (dataKey TEXT PRIMARY KEY, dataValue TEXT);
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "add document versions",
+		Sql: `
+		ALTER TABLE player_data ADD COLUMN IF NOT EXISTS playerVersion INT NOT NULL DEFAULT 0;
+		ALTER TABLE party_data ADD COLUMN IF NOT EXISTS partyVersion INT NOT NULL DEFAULT 0;
+		ALTER TABLE proxy_data ADD COLUMN IF NOT EXISTS proxyVersion INT NOT NULL DEFAULT 0;
+		ALTER TABLE backend_data ADD COLUMN IF NOT EXISTS backendVersion INT NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add case-insensitive username index",
+		Sql: `
+		CREATE INDEX IF NOT EXISTS player_data_username_idx ON player_data (lower(playerData->>'username'));
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "add lock fences",
+		Sql: `
+		CREATE TABLE IF NOT EXISTS lock_fences (name TEXT PRIMARY KEY, fence BIGINT NOT NULL);
+		`,
+	},
+}
+
+// Never change a migration that has been released. Add a new one with a higher version instead.
+var documentMigrations = map[DataType][]DocumentMigration{
+	PlayerDataType: {
+		{
+			DataType:  PlayerDataType,
+			Version:   1,
+			Name:      "initialize permission, ban and friend defaults",
+			Transform: migratePlayerDefaults,
+		},
+		{
+			DataType:  PlayerDataType,
+			Version:   2,
+			Name:      "add last backend",
+			Transform: migratePlayerLastBackend,
+		},
+	},
+	ProxyDataType: {
+		{
+			DataType:  ProxyDataType,
+			Version:   1,
+			Name:      "add proxy name",
+			Transform: migrateProxyName,
+		},
+	},
+	BackendDataType: {
+		{
+			DataType:  BackendDataType,
+			Version:   1,
+			Name:      "add group and tags",
+			Transform: migrateBackendGroupAndTags,
+		},
+		{
+			DataType:  BackendDataType,
+			Version:   2,
+			Name:      "add managed and discovery",
+			Transform: migrateBackendSource,
+		},
+		{
+			DataType:  BackendDataType,
+			Version:   3,
+			Name:      "add health",
+			Transform: migrateBackendHealth,
+		},
+	},
+}
+
+// only sets the value when the key is missing or null
+func setDefault(doc map[string]any, key string, value any) {
+	if doc[key] == nil {
+		doc[key] = value
+	}
+}
+
+// player data created before permissions, bans and friends existed
+func migratePlayerDefaults(doc map[string]any) error {
+	if doc["permission"] == nil {
+		doc["permission"] = map[string]any{
+			"role": "default",
+			"rank": "default",
+		}
+	}
+
+	if doc["ban"] == nil {
+		doc["ban"] = map[string]any{
+			"banned":      false,
+			"reason":      "",
+			"permanently": false,
+			"expiration":  time.Time{},
+		}
+	}
+
+	if doc["friend"] == nil {
+		doc["friend"] = map[string]any{
+			"friends":               []any{},
+			"friendRequests":        []any{},
+			"friendPendingRequests": []any{},
+		}
+	}
+
+	return nil
+}
+
+// player data created before the last backend was kept
+func migratePlayerLastBackend(doc map[string]any) error {
+	setDefault(doc, "lastBackend", "")
+	return nil
+}
+
+// proxy data created before proxies could have a name, these proxies have no name
+func migrateProxyName(doc map[string]any) error {
+	setDefault(doc, "name", "")
+	return nil
+}
+
+// backend data created before groups and tags, these backends are in the default group
+func migrateBackendGroupAndTags(doc map[string]any) error {
+	setDefault(doc, "group", "")
+	setDefault(doc, "tags", []any{})
+	return nil
+}
+
+// backend data created before the backend command and discovery, these backends are from the gate config
+func migrateBackendSource(doc map[string]any) error {
+	setDefault(doc, "managed", false)
+	setDefault(doc, "discovery", "")
+	return nil
+}
+
+// backend data created before health checks, these backends have not been checked yet
+func migrateBackendHealth(doc map[string]any) error {
+	if _, ok := doc["health"].(map[string]any); !ok {
+		delete(doc, "health")
+	}
+
+	return nil
+}
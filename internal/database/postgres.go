@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/team-vesperis/vesperis-mp/internal/config"
 	"github.com/team-vesperis/vesperis-mp/internal/logger"
@@ -11,21 +12,22 @@ import (
 
 func initPostgres(ctx context.Context, l *logger.Logger, c *config.Config) (*pgxpool.Pool, error) {
 	now := time.Now()
-	p, err := pgxpool.New(ctx, c.GetPostgresUrl())
+	schema := c.GetPostgresSchema()
+
+	p, err := connectPostgres(ctx, l, c.GetPostgresUrl(), schema)
 	if err != nil {
-		l.Error("postgres connection error", "error", err)
 		return nil, err
 	}
 
-	err = p.Ping(ctx)
+	_, err = p.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{schema}.Sanitize())
 	if err != nil {
-		l.Error("postgres ping error", "error", err)
+		l.Error("postgres create schema error", "schema", schema, "error", err)
 		return nil, err
 	}
 
-	err = createTables(ctx, p, l)
+	err = migrate(ctx, p, l)
 	if err != nil {
-		l.Error("postgres creating table error")
+		l.Error("postgres migration error")
 		return nil, err
 	}
 
@@ -33,49 +35,51 @@ func initPostgres(ctx context.Context, l *logger.Logger, c *config.Config) (*pgx
 	return p, nil
 }
 
-func createTable(ctx context.Context, p *pgxpool.Pool, dt DataType) error {
-	table := "CREATE TABLE IF NOT EXISTS " + dt.String() + "_data (" + dt.String() + "Id UUID PRIMARY KEY," + dt.String() + "Data JSONB NOT NULL);"
-	_, err := p.Exec(ctx, table)
-	return err
-}
+// Opens a pool for every read replica. The schema and migrations are created by the primary.
+func initPostgresReplicas(ctx context.Context, l *logger.Logger, c *config.Config) ([]*pgxpool.Pool, error) {
+	var replicas []*pgxpool.Pool
+	for _, u := range c.GetPostgresReplicaUrls() {
+		p, err := connectPostgres(ctx, l, u, c.GetPostgresSchema())
+		if err != nil {
+			for _, p := range replicas {
+				p.Close()
+			}
 
-func createTables(ctx context.Context, p *pgxpool.Pool, l *logger.Logger) error {
-	err := createTable(ctx, p, PlayerDataType)
-	if err != nil {
-		l.Error("postgres creating player table error", "error", err)
-		return err
+			return nil, err
+		}
+
+		replicas = append(replicas, p)
 	}
 
-	err = createTable(ctx, p, PartyDataType)
-	if err != nil {
-		l.Error("postgres creating party table error", "error", err)
-		return err
+	if len(replicas) > 0 {
+		l.Debug("initialized postgres replicas", "amount", len(replicas))
 	}
 
-	err = createTable(ctx, p, ProxyDataType)
+	return replicas, nil
+}
+
+func connectPostgres(ctx context.Context, l *logger.Logger, url, schema string) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(url)
 	if err != nil {
-		l.Error("postgres creating proxy table error", "error", err)
-		return err
+		l.Error("postgres parse url error", "error", err)
+		return nil, err
 	}
 
-	err = createTable(ctx, p, BackendDataType)
+	// every network uses its own schema, so multiple networks can share a database
+	cfg.ConnConfig.RuntimeParams["search_path"] = pgx.Identifier{schema}.Sanitize()
+
+	p, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
-		l.Error("postgres creating backend table error", "error", err)
-		return err
+		l.Error("postgres connection error", "host", cfg.ConnConfig.Host, "error", err)
+		return nil, err
 	}
 
-	dataTable := `
-	CREATE TABLE IF NOT EXISTS data (
-		dataKey TEXT PRIMARY KEY,
-		dataValue TEXT
-	);
-	`
-
-	_, err = p.Exec(ctx, dataTable)
+	err = p.Ping(ctx)
 	if err != nil {
-		l.Error("postgres creating data table error", "table", dataTable, "error", err)
-		return err
+		l.Error("postgres ping error", "host", cfg.ConnConfig.Host, "error", err)
+		p.Close()
+		return nil, err
 	}
 
-	return nil
+	return p, nil
 }
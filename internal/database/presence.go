@@ -0,0 +1,149 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// The presence of online players is kept in a sorted set, with the time the entry expires as score.
+// The proxy of the player sets the entries again every interval, so players of a crashed proxy are gone after the ttl.
+
+func (db *Database) redisPresenceKey() string {
+	return db.namespaced("presence")
+}
+
+// Marks the players as online until the ttl passed.
+func (db *Database) SetPresence(playerIds []uuid.UUID, ttl time.Duration) error {
+	if len(playerIds) == 0 {
+		return nil
+	}
+
+	exp := float64(time.Now().Add(ttl).UnixMilli())
+	members := make([]redis.Z, len(playerIds))
+	for i, id := range playerIds {
+		members[i] = redis.Z{Score: exp, Member: id.String()}
+	}
+
+	return db.guard(db.hm.bm, func() error {
+		err := db.r.ZAdd(db.ctx, db.redisPresenceKey(), members...).Err()
+		if err != nil {
+			db.l.Error("redis set presence error", "amount", len(playerIds), "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (db *Database) RemovePresence(playerId uuid.UUID) error {
+	return db.guard(db.hm.bm, func() error {
+		err := db.r.ZRem(db.ctx, db.redisPresenceKey(), playerId.String()).Err()
+		if err != nil {
+			db.l.Error("redis remove presence error", "playerId", playerId, "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Returns the ids of all players that are online in the network.
+func (db *Database) GetPresentPlayerIds() ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bm, func() ([]uuid.UUID, error) {
+		l, err := db.r.ZRangeByScore(db.ctx, db.redisPresenceKey(), &redis.ZRangeBy{
+			Min: "(" + strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Max: "+inf",
+		}).Result()
+		if err != nil {
+			db.l.Error("redis get presence error", "error", err)
+			return nil, err
+		}
+
+		return parseUUIDs(l), nil
+	})
+}
+
+func (db *Database) IsPresent(playerId uuid.UUID) (bool, error) {
+	return guardResult(db, db.hm.bm, func() (bool, error) {
+		exp, err := db.r.ZScore(db.ctx, db.redisPresenceKey(), playerId.String()).Result()
+		if err == redis.Nil {
+			return false, nil
+		}
+
+		if err != nil {
+			db.l.Error("redis get presence of player error", "playerId", playerId, "error", err)
+			return false, err
+		}
+
+		return exp > float64(time.Now().UnixMilli()), nil
+	})
+}
+
+var removeExpiredPresenceScript = redis.NewScript(`
+local l = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+if #l > 0 then
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[1])
+end
+return l
+`)
+
+// Removes the entries that were not set again in time and returns their player ids.
+func (db *Database) RemoveExpiredPresence() ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bm, func() ([]uuid.UUID, error) {
+		l, err := removeExpiredPresenceScript.Run(db.ctx, db.r, []string{db.redisPresenceKey()}, time.Now().UnixMilli()).StringSlice()
+		if err != nil {
+			db.l.Error("redis remove expired presence error", "error", err)
+			return nil, err
+		}
+
+		return parseUUIDs(l), nil
+	})
+}
+
+func parseUUIDs(l []string) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(l))
+	for _, s := range l {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Returns the ids of the players that are saved as online.
+func (db *Database) GetOnlinePlayerIds() ([]uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() ([]uuid.UUID, error) {
+		query := `SELECT playerId FROM player_data WHERE (playerData->>'online')::boolean`
+		rows, err := db.p.Query(db.ctx, query)
+		if err != nil {
+			db.l.Error("postgres get online player ids error", "error", err)
+			return nil, err
+		}
+		defer rows.Close()
+
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			err := rows.Scan(&id)
+			if err != nil {
+				db.l.Error("postgres scan player id error", "error", err)
+				return nil, err
+			}
+
+			ids = append(ids, id)
+		}
+		if rows.Err() != nil {
+			db.l.Error("postgres player rows error", "error", rows.Err())
+			return nil, rows.Err()
+		}
+
+		return ids, nil
+	})
+}
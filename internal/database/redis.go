@@ -2,6 +2,10 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -9,22 +13,91 @@ import (
 	"github.com/team-vesperis/vesperis-mp/internal/logger"
 )
 
-func initRedis(ctx context.Context, l *logger.Logger, c *config.Config) (*redis.Client, error) {
+var ErrIncorrectCAFile = errors.New("ca file contains no certificates")
+
+// Creates a client for the configured topology. The Database only uses the UniversalClient, so it works the same on all of them.
+func initRedis(ctx context.Context, l *logger.Logger, c *config.Config) (redis.UniversalClient, error) {
 	now := time.Now()
-	opt, urlErr := redis.ParseURL(c.GetRedisUrl())
-	if urlErr != nil {
-		l.Error("redis parsing url error", "options", opt, "error", urlErr)
-		return nil, urlErr
+	o := c.GetRedisOptions()
+
+	opt := &redis.UniversalOptions{
+		Addrs:            o.Addresses,
+		MasterName:       o.MasterName,
+		Username:         o.Username,
+		Password:         o.Password,
+		SentinelUsername: o.SentinelUsername,
+		SentinelPassword: o.SentinelPassword,
+		DB:               o.Database,
+		PoolSize:         o.PoolSize,
+		MinIdleConns:     o.MinIdleConns,
+		MaxRetries:       o.MaxRetries,
+		DialTimeout:      o.DialTimeout,
+		ReadTimeout:      o.ReadTimeout,
+		WriteTimeout:     o.WriteTimeout,
+		PoolTimeout:      o.PoolTimeout,
+		ConnMaxIdleTime:  o.ConnMaxIdleTime,
 	}
 
-	r := redis.NewClient(opt)
+	if o.TLS {
+		t, err := redisTLSConfig(o)
+		if err != nil {
+			l.Error("redis tls config error", "error", err)
+			return nil, err
+		}
+
+		opt.TLSConfig = t
+	}
+
+	var r redis.UniversalClient
+	switch o.Topology {
+	case config.RedisTopology_Sentinel:
+		r = redis.NewFailoverClient(opt.Failover())
+	case config.RedisTopology_Cluster:
+		r = redis.NewClusterClient(opt.Cluster())
+	default:
+		r = redis.NewClient(opt.Simple())
+	}
 
 	pingErr := r.Ping(ctx).Err()
 	if pingErr != nil {
-		l.Error("redis ping error", "error", pingErr)
+		l.Error("redis ping error", "topology", o.Topology, "addresses", o.Addresses, "error", pingErr)
 		return nil, pingErr
 	}
 
-	l.Debug("initialized redis", "duration", time.Since(now))
+	l.Debug("initialized redis", "topology", o.Topology, "tls", o.TLS, "duration", time.Since(now))
 	return r, nil
 }
+
+func redisTLSConfig(o *config.RedisOptions) (*tls.Config, error) {
+	t := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.TLSServerName,
+		InsecureSkipVerify: o.TLSInsecureSkipVerify,
+	}
+
+	if o.TLSCAFile != "" {
+		ca, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, ErrIncorrectCAFile
+		}
+
+		t.RootCAs = pool
+	}
+
+	// client certificate, needed when the server verifies clients
+	if o.TLSCertFile != "" || o.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		t.Certificates = []tls.Certificate{cert}
+	}
+
+	return t, nil
+}
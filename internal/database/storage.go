@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Storage is everything the multi proxy needs from its storage. The Database (Redis & Postgres) is used in production,
+// Memory keeps everything inside this process and can be used for single machine development and testing.
+type Storage interface {
+	GetData(key string, dest any) error
+	SetData(key string, val any) error
+
+	SetPlayerData(playerId uuid.UUID, data *data.PlayerData) error
+	SetPartyData(partyId uuid.UUID, data *data.PartyData) error
+	SetProxyData(proxyId uuid.UUID, data *data.ProxyData) error
+	SetBackendData(backendId uuid.UUID, data *data.BackendData) error
+
+	GetPlayerData(playerId uuid.UUID) (*data.PlayerData, error)
+	GetPartyData(partyId uuid.UUID) (*data.PartyData, error)
+	GetProxyData(proxyId uuid.UUID) (*data.ProxyData, error)
+	GetBackendData(backendId uuid.UUID) (*data.BackendData, error)
+
+	// Gets the data of several ids at once. Ids without data are not in the map.
+	GetPlayerDatas(playerIds []uuid.UUID) (map[uuid.UUID]*data.PlayerData, error)
+	GetPartyDatas(partyIds []uuid.UUID) (map[uuid.UUID]*data.PartyData, error)
+	GetProxyDatas(proxyIds []uuid.UUID) (map[uuid.UUID]*data.ProxyData, error)
+	GetBackendDatas(backendIds []uuid.UUID) (map[uuid.UUID]*data.BackendData, error)
+
+	SetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, val any) error
+	SetPartyDataField(partyId uuid.UUID, field key.PartyKey, val any) error
+	SetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, val any) error
+	SetBackendDataField(backendId uuid.UUID, field key.BackendKey, val any) error
+
+	// Sets several fields in one transaction.
+	SetPlayerDataFields(playerId uuid.UUID, fields map[key.PlayerKey]any) error
+	SetPartyDataFields(partyId uuid.UUID, fields map[key.PartyKey]any) error
+	SetProxyDataFields(proxyId uuid.UUID, fields map[key.ProxyKey]any) error
+	SetBackendDataFields(backendId uuid.UUID, fields map[key.BackendKey]any) error
+
+	GetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, dest any) error
+	GetPartyDataField(partyId uuid.UUID, field key.PartyKey, dest any) error
+	GetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, dest any) error
+	GetBackendDataField(backendId uuid.UUID, field key.BackendKey, dest any) error
+
+	// Atomic changes of list fields. Safe to use while other proxies change the same list.
+	AddToPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error)
+	AddToPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error)
+	AddToProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error)
+	AddToBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error)
+
+	RemoveFromPlayerDataList(playerId uuid.UUID, field key.PlayerKey, val uuid.UUID) ([]uuid.UUID, error)
+	RemoveFromPartyDataList(partyId uuid.UUID, field key.PartyKey, val uuid.UUID) ([]uuid.UUID, error)
+	RemoveFromProxyDataList(proxyId uuid.UUID, field key.ProxyKey, val uuid.UUID) ([]uuid.UUID, error)
+	RemoveFromBackendDataList(backendId uuid.UUID, field key.BackendKey, val uuid.UUID) ([]uuid.UUID, error)
+
+	CompareAndSetPlayerDataField(playerId uuid.UUID, field key.PlayerKey, expected, val any) (bool, error)
+	CompareAndSetPartyDataField(partyId uuid.UUID, field key.PartyKey, expected, val any) (bool, error)
+	CompareAndSetProxyDataField(proxyId uuid.UUID, field key.ProxyKey, expected, val any) (bool, error)
+	CompareAndSetBackendDataField(backendId uuid.UUID, field key.BackendKey, expected, val any) (bool, error)
+
+	// Case-insensitive username index, which also contains offline players.
+	GetPlayerIdByUsername(username string) (uuid.UUID, error)
+	SetPlayerUsernameIndex(playerId uuid.UUID, oldUsername, username string) error
+
+	DeletePartyData(partyId uuid.UUID) error
+	DeleteProxyData(proxyId uuid.UUID) error
+	DeleteBackendData(backendId uuid.UUID) error
+
+	// Deletes only while the fencing token of the lock is the newest, otherwise returns ErrLockLost. Never queued.
+	DeleteProxyDataFenced(proxyId uuid.UUID, lock *Lock) error
+	DeleteBackendDataFenced(backendId uuid.UUID, lock *Lock) error
+
+	GetAllPlayerIds() ([]uuid.UUID, error)
+	GetAllPartyIds() ([]uuid.UUID, error)
+	GetAllProxyIds() ([]uuid.UUID, error)
+	GetAllBackendsIds() ([]uuid.UUID, error)
+
+	// Keys that expire when they are not set again in time. Used to see if proxies are still running.
+	SetAlive(key string, ttl time.Duration) error
+	// Sets the key only when it is not set, in one step. Returns false when the key is still set.
+	SetAliveIfAbsent(key string, ttl time.Duration) (bool, error)
+	IsAlive(key string) (bool, error)
+	DeleteAlive(key string) error
+	// Called with the key when an alive key expired.
+	CreateExpiredListener(handler func(key string))
+
+	// Presence of online players. The proxy of the player sets it again every interval, it expires after the ttl.
+	SetPresence(playerIds []uuid.UUID, ttl time.Duration) error
+	RemovePresence(playerId uuid.UUID) error
+	GetPresentPlayerIds() ([]uuid.UUID, error)
+	IsPresent(playerId uuid.UUID) (bool, error)
+	// Removes the expired presence and returns the ids of those players.
+	RemoveExpiredPresence() ([]uuid.UUID, error)
+	// The players that are saved as online. Can differ from the presence when a proxy crashed.
+	GetOnlinePlayerIds() ([]uuid.UUID, error)
+
+	// Takes the lock if no one else holds it. Returns ErrLockHeld if it is held.
+	TryLock(name string, ttl time.Duration) (*Lock, error)
+
+	Publish(channel string, message any) error
+	SendAndReturn(publishChannel, subscribeChannel string, message any, timeout time.Duration) (*Message, error)
+	CreateListener(channel string, handler func(msg *Message))
+
+	// Durable channels keep messages for listeners that are reconnecting, when the streams transport is used.
+	PublishDurable(channel string, message any) error
+	CreateDurableListener(channel, consumer string, handler func(msg *Message), resync func())
+	DeleteDurableConsumer(channel, consumer string) error
+
+	DeleteListener(channel string) error
+	DeleteAllListeners() error
+
+	// Degraded mode. Reads fail with ErrStorageUnavailable and writes are queued while the storage can't be reached.
+	Health() HealthInfo
+	// The function is called when the storage is reachable again.
+	OnRecover(f func())
+
+	// Returns a storage that may read slightly outdated data, for example from a replica. Writes are not affected.
+	Stale() Storage
+
+	Close() error
+}
+
+// A message received from a pub/sub channel.
+type Message struct {
+	Channel string
+	Payload string
+}
+
+var (
+	_ Storage = (*Database)(nil)
+	_ Storage = (*Memory)(nil)
+)
+
+// Creates the storage selected in the config.
+func New(ctx context.Context, c *config.Config, l *logger.Logger) (Storage, error) {
+	switch c.GetStorageType() {
+	case config.StorageType_Memory:
+		return InitMemory(l), nil
+	case config.StorageType_Database:
+		return Init(ctx, c, l)
+	default:
+		return nil, config.ErrIncorrectStorageType
+	}
+}
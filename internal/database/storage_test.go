@@ -0,0 +1,486 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// The behaviour every Storage has to have. Run against each implementation, so they all behave the same.
+func testStorage(t *testing.T, newStorage func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		f    func(t *testing.T, s Storage)
+	}{
+		{"Data", testData},
+		{"PlayerData", testPlayerData},
+		{"DataFields", testDataFields},
+		{"DataList", testDataList},
+		{"CompareAndSet", testCompareAndSet},
+		{"Delete", testDelete},
+		{"Lock", testLock},
+		{"DeleteFenced", testDeleteFenced},
+		{"Alive", testAlive},
+		{"Presence", testPresence},
+		{"PublishSubscribe", testPublishSubscribe},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.f(t, newStorage(t))
+		})
+	}
+}
+
+// The logger writes its files in the working directory, so a temporary one is used.
+func newTestLogger(t *testing.T) *logger.Logger {
+	t.Chdir(t.TempDir())
+
+	l, err := logger.Init()
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+
+	return l
+}
+
+func newTestPlayerData(username string) *data.PlayerData {
+	return &data.PlayerData{
+		Username: username,
+		Permission: &data.PermissionData{
+			Role: "default",
+			Rank: "default",
+		},
+		Ban: &data.BanData{},
+		Friend: &data.FriendData{
+			Friends:               make([]uuid.UUID, 0),
+			FriendRequests:        make([]uuid.UUID, 0),
+			FriendPendingRequests: make([]uuid.UUID, 0),
+		},
+		PartyInvitations: make([]uuid.UUID, 0),
+	}
+}
+
+func newTestPlayer(t *testing.T, s Storage, username string) uuid.UUID {
+	id := uuid.New()
+	err := s.SetPlayerData(id, newTestPlayerData(username))
+	if err != nil {
+		t.Fatalf("set player data: %v", err)
+	}
+
+	return id
+}
+
+func testData(t *testing.T, s Storage) {
+	var v map[string]int
+	err := s.GetData("missing", &v)
+	if err != ErrDataNotFound {
+		t.Fatalf("get missing data: got %v, want %v", err, ErrDataNotFound)
+	}
+
+	err = s.SetData("counts", map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("set data: %v", err)
+	}
+
+	err = s.GetData("counts", &v)
+	if err != nil {
+		t.Fatalf("get data: %v", err)
+	}
+
+	if v["a"] != 1 {
+		t.Fatalf("get data: got %v", v)
+	}
+}
+
+func testPlayerData(t *testing.T, s Storage) {
+	id := newTestPlayer(t, s, "Alice")
+
+	pd, err := s.GetPlayerData(id)
+	if err != nil {
+		t.Fatalf("get player data: %v", err)
+	}
+
+	if pd.Username != "Alice" || pd.Permission.Role != "default" {
+		t.Fatalf("get player data: got %+v", pd)
+	}
+
+	_, err = s.GetPlayerData(uuid.New())
+	if err != ErrDataNotFound {
+		t.Fatalf("get missing player data: got %v, want %v", err, ErrDataNotFound)
+	}
+
+	missing := uuid.New()
+	m, err := s.GetPlayerDatas([]uuid.UUID{id, missing})
+	if err != nil {
+		t.Fatalf("get player datas: %v", err)
+	}
+
+	if len(m) != 1 || m[id] == nil {
+		t.Fatalf("get player datas: got %v", m)
+	}
+
+	ids, err := s.GetAllPlayerIds()
+	if err != nil {
+		t.Fatalf("get all player ids: %v", err)
+	}
+
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("get all player ids: got %v", ids)
+	}
+}
+
+func testDataFields(t *testing.T, s Storage) {
+	id := newTestPlayer(t, s, "Alice")
+
+	err := s.SetPlayerDataField(id, key.PlayerKey_Nickname, "Al")
+	if err != nil {
+		t.Fatalf("set field: %v", err)
+	}
+
+	var nickname string
+	err = s.GetPlayerDataField(id, key.PlayerKey_Nickname, &nickname)
+	if err != nil {
+		t.Fatalf("get field: %v", err)
+	}
+
+	if nickname != "Al" {
+		t.Fatalf("get field: got %q", nickname)
+	}
+
+	// nested fields only change the field itself
+	err = s.SetPlayerDataFields(id, map[key.PlayerKey]any{
+		key.PlayerKey_Permission_Role: "admin",
+		key.PlayerKey_Online:          true,
+	})
+	if err != nil {
+		t.Fatalf("set fields: %v", err)
+	}
+
+	pd, err := s.GetPlayerData(id)
+	if err != nil {
+		t.Fatalf("get player data: %v", err)
+	}
+
+	if pd.Permission.Role != "admin" || pd.Permission.Rank != "default" || !pd.Online || pd.Nickname != "Al" {
+		t.Fatalf("set fields: got %+v %+v", pd, pd.Permission)
+	}
+
+	// like jsonb_set, an unknown id is ignored
+	err = s.SetPlayerDataField(uuid.New(), key.PlayerKey_Nickname, "Bob")
+	if err != nil {
+		t.Fatalf("set field of missing player: %v", err)
+	}
+
+	err = s.GetPlayerDataField(uuid.New(), key.PlayerKey_Nickname, &nickname)
+	if err != ErrDataNotFound {
+		t.Fatalf("get field of missing player: got %v, want %v", err, ErrDataNotFound)
+	}
+}
+
+func testDataList(t *testing.T, s Storage) {
+	id := newTestPlayer(t, s, "Alice")
+	a, b := uuid.New(), uuid.New()
+
+	l, err := s.AddToPlayerDataList(id, key.PlayerKey_Friend_Friends, a)
+	if err != nil {
+		t.Fatalf("add to list: %v", err)
+	}
+
+	l, err = s.AddToPlayerDataList(id, key.PlayerKey_Friend_Friends, b)
+	if err != nil {
+		t.Fatalf("add to list: %v", err)
+	}
+
+	// values are only added once
+	l, err = s.AddToPlayerDataList(id, key.PlayerKey_Friend_Friends, a)
+	if err != nil {
+		t.Fatalf("add to list: %v", err)
+	}
+
+	if len(l) != 2 || l[0] != a || l[1] != b {
+		t.Fatalf("add to list: got %v", l)
+	}
+
+	l, err = s.RemoveFromPlayerDataList(id, key.PlayerKey_Friend_Friends, a)
+	if err != nil {
+		t.Fatalf("remove from list: %v", err)
+	}
+
+	if len(l) != 1 || l[0] != b {
+		t.Fatalf("remove from list: got %v", l)
+	}
+
+	_, err = s.RemoveFromPlayerDataList(id, key.PlayerKey_Friend_Friends, a)
+	if err != ErrListValueNotFound {
+		t.Fatalf("remove missing value: got %v, want %v", err, ErrListValueNotFound)
+	}
+
+	var friends []uuid.UUID
+	err = s.GetPlayerDataField(id, key.PlayerKey_Friend_Friends, &friends)
+	if err != nil {
+		t.Fatalf("get list: %v", err)
+	}
+
+	if len(friends) != 1 || friends[0] != b {
+		t.Fatalf("get list: got %v", friends)
+	}
+}
+
+func testCompareAndSet(t *testing.T, s Storage) {
+	id := newTestPlayer(t, s, "Alice")
+	partyId := uuid.New()
+
+	ok, err := s.CompareAndSetPlayerDataField(id, key.PlayerKey_PartyId, uuid.Nil, partyId)
+	if err != nil {
+		t.Fatalf("compare and set: %v", err)
+	}
+
+	if !ok {
+		t.Fatal("compare and set: not set while the expected value matched")
+	}
+
+	ok, err = s.CompareAndSetPlayerDataField(id, key.PlayerKey_PartyId, uuid.Nil, uuid.New())
+	if err != nil {
+		t.Fatalf("compare and set: %v", err)
+	}
+
+	if ok {
+		t.Fatal("compare and set: set while the expected value didn't match")
+	}
+
+	var got uuid.UUID
+	err = s.GetPlayerDataField(id, key.PlayerKey_PartyId, &got)
+	if err != nil {
+		t.Fatalf("get field: %v", err)
+	}
+
+	if got != partyId {
+		t.Fatalf("compare and set: got %v, want %v", got, partyId)
+	}
+
+	ok, err = s.CompareAndSetPlayerDataField(uuid.New(), key.PlayerKey_PartyId, uuid.Nil, partyId)
+	if err != nil || ok {
+		t.Fatalf("compare and set of missing player: got %v %v", ok, err)
+	}
+}
+
+func testDelete(t *testing.T, s Storage) {
+	id := uuid.New()
+	err := s.SetProxyData(id, &data.ProxyData{Name: "proxy-1"})
+	if err != nil {
+		t.Fatalf("set proxy data: %v", err)
+	}
+
+	err = s.DeleteProxyData(id)
+	if err != nil {
+		t.Fatalf("delete proxy data: %v", err)
+	}
+
+	_, err = s.GetProxyData(id)
+	if err != ErrDataNotFound {
+		t.Fatalf("get deleted proxy data: got %v, want %v", err, ErrDataNotFound)
+	}
+}
+
+func testLock(t *testing.T, s Storage) {
+	lock, err := s.TryLock("test", time.Second)
+	if err != nil {
+		t.Fatalf("try lock: %v", err)
+	}
+
+	_, err = s.TryLock("test", time.Second)
+	if err != ErrLockHeld {
+		t.Fatalf("try held lock: got %v, want %v", err, ErrLockHeld)
+	}
+
+	err = lock.Check()
+	if err != nil {
+		t.Fatalf("check lock: %v", err)
+	}
+
+	fence := lock.GetFence()
+	err = lock.Release()
+	if err != nil {
+		t.Fatalf("release lock: %v", err)
+	}
+
+	err = lock.Check()
+	if err != ErrLockLost {
+		t.Fatalf("check released lock: got %v, want %v", err, ErrLockLost)
+	}
+
+	next, err := s.TryLock("test", time.Second)
+	if err != nil {
+		t.Fatalf("try released lock: %v", err)
+	}
+	defer next.Release()
+
+	if next.GetFence() <= fence {
+		t.Fatalf("fence did not increase: got %d after %d", next.GetFence(), fence)
+	}
+}
+
+func testDeleteFenced(t *testing.T, s Storage) {
+	id := uuid.New()
+	err := s.SetProxyData(id, &data.ProxyData{Name: "proxy-1"})
+	if err != nil {
+		t.Fatalf("set proxy data: %v", err)
+	}
+
+	old, err := s.TryLock("test", time.Second)
+	if err != nil {
+		t.Fatalf("try lock: %v", err)
+	}
+
+	// the lock is lost and taken by another holder
+	err = old.Release()
+	if err != nil {
+		t.Fatalf("release lock: %v", err)
+	}
+
+	next, err := s.TryLock("test", time.Second)
+	if err != nil {
+		t.Fatalf("try released lock: %v", err)
+	}
+	defer next.Release()
+
+	err = s.DeleteProxyDataFenced(id, old)
+	if err != ErrLockLost {
+		t.Fatalf("delete with old fence: got %v, want %v", err, ErrLockLost)
+	}
+
+	_, err = s.GetProxyData(id)
+	if err != nil {
+		t.Fatalf("proxy data deleted with old fence: %v", err)
+	}
+
+	err = s.DeleteProxyDataFenced(id, next)
+	if err != nil {
+		t.Fatalf("delete with newest fence: %v", err)
+	}
+
+	_, err = s.GetProxyData(id)
+	if err != ErrDataNotFound {
+		t.Fatalf("get deleted proxy data: got %v, want %v", err, ErrDataNotFound)
+	}
+}
+
+func testAlive(t *testing.T, s Storage) {
+	err := s.SetAlive("proxy", 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("set alive: %v", err)
+	}
+
+	alive, err := s.IsAlive("proxy")
+	if err != nil || !alive {
+		t.Fatalf("is alive: got %v %v", alive, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	alive, err = s.IsAlive("proxy")
+	if err != nil || alive {
+		t.Fatalf("is alive after ttl: got %v %v", alive, err)
+	}
+
+	set, err := s.SetAliveIfAbsent("proxy", time.Second)
+	if err != nil || !set {
+		t.Fatalf("set alive if absent: got %v %v", set, err)
+	}
+
+	set, err = s.SetAliveIfAbsent("proxy", time.Second)
+	if err != nil || set {
+		t.Fatalf("set alive if absent while set: got %v %v", set, err)
+	}
+}
+
+func testPresence(t *testing.T, s Storage) {
+	a, b := uuid.New(), uuid.New()
+	err := s.SetPresence([]uuid.UUID{a}, time.Minute)
+	if err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	err = s.SetPresence([]uuid.UUID{b}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ids, err := s.GetPresentPlayerIds()
+	if err != nil || len(ids) != 1 || ids[0] != a {
+		t.Fatalf("get present players: got %v %v", ids, err)
+	}
+
+	present, err := s.IsPresent(a)
+	if err != nil || !present {
+		t.Fatalf("is present: got %v %v", present, err)
+	}
+
+	present, err = s.IsPresent(b)
+	if err != nil || present {
+		t.Fatalf("is present after ttl: got %v %v", present, err)
+	}
+
+	ids, err = s.RemoveExpiredPresence()
+	if err != nil || len(ids) != 1 || ids[0] != b {
+		t.Fatalf("remove expired presence: got %v %v", ids, err)
+	}
+}
+
+func testPublishSubscribe(t *testing.T, s Storage) {
+	received := make(chan *Message, 1)
+	s.CreateListener("test", func(msg *Message) {
+		received <- msg
+	})
+
+	err := s.Publish("test", "hello")
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Channel != "test" || msg.Payload != "hello" {
+			t.Fatalf("received: got %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	err = s.DeleteListener("test")
+	if err != nil {
+		t.Fatalf("delete listener: %v", err)
+	}
+
+	err = s.Publish("test", "again")
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("received after the listener was deleted: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the reply is received by the one waiting for it
+	s.CreateListener("request", func(msg *Message) {
+		s.Publish("reply", msg.Payload+" back")
+	})
+
+	msg, err := s.SendAndReturn("request", "reply", "ping", time.Second)
+	if err != nil {
+		t.Fatalf("send and return: %v", err)
+	}
+
+	if msg.Payload != "ping back" {
+		t.Fatalf("send and return: got %q", msg.Payload)
+	}
+}
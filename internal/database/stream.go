@@ -0,0 +1,221 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+// Durable channels are sent over Redis Streams when the streams transport is selected.
+// Every consumer has its own consumer group, so Redis remembers up to which message each proxy has read.
+// After a reconnect the missed messages are read. If the stream has already been trimmed past
+// the position of the consumer, the resync function is called, because messages got lost.
+
+func (db *Database) redisStreamKeyTranslator(channel string) string {
+	return db.ns + "stream:" + channel
+}
+
+const streamPayloadField = "payload"
+
+func (db *Database) PublishDurable(channel string, message any) error {
+	if db.t != config.Transport_Streams {
+		return db.Publish(channel, message)
+	}
+
+	return db.guardWrite(db.hm.bm, "publish "+channel, func() error {
+		return db.xAdd(channel, message)
+	})
+}
+
+func (db *Database) xAdd(channel string, message any) error {
+	err := db.r.XAdd(db.ctx, &redis.XAddArgs{
+		Stream: db.redisStreamKeyTranslator(channel),
+		MaxLen: db.maxLen,
+		Approx: true,
+		Values: map[string]any{streamPayloadField: message},
+	}).Err()
+	if err != nil {
+		db.l.Error("redis stream add error", "channel", channel, "message", message, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// Create a listener that continues where the consumer stopped. The resync function is called when messages for the consumer were lost.
+func (db *Database) CreateDurableListener(channel, consumer string, handler func(msg *Message), resync func()) {
+	if db.t != config.Transport_Streams {
+		db.CreateListener(channel, handler)
+		return
+	}
+
+	db.lm.mu.Lock()
+	defer db.lm.mu.Unlock()
+
+	if db.listenerExists(channel) {
+		db.l.Warn("database listener already existing", "channel", channel)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(db.ctx)
+	db.lm.s[channel] = cancel
+
+	go db.listenStream(ctx, channel, consumer, handler, resync)
+}
+
+// Removes the position of the consumer. Used when a proxy is gone and won't read the channel anymore.
+func (db *Database) DeleteDurableConsumer(channel, consumer string) error {
+	if db.t != config.Transport_Streams {
+		return nil
+	}
+
+	err := db.r.XGroupDestroy(db.ctx, db.redisStreamKeyTranslator(channel), consumer).Err()
+	if err != nil {
+		db.l.Error("redis stream delete consumer error", "channel", channel, "consumer", consumer, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// must be called while holding db.lm.mu
+func (db *Database) listenerExists(channel string) bool {
+	_, pubsub := db.lm.m[channel]
+	_, stream := db.lm.s[channel]
+	return pubsub || stream
+}
+
+func (db *Database) listenStream(ctx context.Context, channel, consumer string, handler func(msg *Message), resync func()) {
+	stream := db.redisStreamKeyTranslator(channel)
+
+	// an existing group means this consumer has read the stream before and might have missed messages
+	checkGap, err := db.createConsumerGroup(ctx, stream, consumer)
+	if err != nil {
+		db.l.Error("redis stream create consumer group error", "channel", channel, "consumer", consumer, "error", err)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			db.l.Debug("database redis stream listener closed", "channel", channel)
+			return
+		}
+
+		if checkGap {
+			gap, err := db.streamGap(ctx, stream, consumer)
+			if err != nil {
+				db.l.Warn("redis stream check gap error", "channel", channel, "consumer", consumer, "error", err)
+			} else {
+				checkGap = false
+			}
+
+			if gap {
+				db.l.Warn("redis stream messages lost, resyncing", "channel", channel, "consumer", consumer)
+				resync()
+			}
+		}
+
+		res, err := db.r.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    consumer,
+			Consumer: consumer,
+			Streams:  []string{stream, ">"},
+			Count:    100,
+			Block:    5 * time.Second,
+			NoAck:    true,
+		}).Result()
+		if err != nil {
+			if err == redis.Nil || ctx.Err() != nil {
+				continue
+			}
+
+			// the group is gone, for example when redis restarted without persistence
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				db.l.Warn("redis stream consumer group missing, resyncing", "channel", channel, "consumer", consumer)
+				_, err := db.createConsumerGroup(ctx, stream, consumer)
+				if err != nil {
+					db.l.Error("redis stream create consumer group error", "channel", channel, "consumer", consumer, "error", err)
+				}
+
+				resync()
+				continue
+			}
+
+			db.l.Warn("redis stream read error", "channel", channel, "consumer", consumer, "error", err)
+			checkGap = true
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, s := range res {
+			for _, m := range s.Messages {
+				payload, _ := m.Values[streamPayloadField].(string)
+				handler(&Message{Channel: channel, Payload: payload})
+			}
+		}
+	}
+}
+
+// Creates the consumer group if it doesn't exist yet. New groups only receive messages sent from now on.
+// Returns if the group already existed.
+func (db *Database) createConsumerGroup(ctx context.Context, stream, group string) (bool, error) {
+	err := db.r.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return false, nil
+}
+
+// Returns if messages were trimmed from the stream before the group could read them.
+func (db *Database) streamGap(ctx context.Context, stream, group string) (bool, error) {
+	info, err := db.r.XInfoStream(ctx, stream).Result()
+	if err != nil {
+		return false, err
+	}
+
+	groups, err := db.r.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range groups {
+		if g.Name == group {
+			return compareStreamIds(g.LastDeliveredID, info.MaxDeletedEntryID) < 0, nil
+		}
+	}
+
+	// group is gone, reading the stream will recreate it
+	return false, nil
+}
+
+// Compares two stream ids in the form of milliseconds-sequence.
+func compareStreamIds(a, b string) int {
+	aMs, aSeq := parseStreamId(a)
+	bMs, bSeq := parseStreamId(b)
+
+	c := cmp.Compare(aMs, bMs)
+	if c != 0 {
+		return c
+	}
+
+	return cmp.Compare(aSeq, bSeq)
+}
+
+func parseStreamId(id string) (uint64, uint64) {
+	ms, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(ms, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
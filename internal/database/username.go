@@ -0,0 +1,72 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// redis hash with the lowercase username as field and the player id as value
+const redisUsernameIndexKey = "player_usernames"
+
+// Gets the id of the player with the username, ignoring case. Also finds players that are offline.
+// Returns ErrDataNotFound if no player ever joined with the username.
+func (db *Database) GetPlayerIdByUsername(username string) (uuid.UUID, error) {
+	return guardResult(db, db.hm.bd, func() (uuid.UUID, error) {
+		name := strings.ToLower(username)
+
+		val, err := db.r.HGet(db.ctx, db.namespaced(redisUsernameIndexKey), name).Result()
+		if err == nil {
+			id, err := uuid.Parse(val)
+			if err == nil {
+				return id, nil
+			}
+		} else if err != redis.Nil {
+			db.l.Warn("redis username index get error", "username", username, "error", err)
+		}
+
+		// uses the expression index on the lowercase username. If an old player still has the name, the player online or seen last is used.
+		var id uuid.UUID
+		query := `SELECT playerId FROM player_data WHERE lower(playerData->>'username') = $1 ORDER BY (playerData->>'online')::boolean DESC, playerData->>'lastSeen' DESC NULLS LAST LIMIT 1`
+		err = db.p.QueryRow(db.ctx, query, name).Scan(&id)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return uuid.Nil, ErrDataNotFound
+			}
+
+			db.l.Error("postgres get player id by username error", "username", username, "error", err)
+			return uuid.Nil, err
+		}
+
+		err = db.r.HSet(db.ctx, db.namespaced(redisUsernameIndexKey), name, id.String()).Err()
+		if err != nil {
+			db.l.Warn("redis username index set error", "username", username, "error", err)
+		}
+
+		return id, nil
+	})
+}
+
+// removes the old username only if it still points to the player, another player could be using it now
+var setUsernameIndexScript = redis.NewScript(`
+if ARGV[1] ~= "" and ARGV[1] ~= ARGV[2] and redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[3] then
+	redis.call("HDEL", KEYS[1], ARGV[1])
+end
+redis.call("HSET", KEYS[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+// Points the username to the player. The old username is removed if it still points to the player.
+func (db *Database) SetPlayerUsernameIndex(playerId uuid.UUID, oldUsername, username string) error {
+	return db.guardWrite(db.hm.bd, "username index "+playerId.String(), func() error {
+		err := setUsernameIndexScript.Run(db.ctx, db.r, []string{db.namespaced(redisUsernameIndexKey)}, strings.ToLower(oldUsername), strings.ToLower(username), playerId.String()).Err()
+		if err != nil {
+			db.l.Error("redis username index update error", "playerId", playerId, "username", username, "error", err)
+			return err
+		}
+
+		return nil
+	})
+}
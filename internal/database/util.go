@@ -6,20 +6,25 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-func redisPlayerKeyTranslator(playerId uuid.UUID) string {
-	return "player_data:" + playerId.String()
+// Prefixes a redis key or channel with the namespace of the network.
+func (db *Database) namespaced(key string) string {
+	return db.ns + key
 }
 
-func redisPartyKeyTranslator(partyId uuid.UUID) string {
-	return "party_data:" + partyId.String()
+func (db *Database) redisPlayerKeyTranslator(playerId uuid.UUID) string {
+	return db.ns + "player_data:" + playerId.String()
 }
 
-func redisProxyKeyTranslator(proxyId uuid.UUID) string {
-	return "proxy_data:" + proxyId.String()
+func (db *Database) redisPartyKeyTranslator(partyId uuid.UUID) string {
+	return db.ns + "party_data:" + partyId.String()
 }
 
-func redisBackendKeyTranslator(backendId uuid.UUID) string {
-	return "backend_data:" + backendId.String()
+func (db *Database) redisProxyKeyTranslator(proxyId uuid.UUID) string {
+	return db.ns + "proxy_data:" + proxyId.String()
+}
+
+func (db *Database) redisBackendKeyTranslator(backendId uuid.UUID) string {
+	return db.ns + "backend_data:" + backendId.String()
 }
 
 func safeJsonPathForPostgres(field string) string {
@@ -31,3 +36,11 @@ func safeJsonPathForPostgres(field string) string {
 	}
 	return "{" + strings.Join(parts, ",") + "}"
 }
+
+func stringFields[K ~string](fields map[K]any) map[string]any {
+	m := make(map[string]any, len(fields))
+	for k, v := range fields {
+		m[string(k)] = v
+	}
+	return m
+}
@@ -1,6 +1,7 @@
 package multi
 
 import (
+	"encoding/json"
 	"errors"
 	"slices"
 	"sync"
@@ -21,16 +22,21 @@ type Backend struct {
 	address     string
 	maintenance bool
 	players     []uuid.UUID
+	health      data.BackendHealthData
+	group       string
+	tags        []string
+	managed     bool
+	discovery   string
 
 	mu        sync.RWMutex
 	managerId uuid.UUID
 
 	l  *logger.Logger
-	db *database.Database
+	db database.Storage
 	cf *config.Config
 }
 
-func NewBackend(id, managerId uuid.UUID, ownerMP *Proxy, l *logger.Logger, db *database.Database, cf *config.Config, data *data.BackendData) *Backend {
+func NewBackend(id, managerId uuid.UUID, ownerMP *Proxy, l *logger.Logger, db database.Storage, cf *config.Config, data *data.BackendData) *Backend {
 	mb := &Backend{
 		id:        id,
 		managerId: managerId,
@@ -45,11 +51,34 @@ func NewBackend(id, managerId uuid.UUID, ownerMP *Proxy, l *logger.Logger, db *d
 	mb.address = data.Address
 	mb.maintenance = data.Maintenance
 	mb.players = data.Players
+	mb.group = data.Group
+	mb.tags = data.Tags
+	mb.managed = data.Managed
+	mb.discovery = data.Discovery
+
+	mb.health.Status = string(BackendStatus_Unknown)
+	if data.Health != nil {
+		mb.health = *data.Health
+	}
 
 	return mb
 }
 
-var ErrBackendNotFound = errors.New("backend not found")
+var (
+	ErrBackendNotFound = errors.New("backend not found")
+	ErrTagNotFound     = errors.New("tag not found")
+)
+
+type BackendStatus string
+
+const (
+	// Not checked yet.
+	BackendStatus_Unknown BackendStatus = "unknown"
+	// Answered the last server list ping.
+	BackendStatus_Online BackendStatus = "online"
+	// Didn't answer the last server list pings.
+	BackendStatus_Offline BackendStatus = "offline"
+)
 
 const UpdateMultiBackendChannel = "update_multibackend"
 
@@ -59,27 +88,115 @@ func (mb *Backend) save(k key.BackendKey, val any) error {
 		return err
 	}
 
-	m := mb.managerId.String() + "_" + mb.id.String() + "_" + k.String()
-	return mb.db.Publish(UpdateMultiBackendChannel, m)
+	return mb.notify(k, val)
+}
+
+// Update several values at once in a single transaction.
+// Other proxies receive one update message containing all keys.
+func (mb *Backend) saveFields(fields map[key.BackendKey]any) error {
+	err := mb.db.SetBackendDataFields(mb.id, fields)
+	if err != nil {
+		return err
+	}
+
+	return mb.notifyFields(fields)
+}
+
+// Sends the new value to other proxies, so they can update it for themselves.
+func (mb *Backend) notify(k key.BackendKey, val any) error {
+	return mb.notifyFields(map[key.BackendKey]any{k: val})
+}
+
+func (mb *Backend) notifyFields(fields map[key.BackendKey]any) error {
+	m, err := newValuesUpdateMessage(mb.managerId, mb.id, fields)
+	if err != nil {
+		mb.l.Error("backend update message create error", "backendId", mb.id, "error", err)
+		return err
+	}
+
+	return mb.db.PublishDurable(UpdateMultiBackendChannel, m)
 }
 
+// Sets several values at once. Either all values are saved or none.
+func (mb *Backend) SetFields(fields map[key.BackendKey]any) error {
+	err := mb.saveFields(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(fields) {
+		val, err := json.Marshal(fields[k])
+		if err != nil {
+			return err
+		}
+
+		err = mb.Apply(k, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads the value of the key from the database and applies it.
 func (mb *Backend) Update(k key.BackendKey) {
+	var val json.RawMessage
+	err := mb.db.GetBackendDataField(mb.id, k, &val)
+	if err != nil {
+		mb.l.Error("multibackend update backendkey get field from database error", "key", k, "error", err)
+		return
+	}
+
+	err = mb.Apply(k, val)
+	if err != nil {
+		mb.l.Error("multibackend update backendkey apply value error", "key", k, "error", err)
+	}
+}
+
+// Sets the value of the key without saving it. Used for values that other proxies changed.
+func (mb *Backend) Apply(k key.BackendKey, val json.RawMessage) error {
 	var err error
 
 	switch k {
 	case key.BackendKey_Maintenance:
 		var maintenance bool
-		err = mb.db.GetBackendDataField(mb.id, key.BackendKey_Maintenance, &maintenance)
+		err = json.Unmarshal(val, &maintenance)
+		if err != nil {
+			break
+		}
 		mb.setInMaintenance(maintenance, false)
 	case key.BackendKey_PlayerList:
 		var playerList []uuid.UUID
-		err = mb.db.GetBackendDataField(mb.id, key.BackendKey_PlayerList, &playerList)
+		err = json.Unmarshal(val, &playerList)
+		if err != nil {
+			break
+		}
 		mb.setPlayerIds(playerList, false)
+	case key.BackendKey_Health:
+		var health data.BackendHealthData
+		err = json.Unmarshal(val, &health)
+		if err != nil {
+			break
+		}
+		mb.setHealth(health, false)
+	case key.BackendKey_Group:
+		var group string
+		err = json.Unmarshal(val, &group)
+		if err != nil {
+			break
+		}
+		mb.setGroup(group, false)
+	case key.BackendKey_Tags:
+		var tags []string
+		err = json.Unmarshal(val, &tags)
+		if err != nil {
+			break
+		}
+		mb.setTags(tags, false)
 	}
 
-	if err != nil {
-		mb.l.Error("multibackend update backendkey get field from database error", "error", err)
-	}
+	return err
 }
 
 func (mb *Backend) GetName() string {
@@ -94,6 +211,16 @@ func (mb *Backend) GetId() uuid.UUID {
 	return mb.id
 }
 
+// Returns if the backend was added with the backend command.
+func (mb *Backend) IsManaged() bool {
+	return mb.managed
+}
+
+// Returns the discovery provider that found the backend. Empty when it was not discovered.
+func (mb *Backend) GetDiscovery() string {
+	return mb.discovery
+}
+
 // return the multiproxy the multibackend is located under
 func (mb *Backend) GetMultiProxy() *Proxy {
 	return mb.mp
@@ -122,6 +249,126 @@ func (mb *Backend) setInMaintenance(maintenance, notify bool) error {
 	return nil
 }
 
+// Backends without group are in the default group.
+func (mb *Backend) GetGroup() string {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+
+	if mb.group == "" {
+		return config.DefaultBackendGroup
+	}
+
+	return mb.group
+}
+
+func (mb *Backend) IsInGroup(group string) bool {
+	return mb.GetGroup() == group
+}
+
+func (mb *Backend) SetGroup(group string) error {
+	return mb.setGroup(group, true)
+}
+
+func (mb *Backend) setGroup(group string, notify bool) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.group = group
+
+	if notify {
+		return mb.save(key.BackendKey_Group, group)
+	}
+
+	return nil
+}
+
+func (mb *Backend) GetTags() []string {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return slices.Clone(mb.tags)
+}
+
+func (mb *Backend) HasTag(tag string) bool {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return slices.Contains(mb.tags, tag)
+}
+
+func (mb *Backend) SetTags(tags []string) error {
+	return mb.setTags(tags, true)
+}
+
+func (mb *Backend) setTags(tags []string, notify bool) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.tags = tags
+
+	if notify {
+		return mb.save(key.BackendKey_Tags, tags)
+	}
+
+	return nil
+}
+
+func (mb *Backend) AddTag(tag string) error {
+	if mb.HasTag(tag) {
+		return nil
+	}
+
+	return mb.SetTags(append(mb.GetTags(), tag))
+}
+
+func (mb *Backend) RemoveTag(tag string) error {
+	if !mb.HasTag(tag) {
+		return ErrTagNotFound
+	}
+
+	return mb.SetTags(slices.DeleteFunc(mb.GetTags(), func(t string) bool {
+		return t == tag
+	}))
+}
+
+// Returns the result of the last health check.
+func (mb *Backend) GetHealth() data.BackendHealthData {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return mb.health
+}
+
+func (mb *Backend) GetStatus() BackendStatus {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return BackendStatus(mb.health.Status)
+}
+
+// Returns if players can be sent to the backend. A backend that is not checked yet counts as available.
+func (mb *Backend) IsAvailable() bool {
+	return mb.GetStatus() != BackendStatus_Offline
+}
+
+func (mb *Backend) SetHealth(health data.BackendHealthData) error {
+	return mb.setHealth(health, true)
+}
+
+// Sets the health only on this proxy, other proxies keep the last saved health.
+func (mb *Backend) SetLocalHealth(health data.BackendHealthData) {
+	mb.setHealth(health, false)
+}
+
+func (mb *Backend) setHealth(health data.BackendHealthData, notify bool) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	mb.health = health
+
+	if notify {
+		return mb.save(key.BackendKey_Health, health)
+	}
+
+	return nil
+}
+
 func (mb *Backend) GetPlayerIds() []uuid.UUID {
 	mb.mu.RLock()
 	c := make([]uuid.UUID, len(mb.players))
@@ -152,24 +399,36 @@ func (mb *Backend) AddPlayerId(id uuid.UUID) error {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
-	if !slices.Contains(mb.players, id) {
-		mb.players = append(mb.players, id)
+	l, err := mb.db.AddToBackendDataList(mb.id, key.BackendKey_PlayerList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithValue(mb.players, id)
+	} else if err != nil {
+		return err
 	}
+	mb.players = l
 
-	return mb.save(key.BackendKey_PlayerList, mb.players)
+	return mb.notify(key.BackendKey_PlayerList, l)
 }
 
 func (mb *Backend) RemovePlayerId(id uuid.UUID) error {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
-	i := slices.Index(mb.players, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := mb.db.RemoveFromBackendDataList(mb.id, key.BackendKey_PlayerList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithoutValue(mb.players, id)
+	} else if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	mb.players = slices.Delete(mb.players, i, i+1)
+	mb.players = l
 
-	return mb.save(key.BackendKey_PlayerList, mb.players)
+	return mb.notify(key.BackendKey_PlayerList, l)
 }
 
 func (mb *Backend) IsPlayerIdOnProxy(id uuid.UUID) bool {
@@ -0,0 +1,69 @@
+package balancer
+
+import (
+	"sync"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+)
+
+// Backends without group are in the default group.
+const DefaultGroup = config.DefaultBackendGroup
+
+// Chooses the backend a player is sent to. Every backend group has its own strategy, set in the config.
+type Balancer struct {
+	cf *config.Config
+	l  *logger.Logger
+
+	// the strategies keep state, like the position of round-robin, so they are kept per group
+	strategies map[string]Strategy
+	names      map[string]config.BalancingStrategy
+	mu         sync.Mutex
+}
+
+func New(cf *config.Config, l *logger.Logger) *Balancer {
+	return &Balancer{
+		cf:         cf,
+		l:          l,
+		strategies: make(map[string]Strategy),
+		names:      make(map[string]config.BalancingStrategy),
+	}
+}
+
+// Returns the backend of the candidates that the player is sent to. mp can be nil.
+// Returns nil if there are no candidates.
+func (b *Balancer) Choose(group string, mp *multi.Player, candidates []*multi.Backend) *multi.Backend {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if group == "" {
+		group = DefaultGroup
+	}
+
+	mb := b.getStrategy(group).Choose(mp, candidates)
+	if mp != nil && mb != nil {
+		b.l.Debug("balancer chose backend", "group", group, "playerId", mp.GetId(), "backendId", mb.GetId(), "candidates", len(candidates))
+	}
+
+	return mb
+}
+
+// The strategy is created again when it has been changed in the config.
+func (b *Balancer) getStrategy(group string) Strategy {
+	name := b.cf.GetBalancingStrategy(group)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.strategies[group]
+	if ok && b.names[group] == name {
+		return s
+	}
+
+	s = newStrategy(name, group, b.cf)
+	b.strategies[group] = s
+	b.names[group] = name
+	return s
+}
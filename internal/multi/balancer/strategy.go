@@ -0,0 +1,151 @@
+package balancer
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+type Strategy interface {
+	// Returns one of the candidates, which is never empty. mp can be nil.
+	Choose(mp *multi.Player, candidates []*multi.Backend) *multi.Backend
+}
+
+func newStrategy(name config.BalancingStrategy, group string, cf *config.Config) Strategy {
+	switch name {
+	case config.BalancingStrategy_Weighted:
+		return newWeighted(group, cf)
+	case config.BalancingStrategy_RoundRobin:
+		return &roundRobin{}
+	case config.BalancingStrategy_StickyLastBackend:
+		return &stickyLastBackend{}
+	default:
+		return &leastPlayers{}
+	}
+}
+
+// The order of the candidates is not fixed, so they are sorted first for strategies that depend on it.
+func sortByName(candidates []*multi.Backend) []*multi.Backend {
+	l := slices.Clone(candidates)
+	slices.SortFunc(l, func(a, b *multi.Backend) int {
+		if c := strings.Compare(a.GetName(), b.GetName()); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.GetId().String(), b.GetId().String())
+	})
+
+	return l
+}
+
+type leastPlayers struct{}
+
+func (lp *leastPlayers) Choose(mp *multi.Player, candidates []*multi.Backend) *multi.Backend {
+	var backend *multi.Backend
+	count := -1
+
+	for _, mb := range sortByName(candidates) {
+		c := len(mb.GetPlayerIds())
+		if count < 0 || c < count {
+			backend = mb
+			count = c
+		}
+	}
+
+	return backend
+}
+
+type roundRobin struct {
+	n atomic.Uint64
+}
+
+func (rr *roundRobin) Choose(mp *multi.Player, candidates []*multi.Backend) *multi.Backend {
+	l := sortByName(candidates)
+	i := (rr.n.Add(1) - 1) % uint64(len(l))
+	return l[i]
+}
+
+// Smooth weighted round-robin. A backend with weight 3 is chosen three times as often as a backend with weight 1,
+// without choosing it three times in a row.
+type weighted struct {
+	group string
+	cf    *config.Config
+
+	current map[uuid.UUID]int
+	mu      sync.Mutex
+}
+
+func newWeighted(group string, cf *config.Config) *weighted {
+	return &weighted{
+		group:   group,
+		cf:      cf,
+		current: make(map[uuid.UUID]int),
+	}
+}
+
+func (w *weighted) Choose(mp *multi.Player, candidates []*multi.Backend) *multi.Backend {
+	weights := w.cf.GetBalancingWeights(w.group)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var backend *multi.Backend
+	total := 0
+	known := make(map[uuid.UUID]bool, len(candidates))
+
+	for _, mb := range sortByName(candidates) {
+		// the keys of the config are lowercase
+		weight, ok := weights[strings.ToLower(mb.GetName())]
+		if !ok {
+			weight = 1
+		}
+
+		if weight <= 0 {
+			continue
+		}
+
+		known[mb.GetId()] = true
+		total += weight
+		w.current[mb.GetId()] += weight
+
+		if backend == nil || w.current[mb.GetId()] > w.current[backend.GetId()] {
+			backend = mb
+		}
+	}
+
+	// backends that are gone
+	for id := range w.current {
+		if !known[id] {
+			delete(w.current, id)
+		}
+	}
+
+	// every candidate has weight 0
+	if backend == nil {
+		return (&leastPlayers{}).Choose(mp, candidates)
+	}
+
+	w.current[backend.GetId()] -= total
+	return backend
+}
+
+type stickyLastBackend struct {
+	lp leastPlayers
+}
+
+func (slb *stickyLastBackend) Choose(mp *multi.Player, candidates []*multi.Backend) *multi.Backend {
+	if mp != nil && mp.GetLastBackend() != "" {
+		for _, mb := range candidates {
+			if mb.GetName() == mp.GetLastBackend() {
+				return mb
+			}
+		}
+	}
+
+	return slb.lp.Choose(mp, candidates)
+}
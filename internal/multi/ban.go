@@ -109,59 +109,37 @@ func (bi *banInfo) setExpiration(expiration time.Time, notify bool) error {
 	return nil
 }
 
-func (bi *banInfo) Ban(reason string) error {
-	err := bi.setBanned(true, true)
+// Changes all ban values together, so other proxies never see a partly applied ban.
+func (bi *banInfo) setBan(banned bool, reason string, permanently bool, expiration time.Time) error {
+	bi.mu.Lock()
+	defer bi.mu.Unlock()
+
+	err := bi.mp.saveFields(map[key.PlayerKey]any{
+		key.PlayerKey_Ban_Banned:      banned,
+		key.PlayerKey_Ban_Reason:      reason,
+		key.PlayerKey_Ban_Permanently: permanently,
+		key.PlayerKey_Ban_Expiration:  expiration,
+	})
 	if err != nil {
 		return err
 	}
 
-	err = bi.setReason(reason, true)
-	if err != nil {
-		return err
-	}
+	bi.banned = banned
+	bi.reason = reason
+	bi.permanently = permanently
+	bi.expiration = expiration
 
-	err = bi.setPermanently(true, true)
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	return bi.setExpiration(time.Time{}, true)
+func (bi *banInfo) Ban(reason string) error {
+	return bi.setBan(true, reason, true, time.Time{})
 }
 
 func (bi *banInfo) TempBan(reason string, expiration time.Time) error {
-	err := bi.setBanned(true, true)
-	if err != nil {
-		return err
-	}
-
-	err = bi.setReason(reason, true)
-	if err != nil {
-		return err
-	}
-
-	err = bi.setPermanently(false, true)
-	if err != nil {
-		return err
-	}
-
-	return bi.setExpiration(expiration, true)
+	return bi.setBan(true, reason, false, expiration)
 }
 
 func (bi *banInfo) UnBan() error {
-	err := bi.setBanned(false, true)
-	if err != nil {
-		return err
-	}
-
-	err = bi.setReason("", true)
-	if err != nil {
-		return err
-	}
-
-	err = bi.setPermanently(false, true)
-	if err != nil {
-		return err
-	}
-
-	return bi.setExpiration(time.Time{}, true)
+	return bi.setBan(false, "", false, time.Time{})
 }
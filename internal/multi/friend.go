@@ -4,6 +4,7 @@ import (
 	"slices"
 	"sync"
 
+	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
 	"go.minekube.com/gate/pkg/util/uuid"
@@ -64,24 +65,30 @@ func (fi *friendInfo) AddFriendRequestId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	if !slices.Contains(fi.friendRequests, id) {
-		fi.friendRequests = append(fi.friendRequests, id)
+	l, err := fi.mp.db.AddToPlayerDataList(fi.mp.id, key.PlayerKey_Friend_FriendRequests, id)
+	if err != nil {
+		return err
 	}
+	fi.friendRequests = l
 
-	return fi.mp.save(key.PlayerKey_Friend_FriendRequests, fi.friendRequests)
+	return fi.mp.notify(key.PlayerKey_Friend_FriendRequests, l)
 }
 
 func (fi *friendInfo) RemoveFriendRequestId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	i := slices.Index(fi.friendRequests, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := fi.mp.db.RemoveFromPlayerDataList(fi.mp.id, key.PlayerKey_Friend_FriendRequests, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	fi.friendRequests = slices.Delete(fi.friendRequests, i, i+1)
+	fi.friendRequests = l
 
-	return fi.mp.save(key.PlayerKey_Friend_FriendRequests, fi.friendRequests)
+	return fi.mp.notify(key.PlayerKey_Friend_FriendRequests, l)
 }
 
 func (fi *friendInfo) GetPendingFriendRequestIds() []uuid.UUID {
@@ -119,24 +126,30 @@ func (fi *friendInfo) AddPendingFriendRequestId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	if !slices.Contains(fi.friendPendingRequests, id) {
-		fi.friendPendingRequests = append(fi.friendPendingRequests, id)
+	l, err := fi.mp.db.AddToPlayerDataList(fi.mp.id, key.PlayerKey_Friend_FriendPendingRequests, id)
+	if err != nil {
+		return err
 	}
+	fi.friendPendingRequests = l
 
-	return fi.mp.save(key.PlayerKey_Friend_FriendPendingRequests, fi.friendPendingRequests)
+	return fi.mp.notify(key.PlayerKey_Friend_FriendPendingRequests, l)
 }
 
 func (fi *friendInfo) RemovePendingFriendRequestId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	i := slices.Index(fi.friendPendingRequests, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := fi.mp.db.RemoveFromPlayerDataList(fi.mp.id, key.PlayerKey_Friend_FriendPendingRequests, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	fi.friendPendingRequests = slices.Delete(fi.friendPendingRequests, i, i+1)
+	fi.friendPendingRequests = l
 
-	return fi.mp.save(key.PlayerKey_Friend_FriendPendingRequests, fi.friendPendingRequests)
+	return fi.mp.notify(key.PlayerKey_Friend_FriendPendingRequests, l)
 }
 
 func (fi *friendInfo) GetFriendsIds() []uuid.UUID {
@@ -174,23 +187,29 @@ func (fi *friendInfo) AddFriendId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	if !slices.Contains(fi.friends, id) {
-		fi.friends = append(fi.friends, id)
+	l, err := fi.mp.db.AddToPlayerDataList(fi.mp.id, key.PlayerKey_Friend_Friends, id)
+	if err != nil {
+		return err
 	}
+	fi.friends = l
 
-	return fi.mp.save(key.PlayerKey_Friend_Friends, fi.friends)
+	return fi.mp.notify(key.PlayerKey_Friend_Friends, l)
 }
 
 func (fi *friendInfo) RemoveFriendId(id uuid.UUID) error {
 	fi.mu.Lock()
 	defer fi.mu.Unlock()
 
-	i := slices.Index(fi.friends, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := fi.mp.db.RemoveFromPlayerDataList(fi.mp.id, key.PlayerKey_Friend_Friends, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	fi.friends = slices.Delete(fi.friends, i, i+1)
+	fi.friends = l
 
-	return fi.mp.save(key.PlayerKey_Friend_Friends, fi.friends)
+	return fi.mp.notify(key.PlayerKey_Friend_Friends, l)
 
 }
@@ -1,10 +1,9 @@
 package manager
 
 import (
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
@@ -12,57 +11,64 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-func (mm *MultiManager) createBackendUpdateListener() func(msg *redis.Message) {
-	return func(msg *redis.Message) {
-		m := msg.Payload
-		s := strings.Split(m, "_")
-		if len(s) != 3 {
-			mm.l.Warn("multibackend update channel received message with incorrect length", "message", m)
+func (mm *MultiManager) createBackendUpdateListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
+		um, err := multi.ParseUpdateMessage(msg.Payload)
+		if err != nil {
+			mm.l.Warn("multibackend update channel received incorrect message", "message", msg.Payload, "error", err)
 			return
 		}
 
-		originProxy := s[0]
 		// from own proxy, no update needed
-		if mm.ownerMP.GetId().String() == originProxy {
-			return
-		}
-
-		id, err := uuid.Parse(s[1])
-		if err != nil {
-			mm.l.Error("multibackend update channel parse uuid error", "parsed uuid", s[1], "error", err)
+		if um.Origin == mm.ownerMP.GetId() {
 			return
 		}
 
-		k := s[2]
-
-		mb, err := mm.GetMultiBackend(id)
+		mb, err := mm.GetMultiBackend(um.Id)
 		if err != nil {
-			mm.l.Error("multibackend update channel get multibackend error", "backendId", id, "error", err)
+			mm.l.Error("multibackend update channel get multibackend error", "backendId", um.Id, "error", err)
 			return
 		}
 
-		mm.l.Debug("received backend update request", "originProxyId", originProxy, "backendId", id, "key", k)
+		mm.l.Debug("received backend update request", "originProxyId", um.Origin, "backendId", um.Id, "action", um.Action, "keys", um.Keys)
 
+		switch um.Action {
 		// already created
-		if k == "new" {
+		case multi.UpdateAction_New:
+			mm.onBackendsChanged()
 			return
-		}
-
-		if k == "delete" {
-			err := mm.deleteMultiBackend(id, false)
+		case multi.UpdateAction_Delete:
+			err := mm.deleteMultiBackend(um.Id, false, nil)
 			if err != nil {
-				mm.l.Error("multibackend update channel delete multibackend error", "backendId", id, "error", err)
+				mm.l.Error("multibackend update channel delete multibackend error", "backendId", um.Id, "error", err)
 			}
 			return
 		}
 
-		dataKey, err := key.GetBackendKey(k)
-		if err != nil {
-			mm.l.Error("multibackend update channel get data key error", "backendId", id, "key", k, "error", err)
-			return
-		}
+		for _, k := range um.Keys {
+			dataKey, err := key.GetBackendKey(k)
+			if err != nil {
+				mm.l.Error("multibackend update channel get data key error", "backendId", um.Id, "key", k, "error", err)
+				continue
+			}
+
+			if !mm.uv.accept(um.Origin, um.Id, k, um.Version) {
+				mm.l.Debug("multibackend update channel dropped outdated update", "backendId", um.Id, "origin", um.Origin, "key", k, "version", um.Version)
+				continue
+			}
 
-		mb.Update(dataKey)
+			// no value in the message, read it from the database
+			val, ok := um.Values[k]
+			if !ok {
+				mb.Update(dataKey)
+				continue
+			}
+
+			err = mb.Apply(dataKey, val)
+			if err != nil {
+				mm.l.Error("multibackend update channel apply value error", "backendId", um.Id, "key", k, "error", err)
+			}
+		}
 	}
 }
 
@@ -96,6 +102,39 @@ func (mm *MultiManager) NewMultiBackend(name, addr string) (*multi.Backend, erro
 		Address:     addr,
 		Maintenance: false,
 		Players:     make([]uuid.UUID, 0),
+		Group:       mm.cf.GetBackendGroup(name),
+		Tags:        mm.cf.GetBackendTags(name),
+	}
+
+	// added with the backend command, the group and tags of the command are used
+	md := mm.GetManagedBackend(name)
+	if md != nil {
+		data.Managed = true
+		if md.Group != "" {
+			data.Group = md.Group
+		}
+		data.Tags = md.Tags
+	}
+
+	// found by a discovery provider, the group and tags of the provider are used
+	provider, dd := mm.GetDiscoveredBackend(name)
+	if provider != "" {
+		data.Discovery = provider
+		if dd.Group != "" {
+			data.Group = dd.Group
+		}
+		data.Tags = dd.Tags
+	}
+
+	// changed with the backend command, kept over restarts
+	o := mm.GetBackendOverride(name)
+	if o != nil {
+		if o.Group != "" {
+			data.Group = o.Group
+		}
+		if o.Tags != nil {
+			data.Tags = o.Tags
+		}
 	}
 
 	err = mm.db.SetBackendData(id, data)
@@ -113,21 +152,28 @@ func (mm *MultiManager) NewMultiBackend(name, addr string) (*multi.Backend, erro
 		return nil, err
 	}
 
-	m := mm.ownerMP.GetId().String() + "_" + id.String() + "_new"
-	err = mm.db.Publish(multi.UpdateMultiBackendChannel, m)
+	m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_New)
 	if err != nil {
 		return nil, err
 	}
 
+	err = mm.db.PublishDurable(multi.UpdateMultiBackendChannel, m)
+	if err != nil {
+		return nil, err
+	}
+
+	mm.onBackendsChanged()
+
 	mm.l.Info("created new multibackend", "backendId", id, "duration", time.Since(now))
 	return mb, nil
 }
 
 func (mm *MultiManager) DeleteMultiBackend(id uuid.UUID) error {
-	return mm.deleteMultiBackend(id, true)
+	return mm.deleteMultiBackend(id, true, nil)
 }
 
-func (mm *MultiManager) deleteMultiBackend(id uuid.UUID, first bool) error {
+// With a lock, the data is only changed while the lock is held. The backend is kept when the delete is rejected.
+func (mm *MultiManager) deleteMultiBackend(id uuid.UUID, first bool, lock *database.Lock) error {
 	now := time.Now()
 
 	mb, err := mm.GetMultiBackend(id)
@@ -135,32 +181,70 @@ func (mm *MultiManager) deleteMultiBackend(id uuid.UUID, first bool) error {
 		return err
 	}
 
+	if first {
+		if lock != nil {
+			err = mm.db.DeleteBackendDataFenced(id, lock)
+		} else {
+			err = mm.db.DeleteBackendData(id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
 	mm.mu.Lock()
 	delete(mm.backendMap, id)
 	mm.mu.Unlock()
+	mm.uv.forget(id)
 
 	if first {
+		if lock != nil {
+			err = lock.Check()
+			if err != nil {
+				return err
+			}
+		}
+
 		err = mb.GetMultiProxy().RemoveBackendId(id)
 		if err != nil {
 			return err
 		}
 
-		err = mm.db.DeleteBackendData(id)
+		m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_Delete)
 		if err != nil {
 			return err
 		}
 
-		m := mm.ownerMP.GetId().String() + "_" + id.String() + "_delete"
-		err = mm.db.Publish(multi.UpdateMultiBackendChannel, m)
+		err = mm.db.PublishDurable(multi.UpdateMultiBackendChannel, m)
 		if err != nil {
 			return err
 		}
 	}
 
+	mm.onBackendsChanged()
+
 	mm.l.Info("deleted multibackend", "backendId", id, "duration", time.Since(now))
 	return nil
 }
 
+// Sets the function that is called when a backend is added to or removed from the network.
+func (mm *MultiManager) SetBackendsChangedListener(f func()) {
+	mm.mu.Lock()
+	mm.backendsChanged = f
+	mm.mu.Unlock()
+}
+
+func (mm *MultiManager) onBackendsChanged() {
+	mm.mu.RLock()
+	f := mm.backendsChanged
+	mm.mu.RUnlock()
+
+	if f != nil {
+		go f()
+	}
+}
+
 func (mm *MultiManager) GetMultiBackend(id uuid.UUID) (*multi.Backend, error) {
 	mm.mu.RLock()
 	mb, ok := mm.backendMap[id]
@@ -196,6 +280,22 @@ func (mm *MultiManager) GetMultiBackendUsingAddress(addr string) (*multi.Backend
 	return nil, multi.ErrBackendNotFound
 }
 
+// The target can be the name or the id of a backend. Backends on different proxies can have the same name, the first one found is returned.
+func (mm *MultiManager) FindMultiBackend(t string) (*multi.Backend, error) {
+	id, err := uuid.Parse(t)
+	if err == nil {
+		return mm.GetMultiBackend(id)
+	}
+
+	for _, mb := range mm.GetAllMultiBackends() {
+		if mb.GetName() == t {
+			return mb, nil
+		}
+	}
+
+	return nil, multi.ErrBackendNotFound
+}
+
 func (mm *MultiManager) CreateMultiBackendFromDatabase(id uuid.UUID) (*multi.Backend, error) {
 	data, err := mm.db.GetBackendData(id)
 	if err != nil {
@@ -240,22 +340,93 @@ func (mm *MultiManager) GetAllMultiBackendsUnderMultiProxy(mp *multi.Proxy) []*m
 	return l
 }
 
-func (mm *MultiManager) GetAllMultiBackendsFromDatabase() ([]*multi.Backend, error) {
+// Returns the backends of every proxy that are in the group.
+func (mm *MultiManager) GetBackendsInGroup(group string) []*multi.Backend {
 	var l []*multi.Backend
 
-	i, err := mm.db.GetAllBackendsIds()
+	for _, mb := range mm.GetAllMultiBackends() {
+		if mb.IsInGroup(group) {
+			l = append(l, mb)
+		}
+	}
+
+	return l
+}
+
+// Returns the backends of every proxy that have the tag.
+func (mm *MultiManager) GetBackendsWithTag(tag string) []*multi.Backend {
+	var l []*multi.Backend
+
+	for _, mb := range mm.GetAllMultiBackends() {
+		if mb.HasTag(tag) {
+			l = append(l, mb)
+		}
+	}
+
+	return l
+}
+
+// Returns the groups that have at least one backend, sorted by name.
+func (mm *MultiManager) GetAllBackendGroups() []string {
+	var l []string
+
+	for _, mb := range mm.GetAllMultiBackends() {
+		if !slices.Contains(l, mb.GetGroup()) {
+			l = append(l, mb.GetGroup())
+		}
+	}
+
+	slices.Sort(l)
+	return l
+}
+
+func (mm *MultiManager) GetAllMultiBackendsFromDatabase() ([]*multi.Backend, error) {
+	// a moment behind is fine, the updates of the loaded backends are received
+	s := mm.db.Stale()
+	i, err := s.GetAllBackendsIds()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range i {
-		mb, err := mm.GetMultiBackend(id)
+	// only the backends that are not loaded yet are read from the database, all in one go
+	mm.mu.RLock()
+	missing := slices.DeleteFunc(slices.Clone(i), func(id uuid.UUID) bool {
+		_, ok := mm.backendMap[id]
+		return ok
+	})
+	mm.mu.RUnlock()
+
+	datas, err := s.GetBackendDatas(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	backends := make(map[uuid.UUID]*multi.Backend, len(datas))
+	for id, data := range datas {
+		mp, err := mm.GetMultiProxy(data.Proxy)
 		if err != nil {
 			return nil, err
 		}
 
-		l = append(l, mb)
+		backends[id] = multi.NewBackend(id, mm.ownerMP.GetId(), mp, mm.l, mm.db, mm.cf, data)
+	}
+
+	var l []*multi.Backend
+
+	mm.mu.Lock()
+	for id, mb := range backends {
+		if _, ok := mm.backendMap[id]; !ok {
+			mm.backendMap[id] = mb
+		}
 	}
 
+	for _, id := range i {
+		mb, ok := mm.backendMap[id]
+		if ok {
+			l = append(l, mb)
+		}
+	}
+	mm.mu.Unlock()
+
 	return l, nil
 }
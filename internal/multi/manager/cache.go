@@ -0,0 +1,201 @@
+package manager
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Keeps the loaded multiplayers. Online players always stay loaded.
+// Offline players are loaded when needed and removed when they haven't been used for the ttl or when the cache is full.
+type playerCache struct {
+	m map[uuid.UUID]*list.Element
+	// front is the most recently used player
+	lru *list.List
+	mu  sync.Mutex
+
+	maxSize int
+	ttl     time.Duration
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+
+	t *time.Ticker
+	d chan bool
+}
+
+type playerCacheEntry struct {
+	mp       *multi.Player
+	lastUsed time.Time
+}
+
+type PlayerCacheStats struct {
+	Size      int
+	MaxSize   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+func newPlayerCache(maxSize int, ttl time.Duration) *playerCache {
+	return &playerCache{
+		m:       make(map[uuid.UUID]*list.Element),
+		lru:     list.New(),
+		maxSize: maxSize,
+		ttl:     ttl,
+	}
+}
+
+// Returns the player and marks it as used.
+func (pc *playerCache) get(id uuid.UUID) (*multi.Player, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	e, ok := pc.m[id]
+	if !ok {
+		pc.misses.Add(1)
+		return nil, false
+	}
+
+	pc.hits.Add(1)
+	e.Value.(*playerCacheEntry).lastUsed = time.Now()
+	pc.lru.MoveToFront(e)
+	return e.Value.(*playerCacheEntry).mp, true
+}
+
+// Returns the player without marking it as used.
+func (pc *playerCache) peek(id uuid.UUID) (*multi.Player, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	e, ok := pc.m[id]
+	if !ok {
+		return nil, false
+	}
+
+	return e.Value.(*playerCacheEntry).mp, true
+}
+
+// Adds the player. If the player was already added in the meantime, the existing player is returned.
+// Returns the ids of the players that have been evicted to make room.
+func (pc *playerCache) add(mp *multi.Player) (*multi.Player, []uuid.UUID) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	e, ok := pc.m[mp.GetId()]
+	if ok {
+		e.Value.(*playerCacheEntry).lastUsed = time.Now()
+		pc.lru.MoveToFront(e)
+		return e.Value.(*playerCacheEntry).mp, nil
+	}
+
+	pc.m[mp.GetId()] = pc.lru.PushFront(&playerCacheEntry{mp: mp, lastUsed: time.Now()})
+	return mp, pc.evict(time.Time{})
+}
+
+// Removes offline players that have not been used since the given time and,
+// starting with the least recently used, offline players until the cache is not over its maximum size.
+// Must be called while holding pc.mu
+func (pc *playerCache) evict(unusedSince time.Time) []uuid.UUID {
+	var evicted []uuid.UUID
+
+	e := pc.lru.Back()
+	for e != nil {
+		prev := e.Prev()
+		entry := e.Value.(*playerCacheEntry)
+
+		full := pc.maxSize > 0 && pc.lru.Len() > pc.maxSize
+		expired := entry.lastUsed.Before(unusedSince)
+		if !full && !expired {
+			// all players in front are used more recently
+			break
+		}
+
+		if !entry.mp.IsOnline() {
+			pc.lru.Remove(e)
+			delete(pc.m, entry.mp.GetId())
+			evicted = append(evicted, entry.mp.GetId())
+		}
+
+		e = prev
+	}
+
+	pc.evictions.Add(uint64(len(evicted)))
+	return evicted
+}
+
+func (pc *playerCache) all() []*multi.Player {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	l := make([]*multi.Player, 0, pc.lru.Len())
+	for e := pc.lru.Front(); e != nil; e = e.Next() {
+		l = append(l, e.Value.(*playerCacheEntry).mp)
+	}
+
+	return l
+}
+
+func (pc *playerCache) clear() {
+	pc.mu.Lock()
+	pc.m = make(map[uuid.UUID]*list.Element)
+	pc.lru.Init()
+	pc.mu.Unlock()
+}
+
+func (pc *playerCache) stats() PlayerCacheStats {
+	pc.mu.Lock()
+	size := pc.lru.Len()
+	pc.mu.Unlock()
+
+	return PlayerCacheStats{
+		Size:      size,
+		MaxSize:   pc.maxSize,
+		Hits:      pc.hits.Load(),
+		Misses:    pc.misses.Load(),
+		Evictions: pc.evictions.Load(),
+	}
+}
+
+// Removes the players that have not been used for the ttl, every minute.
+func (mm *MultiManager) startPlayerCacheCleaner() {
+	pc := mm.pc
+	pc.t = time.NewTicker(time.Minute)
+	pc.d = make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case <-pc.d:
+				return
+			case <-pc.t.C:
+				now := time.Now()
+
+				pc.mu.Lock()
+				evicted := pc.evict(now.Add(-pc.ttl))
+				pc.mu.Unlock()
+
+				for _, id := range evicted {
+					mm.uv.forget(id)
+				}
+
+				s := pc.stats()
+				mm.l.Debug("player cache cleaned", "evicted", len(evicted), "size", s.Size, "hits", s.Hits, "misses", s.Misses, "evictions", s.Evictions, "duration", time.Since(now))
+			}
+		}
+	}()
+}
+
+func (mm *MultiManager) stopPlayerCacheCleaner() {
+	mm.pc.t.Stop()
+	mm.pc.d <- true
+}
+
+func (mm *MultiManager) GetPlayerCacheStats() PlayerCacheStats {
+	return mm.pc.stats()
+}
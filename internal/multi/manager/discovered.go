@@ -0,0 +1,35 @@
+package manager
+
+import "github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+
+// The backends found by the discovery providers of this proxy are kept by name. They are not saved,
+// the providers find them again after a restart.
+
+type discoveredBackend struct {
+	provider string
+	md       data.ManagedBackendData
+}
+
+// Sets the backend found by the provider, used when the backend is registered in gate.
+func (mm *MultiManager) SetDiscoveredBackend(provider string, md data.ManagedBackendData) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.discovered[md.Name] = discoveredBackend{provider: provider, md: md}
+}
+
+func (mm *MultiManager) RemoveDiscoveredBackend(name string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	delete(mm.discovered, name)
+}
+
+// Returns the provider and the backend. The provider is empty when the backend was not discovered.
+func (mm *MultiManager) GetDiscoveredBackend(name string) (string, data.ManagedBackendData) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	db := mm.discovered[name]
+	return db.provider, db.md
+}
@@ -0,0 +1,134 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Every proxy pings its own backends each interval. The result is saved in the backend data,
+// so routing and transfers on every proxy can use it without dialing the backend themselves.
+type backendHealthManager struct {
+	t  *time.Ticker
+	d  chan bool
+	mm *MultiManager
+
+	// failed pings in a row of each backend
+	failures map[uuid.UUID]int
+	// when the health of each backend was last saved
+	saved map[uuid.UUID]time.Time
+	mu    sync.Mutex
+}
+
+func (mm *MultiManager) initBackendHealthManager() *backendHealthManager {
+	return &backendHealthManager{
+		t:        time.NewTicker(mm.cf.GetHealthCheckInterval()),
+		d:        make(chan bool),
+		mm:       mm,
+		failures: make(map[uuid.UUID]int),
+		saved:    make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (bhm *backendHealthManager) start() {
+	go func() {
+		bhm.check()
+
+		for {
+			select {
+			case <-bhm.d:
+				return
+			case <-bhm.t.C:
+				bhm.check()
+			}
+		}
+	}()
+}
+
+func (bhm *backendHealthManager) stop() {
+	bhm.t.Stop()
+	bhm.d <- true
+}
+
+// Pings every backend of this proxy at the same time and waits for all of them.
+func (bhm *backendHealthManager) check() {
+	now := time.Now()
+	l := bhm.mm.GetAllMultiBackendsUnderMultiProxy(bhm.mm.GetOwnerMultiProxy())
+
+	var wg sync.WaitGroup
+	for _, mb := range l {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bhm.checkBackend(mb)
+		}()
+	}
+	wg.Wait()
+
+	// backends that have been deleted in the meantime
+	bhm.mu.Lock()
+	for id := range bhm.failures {
+		_, err := bhm.mm.GetMultiBackend(id)
+		if err != nil {
+			delete(bhm.failures, id)
+			delete(bhm.saved, id)
+		}
+	}
+	bhm.mu.Unlock()
+
+	bhm.mm.l.Debug("backend health manager checked backends", "backends", len(l), "duration", time.Since(now))
+}
+
+func (bhm *backendHealthManager) checkBackend(mb *multi.Backend) {
+	now := time.Now()
+	old := mb.GetHealth()
+	health := old
+	health.CheckedAt = &now
+
+	ping, err := util.PingBackend(mb.GetAddress(), bhm.mm.cf.GetHealthCheckTimeout())
+
+	bhm.mu.Lock()
+	if err != nil {
+		bhm.failures[mb.GetId()]++
+
+		// a single failed ping doesn't make a backend offline
+		if bhm.failures[mb.GetId()] >= bhm.mm.cf.GetHealthCheckFailures() || old.Status == string(multi.BackendStatus_Unknown) {
+			health.Status = string(multi.BackendStatus_Offline)
+			health.LatencyMs = 0
+			health.PlayerCount = 0
+		}
+	} else {
+		bhm.failures[mb.GetId()] = 0
+
+		health.Status = string(multi.BackendStatus_Online)
+		health.LatencyMs = ping.Latency.Milliseconds()
+		health.Version = ping.Version
+		health.Protocol = ping.Protocol
+		health.PlayerCount = ping.PlayerCount
+		health.MaxPlayers = ping.MaxPlayers
+	}
+
+	changed := health.Status != old.Status || health.Version != old.Version || health.Protocol != old.Protocol
+	save := changed || time.Since(bhm.saved[mb.GetId()]) >= bhm.mm.cf.GetHealthCheckSaveInterval()
+	if save {
+		bhm.saved[mb.GetId()] = now
+	}
+	bhm.mu.Unlock()
+
+	if changed {
+		bhm.mm.l.Info("backend health changed", "backendId", mb.GetId(), "backendName", mb.GetName(), "status", health.Status, "oldStatus", old.Status, "version", health.Version, "error", err)
+	}
+
+	if !save {
+		mb.SetLocalHealth(health)
+		return
+	}
+
+	err = mb.SetHealth(health)
+	if err != nil {
+		bhm.mm.l.Warn("backend health manager set health error", "backendId", mb.GetId(), "error", err)
+	}
+}
@@ -1,25 +1,66 @@
 package manager
 
 import (
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"go.minekube.com/gate/pkg/util/uuid"
 )
 
+// Every proxy sets its alive key each interval. The key expires after the ttl, so a crashed proxy is found within seconds.
+// The last heart beat is still saved every few minutes, so it can be seen when a proxy was last running.
 type hartBeatManager struct {
 	t  *time.Ticker
+	lt *time.Ticker
 	d  chan bool
 	mm *MultiManager
+
+	interval time.Duration
+	ttl      time.Duration
+
+	// when the alive key of a proxy was found missing
+	missing map[uuid.UUID]time.Time
+	mu      sync.Mutex
+
+	// only one cleanup runs at a time in this proxy
+	cleaning atomic.Bool
 }
 
-const maxLastHartBeat = 5 * time.Minute
+const hartBeatInterval = 3 * time.Minute
+
+// Only one proxy at a time removes crashed proxies.
+const proxyCleanupLock = "proxy_cleanup_leader"
+
+// How long the cleanup of crashed proxies can hold its lock.
+const proxyCleanupTTL = 30 * time.Second
+
+const proxyAlivePrefix = "proxy:"
+
+func proxyAliveKey(id uuid.UUID) string {
+	return proxyAlivePrefix + id.String()
+}
 
 func (mm *MultiManager) InitHeartBeatManager() *hartBeatManager {
 	hbm := &hartBeatManager{
-		t:  time.NewTicker(3 * time.Minute),
-		d:  make(chan bool),
-		mm: mm,
+		t:        time.NewTicker(hartBeatInterval),
+		lt:       time.NewTicker(mm.cf.GetLivenessInterval()),
+		d:        make(chan bool),
+		mm:       mm,
+		interval: mm.cf.GetLivenessInterval(),
+		ttl:      mm.cf.GetLivenessTTL(),
+		missing:  make(map[uuid.UUID]time.Time),
 	}
 
 	mm.hbm = hbm
+	hbm.setAlive()
+
+	if mm.cf.IsKeyspaceNotificationsEnabled() {
+		mm.db.CreateExpiredListener(hbm.onExpired)
+	}
+
 	go hbm.start()
 
 	return hbm
@@ -30,83 +71,172 @@ func (hbm *hartBeatManager) start() {
 		select {
 		case <-hbm.d:
 			return
+		case <-hbm.lt.C:
+			hbm.setAlive()
+			hbm.checkLiveness()
 		case <-hbm.t.C:
 			now := time.Now()
 			hbm.mm.GetOwnerMultiProxy().SetLastHeartBeat(&now)
 			hbm.mm.l.Debug("hart beat manager set last heart beat", "time", now, "duration", time.Since(now))
-			go func() {
-				now := time.Now()
-				lockKey := "proxy_cleanup_leader"
-				got, err := hbm.mm.db.AcquireLock(lockKey, 30*time.Second)
-				if err != nil {
-					hbm.mm.l.Warn("could not acquire cleanup leader lock", "error", err)
-					return
-				}
-				if !got {
-					return
-				}
-
-				hbm.checkOtherProxies()
-				d := time.Since(now)
-				time.Sleep((3 * time.Minute) - d)
-				hbm.mm.db.ReleaseLock(lockKey)
-			}()
 		}
 	}
 }
 
 func (hbm *hartBeatManager) stop() {
 	hbm.t.Stop()
+	hbm.lt.Stop()
 	hbm.d <- true
+
+	err := hbm.mm.db.DeleteAlive(proxyAliveKey(hbm.mm.GetOwnerMultiProxy().GetId()))
+	if err != nil {
+		hbm.mm.l.Warn("hart beat manager delete alive key error", "error", err)
+	}
 }
 
-func (hbm *hartBeatManager) checkOtherProxies() {
-	now := time.Now()
+func (hbm *hartBeatManager) setAlive() {
+	err := hbm.mm.db.SetAlive(proxyAliveKey(hbm.mm.GetOwnerMultiProxy().GetId()), hbm.ttl)
+	if err != nil {
+		hbm.mm.l.Warn("hart beat manager set alive key error", "error", err)
+	}
+}
+
+// Called when the alive key of a proxy expired, the proxy stopped without closing.
+func (hbm *hartBeatManager) onExpired(key string) {
+	s, ok := strings.CutPrefix(key, proxyAlivePrefix)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(s)
+	if err != nil || id == hbm.mm.GetOwnerMultiProxy().GetId() {
+		return
+	}
+
+	hbm.mm.l.Info("hart beat manager multiproxy alive key expired", "proxyId", id)
+
+	// the key was not set for the whole ttl
+	hbm.mu.Lock()
+	hbm.missing[id] = time.Now().Add(-hbm.ttl)
+	hbm.mu.Unlock()
+
+	go hbm.cleanup()
+}
+
+// Checks the alive keys of the other proxies. Starts the cleanup when a proxy is dead.
+func (hbm *hartBeatManager) checkLiveness() {
+	dead := false
+	known := make(map[uuid.UUID]bool)
 
 	for _, mp := range hbm.mm.GetAllMultiProxies() {
 		if mp == hbm.mm.GetOwnerMultiProxy() {
 			continue
 		}
+		known[mp.GetId()] = true
 
-		lhb := mp.GetLastHeartBeat()
-		if lhb == nil || now.Sub(*lhb) > maxLastHartBeat {
-			hbm.mm.l.Info("deleting crashed multiproxy", "proxyId", mp.GetId(), "backendIds", mp.GetBackendsIds(), "playerIds", mp.GetPlayerIds())
-			for _, b_id := range mp.GetBackendsIds() {
-				err := hbm.mm.DeleteMultiBackend(b_id)
-				if err != nil {
-					hbm.mm.l.Warn("hart beat manager delete multibackend error", "backendId", b_id, "error", err)
-				}
-			}
-
-			for _, p_id := range mp.GetPlayerIds() {
-				p, err := hbm.mm.GetMultiPlayer(p_id)
-				if err != nil {
-					hbm.mm.l.Warn("hart beat manager delete multiplayer error", "playerId", p_id, "error", err)
-					continue
-				}
-
-				err = p.SetProxy(nil)
-				if err != nil {
-					hbm.mm.l.Warn("hart beat manager set multiplayer's proxy error", "playerId", p_id, "error", err)
-				}
-
-				if p.IsOnline() {
-					err := p.SetOnline(false)
-					if err != nil {
-						hbm.mm.l.Warn("hart beat manager set multiplayer's online error", "playerId", p_id, "error", err)
-					}
-				}
-
-				err = p.SetLastSeen(&now)
-				if err != nil {
-					hbm.mm.l.Warn("hart beat manager set multiplayer's last seen", "playerId", p_id, "error", err)
-				}
-			}
-
-			err := hbm.mm.DeleteMultiProxy(mp.GetId())
-			if err != nil {
-				hbm.mm.l.Error("hart beat manager delete multiproxy error", "proxyId", mp.GetId(), "error", err)
-			}
+		alive, err := hbm.mm.db.IsAlive(proxyAliveKey(mp.GetId()))
+		if err != nil {
+			// can't be known, for example while redis is unreachable
+			continue
 		}
+
+		hbm.mu.Lock()
+		if alive {
+			delete(hbm.missing, mp.GetId())
+		} else if _, ok := hbm.missing[mp.GetId()]; !ok {
+			hbm.missing[mp.GetId()] = time.Now()
+		}
+		hbm.mu.Unlock()
+
+		if hbm.isDead(mp.GetId()) {
+			dead = true
+		}
+	}
+
+	// proxies that have been deleted in the meantime
+	hbm.mu.Lock()
+	for id := range hbm.missing {
+		if !known[id] {
+			delete(hbm.missing, id)
+		}
+	}
+	hbm.mu.Unlock()
+
+	if dead {
+		go hbm.cleanup()
+	}
+}
+
+// A proxy is dead when its alive key is missing for the ttl. A missing key alone is not enough,
+// all keys are gone for a moment when redis restarts without persistence.
+func (hbm *hartBeatManager) isDead(id uuid.UUID) bool {
+	hbm.mu.Lock()
+	since, ok := hbm.missing[id]
+	hbm.mu.Unlock()
+
+	return ok && time.Since(since) >= hbm.ttl
+}
+
+// Removes the dead proxies. Only one proxy in the network does this at a time.
+func (hbm *hartBeatManager) cleanup() {
+	if !hbm.cleaning.CompareAndSwap(false, true) {
+		return
+	}
+	defer hbm.cleaning.Store(false)
+
+	lock, err := hbm.mm.db.TryLock(proxyCleanupLock, proxyCleanupTTL)
+	if err != nil {
+		if err != database.ErrLockHeld {
+			hbm.mm.l.Warn("could not acquire cleanup leader lock", "error", err)
+		}
+		return
+	}
+	defer lock.Release()
+
+	hbm.checkOtherProxies(lock)
+}
+
+// Deletes the proxies of which the alive key expired. Stops when the lock is lost.
+func (hbm *hartBeatManager) checkOtherProxies(lock *database.Lock) {
+	now := time.Now()
+
+	for _, mp := range hbm.mm.GetAllMultiProxies() {
+		if mp == hbm.mm.GetOwnerMultiProxy() || !hbm.isDead(mp.GetId()) {
+			continue
+		}
+
+		// the key could have been set again in the meantime
+		alive, err := hbm.mm.db.IsAlive(proxyAliveKey(mp.GetId()))
+		if err != nil || alive {
+			continue
+		}
+
+		err = lock.Check()
+		if err != nil {
+			hbm.mm.l.Warn("hart beat manager stopped cleanup, lock not held", "fence", lock.GetFence(), "error", err)
+			return
+		}
+
+		hbm.mm.l.Info("deleting crashed multiproxy", "proxyId", mp.GetId(), "proxyName", mp.GetName(), "backendIds", mp.GetBackendsIds(), "playerIds", mp.GetPlayerIds(), "fence", lock.GetFence())
+		err = hbm.mm.clearMultiProxy(mp, now, lock)
+		if err == database.ErrLockLost {
+			hbm.mm.l.Warn("hart beat manager stopped cleanup, lock lost", "proxyId", mp.GetId(), "fence", lock.GetFence())
+			return
+		}
+
+		// the storage rejects the delete when another proxy took the lock in the meantime,
+		// also when a restarted proxy reclaimed the id, because claiming takes the same lock
+		err = hbm.mm.deleteMultiProxy(mp.GetId(), true, lock)
+		if err == database.ErrLockLost {
+			hbm.mm.l.Warn("hart beat manager stopped cleanup, delete rejected", "proxyId", mp.GetId(), "fence", lock.GetFence())
+			return
+		}
+
+		if err != nil {
+			hbm.mm.l.Error("hart beat manager delete multiproxy error", "proxyId", mp.GetId(), "error", err)
+		}
+
+		hbm.mu.Lock()
+		delete(hbm.missing, mp.GetId())
+		hbm.mu.Unlock()
 	}
 }
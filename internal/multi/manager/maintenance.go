@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"slices"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+)
+
+// The maintenance of the whole network is kept in the data hash. Proxies are told to read it again when it changes,
+// over a durable channel so a proxy that was disconnected still gets the change. It is also read again on every resync.
+
+const (
+	networkMaintenanceKey           = "network_maintenance"
+	updateNetworkMaintenanceChannel = "update_network_maintenance"
+)
+
+func (mm *MultiManager) loadNetworkMaintenance() {
+	var maintenance bool
+	err := mm.db.GetData(networkMaintenanceKey, &maintenance)
+	if err != nil && err != database.ErrDataNotFound {
+		mm.l.Warn("get network maintenance error", "error", err)
+		return
+	}
+
+	mm.maintenance.Store(maintenance)
+}
+
+func (mm *MultiManager) IsNetworkInMaintenance() bool {
+	return mm.maintenance.Load()
+}
+
+func (mm *MultiManager) SetNetworkInMaintenance(maintenance bool) error {
+	err := mm.db.SetData(networkMaintenanceKey, maintenance)
+	if err != nil {
+		return err
+	}
+
+	mm.maintenance.Store(maintenance)
+	return mm.db.PublishDurable(updateNetworkMaintenanceChannel, mm.ownerMP.GetId().String())
+}
+
+func (mm *MultiManager) createNetworkMaintenanceListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
+		// from own proxy, no update needed
+		if msg.Payload == mm.ownerMP.GetId().String() {
+			return
+		}
+
+		mm.loadNetworkMaintenance()
+		mm.l.Info("network maintenance changed", "maintenance", mm.IsNetworkInMaintenance())
+	}
+}
+
+// Returns if the role of the player is allowed to join proxies and backends in maintenance.
+func (mm *MultiManager) CanBypassMaintenance(mp *multi.Player) bool {
+	// a player that hasn't joined before has no role
+	if mp == nil {
+		return false
+	}
+
+	return slices.Contains(mm.cf.GetMaintenanceBypassRoles(), mp.GetPermissionInfo().GetRole().String())
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+)
+
+// The backends added with the backend command are kept in the data hash by name. Every proxy registers them in gate,
+// the registry reads them again when a backend is added or removed.
+
+const (
+	managedBackendsKey  = "managed_backends"
+	managedBackendsLock = "managed_backends_lock"
+)
+
+var (
+	ErrManagedBackendExists   = errors.New("managed backend already exists")
+	ErrManagedBackendNotFound = errors.New("managed backend not found")
+)
+
+// Returns the backends added with the backend command, by name.
+func (mm *MultiManager) GetManagedBackends() (map[string]data.ManagedBackendData, error) {
+	return mm.getManagedBackends(mm.db)
+}
+
+// Returns the names of the managed backends. Can be a moment behind, used for suggestions.
+func (mm *MultiManager) GetManagedBackendNames() []string {
+	m, err := mm.getManagedBackends(mm.db.Stale())
+	if err != nil {
+		mm.l.Warn("get managed backend names error", "error", err)
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(m))
+}
+
+func (mm *MultiManager) getManagedBackends(s database.Storage) (map[string]data.ManagedBackendData, error) {
+	m := make(map[string]data.ManagedBackendData)
+	err := s.GetData(managedBackendsKey, &m)
+	if err == database.ErrDataNotFound {
+		return make(map[string]data.ManagedBackendData), nil
+	}
+
+	return m, err
+}
+
+// can return nil
+func (mm *MultiManager) GetManagedBackend(name string) *data.ManagedBackendData {
+	m, err := mm.GetManagedBackends()
+	if err != nil {
+		mm.l.Warn("get managed backends error", "error", err)
+		return nil
+	}
+
+	d, ok := m[name]
+	if !ok {
+		return nil
+	}
+
+	return &d
+}
+
+func (mm *MultiManager) AddManagedBackend(d data.ManagedBackendData) error {
+	return mm.changeManagedBackends(func(m map[string]data.ManagedBackendData) error {
+		if _, ok := m[d.Name]; ok {
+			return ErrManagedBackendExists
+		}
+
+		m[d.Name] = d
+		return nil
+	})
+}
+
+func (mm *MultiManager) RemoveManagedBackend(name string) error {
+	return mm.changeManagedBackends(func(m map[string]data.ManagedBackendData) error {
+		if _, ok := m[name]; !ok {
+			return ErrManagedBackendNotFound
+		}
+
+		delete(m, name)
+		return nil
+	})
+}
+
+// Only one proxy at a time changes the managed backends, otherwise a change could be lost.
+func (mm *MultiManager) changeManagedBackends(f func(m map[string]data.ManagedBackendData) error) error {
+	lock, err := mm.tryLockRetry(managedBackendsLock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	m, err := mm.GetManagedBackends()
+	if err != nil {
+		return err
+	}
+
+	err = f(m)
+	if err != nil {
+		return err
+	}
+
+	err = lock.Check()
+	if err != nil {
+		return err
+	}
+
+	return mm.db.SetData(managedBackendsKey, m)
+}
+
+// Tries the lock a few times, for changes that are done fast.
+func (mm *MultiManager) tryLockRetry(name string) (*database.Lock, error) {
+	var lock *database.Lock
+	var err error
+	for range 10 {
+		lock, err = mm.db.TryLock(name, 5*time.Second)
+		if err != database.ErrLockHeld {
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return lock, err
+}
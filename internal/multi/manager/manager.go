@@ -2,39 +2,63 @@ package manager
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/team-vesperis/vesperis-mp/internal/config"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/logger"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/balancer"
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
 type MultiManager struct {
 	proxyMap   map[uuid.UUID]*multi.Proxy
-	playerMap  map[uuid.UUID]*multi.Player
 	partyMap   map[uuid.UUID]*multi.Party
 	backendMap map[uuid.UUID]*multi.Backend
+	discovered map[string]discoveredBackend
 	mu         sync.RWMutex
 
 	ownerMP *multi.Proxy
 
+	// the whole network is in maintenance
+	maintenance atomic.Bool
+
+	bl  *balancer.Balancer
 	hbm *hartBeatManager
+	bhm *backendHealthManager
+	pm  *presenceManager
+	pc  *playerCache
+	uv  *updateVersions
+
+	// called when backends are added or removed
+	backendsChanged func()
 
 	cf *config.Config
-	db *database.Database
+	db database.Storage
 	l  *logger.Logger
 }
 
-func Init(cf *config.Config, db *database.Database, l *logger.Logger) (*MultiManager, error) {
+var updateChannels = []string{
+	multi.UpdateMultiPlayerChannel,
+	multi.UpdateMultiPartyChannel,
+	multi.UpdateMultiBackendChannel,
+	multi.UpdateMultiProxyChannel,
+	updateNetworkMaintenanceChannel,
+}
+
+func Init(cf *config.Config, db database.Storage, l *logger.Logger) (*MultiManager, error) {
 	now := time.Now()
 
 	mm := &MultiManager{
 		proxyMap:   make(map[uuid.UUID]*multi.Proxy),
-		playerMap:  make(map[uuid.UUID]*multi.Player),
 		partyMap:   make(map[uuid.UUID]*multi.Party),
 		backendMap: make(map[uuid.UUID]*multi.Backend),
+		discovered: make(map[string]discoveredBackend),
+		uv:         newUpdateVersions(),
+		bl:         balancer.New(cf, l),
+		pc:         newPlayerCache(cf.GetPlayerCacheMaxSize(), cf.GetPlayerCacheTTL()),
 		cf:         cf,
 		db:         db,
 		l:          l,
@@ -47,11 +71,28 @@ func Init(cf *config.Config, db *database.Database, l *logger.Logger) (*MultiMan
 		return &MultiManager{}, err
 	}
 
-	// start update listeners
-	mm.db.CreateListener(multi.UpdateMultiPlayerChannel, mm.createPlayerUpdateListener())
-	mm.db.CreateListener(multi.UpdateMultiPartyChannel, mm.createPartyUpdateListener())
-	mm.db.CreateListener(multi.UpdateMultiBackendChannel, mm.createBackendUpdateListener())
-	mm.db.CreateListener(multi.UpdateMultiProxyChannel, mm.createProxyUpdateListener())
+	// set right away, otherwise other proxies could see this proxy as dead while it is loading
+	err = mm.db.SetAlive(proxyAliveKey(mm.ownerMP.GetId()), cf.GetLivenessTTL())
+	if err != nil {
+		mm.l.Warn("set alive key error", "error", err)
+	}
+
+	// the presence is needed to know which players are online while loading them
+	mm.pm = mm.initPresenceManager()
+	mm.pm.start()
+
+	// start update listeners, every proxy reads the updates with its own position
+	consumer := mm.ownerMP.GetId().String()
+	mm.db.CreateDurableListener(multi.UpdateMultiPlayerChannel, consumer, mm.createPlayerUpdateListener(), mm.resyncPlayers)
+	mm.db.CreateDurableListener(multi.UpdateMultiPartyChannel, consumer, mm.createPartyUpdateListener(), mm.resyncParties)
+	mm.db.CreateDurableListener(multi.UpdateMultiBackendChannel, consumer, mm.createBackendUpdateListener(), mm.resyncBackends)
+	mm.db.CreateDurableListener(multi.UpdateMultiProxyChannel, consumer, mm.createProxyUpdateListener(), mm.resyncProxies)
+
+	mm.db.CreateDurableListener(updateNetworkMaintenanceChannel, consumer, mm.createNetworkMaintenanceListener(), mm.loadNetworkMaintenance)
+	mm.loadNetworkMaintenance()
+
+	// updates sent while the database was unreachable are lost
+	mm.db.OnRecover(mm.resync)
 
 	_, err = mm.GetAllMultiProxiesFromDatabase()
 	if err != nil {
@@ -63,9 +104,9 @@ func Init(cf *config.Config, db *database.Database, l *logger.Logger) (*MultiMan
 		mm.l.Warn("filling up multibackend map error", "error", err)
 	}
 
-	_, err = mm.GetAllMultiPlayersFromDatabase()
+	_, err = mm.loadOnlineMultiPlayers()
 	if err != nil {
-		mm.l.Warn("filling up multiplayer map error", "error", err)
+		mm.l.Warn("loading online multiplayers error", "error", err)
 	}
 
 	_, err = mm.GetAllMultiPartiesFromDatabase()
@@ -74,6 +115,9 @@ func Init(cf *config.Config, db *database.Database, l *logger.Logger) (*MultiMan
 	}
 
 	mm.hbm = mm.InitHeartBeatManager()
+	mm.bhm = mm.initBackendHealthManager()
+	mm.bhm.start()
+	mm.startPlayerCacheCleaner()
 	mm.l.Info("initialized multimanager", "duration", time.Since(now))
 	return mm, nil
 }
@@ -81,6 +125,17 @@ func Init(cf *config.Config, db *database.Database, l *logger.Logger) (*MultiMan
 func (mm *MultiManager) Close() error {
 	now := time.Now()
 
+	// stop reading updates before the own multiproxy is deleted
+	for _, channel := range updateChannels {
+		err := mm.db.DeleteListener(channel)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the backends are deleted next, no health can be saved anymore
+	mm.bhm.stop()
+
 	l := mm.ownerMP.GetBackendsIds()
 	for _, id := range l {
 		err := mm.DeleteMultiBackend(id)
@@ -95,6 +150,8 @@ func (mm *MultiManager) Close() error {
 	}
 
 	mm.hbm.stop()
+	mm.pm.stop()
+	mm.stopPlayerCacheCleaner()
 
 	mm.l.Info("multimanager closed successfully", "duration", time.Since(now))
 	return nil
@@ -106,9 +163,11 @@ func (mm *MultiManager) Refresh() time.Duration {
 	mm.mu.Lock()
 	mm.proxyMap = make(map[uuid.UUID]*multi.Proxy)
 	mm.backendMap = make(map[uuid.UUID]*multi.Backend)
-	mm.playerMap = make(map[uuid.UUID]*multi.Player)
 	mm.partyMap = make(map[uuid.UUID]*multi.Party)
 	mm.mu.Unlock()
+	mm.pc.clear()
+	mm.pm.refresh()
+	mm.loadNetworkMaintenance()
 
 	_, err := mm.GetAllMultiProxiesFromDatabase()
 	if err != nil {
@@ -120,9 +179,9 @@ func (mm *MultiManager) Refresh() time.Duration {
 		mm.l.Warn("refilling up multibackend map error", "error", err)
 	}
 
-	_, err = mm.GetAllMultiPlayersFromDatabase()
+	_, err = mm.loadOnlineMultiPlayers()
 	if err != nil {
-		mm.l.Warn("refilling up multiplayer map error", "error", err)
+		mm.l.Warn("reloading online multiplayers error", "error", err)
 	}
 
 	_, err = mm.GetAllMultiPartiesFromDatabase()
@@ -135,6 +194,11 @@ func (mm *MultiManager) Refresh() time.Duration {
 	return d
 }
 
+// Chooses the backend players are sent to.
+func (mm *MultiManager) GetBalancer() *balancer.Balancer {
+	return mm.bl
+}
+
 func (mm *MultiManager) GetOwnerMultiProxy() *multi.Proxy {
 	return mm.ownerMP
 }
@@ -0,0 +1,278 @@
+package manager
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Creates a multimanager over the memory storage. The logger and the config write their files in the working directory,
+// so a temporary one is used.
+func newTestManager(t *testing.T) (*MultiManager, database.Storage) {
+	return newTestManagerWith(t, nil)
+}
+
+// Wrap can change the storage the multimanager uses, nil uses the memory storage.
+func newTestManagerWith(t *testing.T, wrap func(s database.Storage) database.Storage) (*MultiManager, database.Storage) {
+	t.Chdir(t.TempDir())
+
+	l, err := logger.Init()
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+
+	cf, err := config.Init(l)
+	if err != nil {
+		t.Fatalf("config init: %v", err)
+	}
+
+	var db database.Storage = database.InitMemory(l)
+	if wrap != nil {
+		db = wrap(db)
+	}
+
+	mm, err := Init(cf, db, l)
+	if err != nil {
+		t.Fatalf("multimanager init: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return mm, db
+}
+
+func TestInit(t *testing.T) {
+	mm, db := newTestManager(t)
+
+	mp := mm.GetOwnerMultiProxy()
+	if mp == nil {
+		t.Fatal("no owner multiproxy")
+	}
+
+	_, err := db.GetProxyData(mp.GetId())
+	if err != nil {
+		t.Fatalf("owner multiproxy not saved: %v", err)
+	}
+
+	alive, err := db.IsAlive(proxyAliveKey(mp.GetId()))
+	if err != nil || !alive {
+		t.Fatalf("owner multiproxy not alive: %v %v", alive, err)
+	}
+
+	mb, err := mm.NewMultiBackend("lobby", "127.0.0.1:25566")
+	if err != nil {
+		t.Fatalf("new multibackend: %v", err)
+	}
+
+	if mb.GetMultiProxy() != mp || mb.GetGroup() != config.DefaultBackendGroup {
+		t.Fatalf("new multibackend: got proxy %v group %q", mb.GetMultiProxy(), mb.GetGroup())
+	}
+
+	found, err := mm.GetMultiBackendUsingAddress("127.0.0.1:25566")
+	if err != nil || found != mb {
+		t.Fatalf("get multibackend using address: got %v %v", found, err)
+	}
+
+	err = mm.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	_, err = db.GetProxyData(mp.GetId())
+	if err != database.ErrDataNotFound {
+		t.Fatalf("owner multiproxy not deleted: %v", err)
+	}
+
+	_, err = db.GetBackendData(mb.GetId())
+	if err != database.ErrDataNotFound {
+		t.Fatalf("multibackend not deleted: %v", err)
+	}
+}
+
+func TestGetAllOnlinePlayers(t *testing.T) {
+	mm, db := newTestManager(t)
+	defer mm.Close()
+
+	id := uuid.New()
+	err := db.SetPlayerData(id, &data.PlayerData{
+		Username:   "player",
+		Permission: &data.PermissionData{Role: "default", Rank: "default"},
+		Ban:        &data.BanData{},
+		Friend: &data.FriendData{
+			Friends:               make([]uuid.UUID, 0),
+			FriendRequests:        make([]uuid.UUID, 0),
+			FriendPendingRequests: make([]uuid.UUID, 0),
+		},
+		PartyInvitations: make([]uuid.UUID, 0),
+	})
+	if err != nil {
+		t.Fatalf("set player data: %v", err)
+	}
+
+	// the second present player has no player data
+	err = db.SetPresence([]uuid.UUID{id, uuid.New()}, time.Minute)
+	if err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	mm.pm.refresh()
+
+	l := mm.GetAllOnlinePlayers(true)
+	if len(l) != 1 || l[0].GetId() != id {
+		t.Fatalf("get all online players: got %v", l)
+	}
+
+	_, err = mm.GetMultiPlayers(mm.pm.all())
+	if err != database.ErrDataNotFound {
+		t.Fatalf("get multiplayers with missing player: got %v, want %v", err, database.ErrDataNotFound)
+	}
+}
+
+func TestBackendOverride(t *testing.T) {
+	mm, _ := newTestManager(t)
+	defer mm.Close()
+
+	mb, err := mm.NewMultiBackend("lobby", "127.0.0.1:25566")
+	if err != nil {
+		t.Fatalf("new multibackend: %v", err)
+	}
+
+	err = mm.SetBackendGroup(mb, "games")
+	if err != nil {
+		t.Fatalf("set backend group: %v", err)
+	}
+
+	err = mm.ChangeBackendTag(mb, "eu", true)
+	if err != nil {
+		t.Fatalf("add backend tag: %v", err)
+	}
+
+	err = mm.ChangeBackendTag(mb, "us", false)
+	if err != multi.ErrTagNotFound {
+		t.Fatalf("remove missing backend tag: got %v, want %v", err, multi.ErrTagNotFound)
+	}
+
+	if mb.GetGroup() != "games" || !slices.Equal(mb.GetTags(), []string{"eu"}) {
+		t.Fatalf("changed multibackend: got group %q tags %v", mb.GetGroup(), mb.GetTags())
+	}
+
+	// the backend is created again after a restart
+	err = mm.DeleteMultiBackend(mb.GetId())
+	if err != nil {
+		t.Fatalf("delete multibackend: %v", err)
+	}
+
+	mb, err = mm.NewMultiBackend("lobby", "127.0.0.1:25566")
+	if err != nil {
+		t.Fatalf("new multibackend: %v", err)
+	}
+
+	if mb.GetGroup() != "games" || !slices.Equal(mb.GetTags(), []string{"eu"}) {
+		t.Fatalf("recreated multibackend: got group %q tags %v", mb.GetGroup(), mb.GetTags())
+	}
+
+	err = mm.ChangeBackendTag(mb, "eu", false)
+	if err != nil {
+		t.Fatalf("remove backend tag: %v", err)
+	}
+
+	o := mm.GetBackendOverride("lobby")
+	if o == nil || o.Tags == nil || len(o.Tags) != 0 {
+		t.Fatalf("override after removing last tag: got %+v", o)
+	}
+}
+
+// Takes the lock over after the first fenced backend delete, like a proxy that reclaims the id while the cleanup runs.
+type lockTakingStorage struct {
+	database.Storage
+}
+
+func (s *lockTakingStorage) DeleteBackendDataFenced(id uuid.UUID, lock *database.Lock) error {
+	err := s.Storage.DeleteBackendDataFenced(id, lock)
+	lock.Release()
+	s.Storage.TryLock(lock.GetName(), time.Minute)
+	return err
+}
+
+func TestClearMultiProxyLockLost(t *testing.T) {
+	mm, db := newTestManagerWith(t, func(s database.Storage) database.Storage {
+		return &lockTakingStorage{Storage: s}
+	})
+	defer mm.Close()
+
+	proxyId := uuid.New()
+	backendId := uuid.New()
+	playerId := uuid.New()
+
+	err := db.SetProxyData(proxyId, &data.ProxyData{
+		Name:     "crashed",
+		Backends: []uuid.UUID{backendId},
+		Players:  []uuid.UUID{playerId},
+	})
+	if err != nil {
+		t.Fatalf("set proxy data: %v", err)
+	}
+
+	err = db.SetBackendData(backendId, &data.BackendData{Name: "lobby", Address: "127.0.0.1:25566", Proxy: proxyId, Players: make([]uuid.UUID, 0)})
+	if err != nil {
+		t.Fatalf("set backend data: %v", err)
+	}
+
+	err = db.SetPlayerData(playerId, &data.PlayerData{
+		Proxy:      proxyId,
+		Online:     true,
+		Username:   "player",
+		Permission: &data.PermissionData{Role: "default", Rank: "default"},
+		Ban:        &data.BanData{},
+		Friend: &data.FriendData{
+			Friends:               make([]uuid.UUID, 0),
+			FriendRequests:        make([]uuid.UUID, 0),
+			FriendPendingRequests: make([]uuid.UUID, 0),
+		},
+		PartyInvitations: make([]uuid.UUID, 0),
+	})
+	if err != nil {
+		t.Fatalf("set player data: %v", err)
+	}
+
+	mp, err := mm.GetMultiProxy(proxyId)
+	if err != nil {
+		t.Fatalf("get multiproxy: %v", err)
+	}
+
+	lock, err := db.TryLock(proxyCleanupLock, time.Minute)
+	if err != nil {
+		t.Fatalf("try lock: %v", err)
+	}
+
+	err = mm.clearMultiProxy(mp, time.Now(), lock)
+	if err != database.ErrLockLost {
+		t.Fatalf("clear multiproxy: got %v, want %v", err, database.ErrLockLost)
+	}
+
+	pd, err := db.GetPlayerData(playerId)
+	if err != nil {
+		t.Fatalf("get player data: %v", err)
+	}
+
+	if pd.Proxy != proxyId || !pd.Online {
+		t.Fatalf("player changed after lock lost: got proxy %v online %v", pd.Proxy, pd.Online)
+	}
+
+	d, err := db.GetProxyData(proxyId)
+	if err != nil {
+		t.Fatalf("get proxy data: %v", err)
+	}
+
+	if !slices.Equal(d.Players, []uuid.UUID{playerId}) || !slices.Equal(d.Backends, []uuid.UUID{backendId}) {
+		t.Fatalf("proxy changed after lock lost: got backends %v players %v", d.Backends, d.Players)
+	}
+}
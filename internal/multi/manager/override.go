@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"slices"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+)
+
+// The group and tags changed with the backend command are kept in the data hash by the name of the backend.
+// They are used over the config, managed and discovered values when the backend is created, also after a restart.
+
+const (
+	backendOverridesKey  = "backend_overrides"
+	backendOverridesLock = "backend_overrides_lock"
+)
+
+func (mm *MultiManager) getBackendOverrides() (map[string]data.BackendOverrideData, error) {
+	m := make(map[string]data.BackendOverrideData)
+	err := mm.db.GetData(backendOverridesKey, &m)
+	if err == database.ErrDataNotFound {
+		return make(map[string]data.BackendOverrideData), nil
+	}
+
+	return m, err
+}
+
+// can return nil
+func (mm *MultiManager) GetBackendOverride(name string) *data.BackendOverrideData {
+	m, err := mm.getBackendOverrides()
+	if err != nil {
+		mm.l.Warn("get backend overrides error", "error", err)
+		return nil
+	}
+
+	o, ok := m[name]
+	if !ok {
+		return nil
+	}
+
+	return &o
+}
+
+// Saves the group for the name of the backend and sets it on every backend with that name.
+func (mm *MultiManager) SetBackendGroup(mb *multi.Backend, group string) error {
+	err := mm.changeBackendOverride(mb.GetName(), func(o *data.BackendOverrideData) error {
+		o.Group = group
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range mm.getMultiBackendsWithName(mb.GetName()) {
+		err := b.SetGroup(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Saves the tags with the tag added or removed for the name of the backend and sets them on every backend with that name.
+// Returns multi.ErrTagNotFound when a tag that isn't there is removed.
+func (mm *MultiManager) ChangeBackendTag(mb *multi.Backend, tag string, add bool) error {
+	var tags []string
+	err := mm.changeBackendOverride(mb.GetName(), func(o *data.BackendOverrideData) error {
+		// not changed before, the tags of the backend are used
+		if o.Tags == nil {
+			o.Tags = mb.GetTags()
+		}
+
+		if add {
+			if !slices.Contains(o.Tags, tag) {
+				o.Tags = append(o.Tags, tag)
+			}
+		} else {
+			if !slices.Contains(o.Tags, tag) {
+				return multi.ErrTagNotFound
+			}
+
+			o.Tags = slices.DeleteFunc(o.Tags, func(t string) bool {
+				return t == tag
+			})
+		}
+
+		tags = o.Tags
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range mm.getMultiBackendsWithName(mb.GetName()) {
+		err := b.SetTags(slices.Clone(tags))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Only one proxy at a time changes the overrides, otherwise a change could be lost.
+func (mm *MultiManager) changeBackendOverride(name string, f func(o *data.BackendOverrideData) error) error {
+	lock, err := mm.tryLockRetry(backendOverridesLock)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	m, err := mm.getBackendOverrides()
+	if err != nil {
+		return err
+	}
+
+	o := m[name]
+	err = f(&o)
+	if err != nil {
+		return err
+	}
+
+	m[name] = o
+
+	err = lock.Check()
+	if err != nil {
+		return err
+	}
+
+	return mm.db.SetData(backendOverridesKey, m)
+}
+
+func (mm *MultiManager) getMultiBackendsWithName(name string) []*multi.Backend {
+	var l []*multi.Backend
+	for _, mb := range mm.GetAllMultiBackends() {
+		if mb.GetName() == name {
+			l = append(l, mb)
+		}
+	}
+
+	return l
+}
@@ -1,10 +1,9 @@
 package manager
 
 import (
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
@@ -12,57 +11,63 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-func (mm *MultiManager) createPartyUpdateListener() func(msg *redis.Message) {
-	return func(msg *redis.Message) {
-		m := msg.Payload
-		s := strings.Split(m, "_")
-		if len(s) != 3 {
-			mm.l.Warn("multiparty update channel received message with incorrect length", "message", m)
+func (mm *MultiManager) createPartyUpdateListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
+		um, err := multi.ParseUpdateMessage(msg.Payload)
+		if err != nil {
+			mm.l.Warn("multiparty update channel received incorrect message", "message", msg.Payload, "error", err)
 			return
 		}
 
-		originProxy := s[0]
 		// from own proxy, no update needed
-		if mm.ownerMP.GetId().String() == originProxy {
-			return
-		}
-
-		id, err := uuid.Parse(s[1])
-		if err != nil {
-			mm.l.Error("multiparty update channel parse uuid error", "parsed uuid", s[1], "error", err)
+		if um.Origin == mm.ownerMP.GetId() {
 			return
 		}
 
-		k := s[2]
-
-		mp, err := mm.GetMultiParty(id)
+		mp, err := mm.GetMultiParty(um.Id)
 		if err != nil {
-			mm.l.Error("multiparty update channel get multiparty error", "partyId", id, "error", err)
+			mm.l.Error("multiparty update channel get multiparty error", "partyId", um.Id, "error", err)
 			return
 		}
 
-		mm.l.Debug("received backend update request", "originProxyId", originProxy, "partyId", id, "key", k)
+		mm.l.Debug("received party update request", "originProxyId", um.Origin, "partyId", um.Id, "action", um.Action, "keys", um.Keys)
 
+		switch um.Action {
 		// already created
-		if k == "new" {
+		case multi.UpdateAction_New:
 			return
-		}
-
-		if k == "delete" {
-			err := mm.deleteMultiParty(id, false)
+		case multi.UpdateAction_Delete:
+			err := mm.deleteMultiParty(um.Id, false)
 			if err != nil {
-				mm.l.Error("multiparty update channel delete multiparty error", "partyId", id, "error", err)
+				mm.l.Error("multiparty update channel delete multiparty error", "partyId", um.Id, "error", err)
 			}
 			return
 		}
 
-		dataKey, err := key.GetPartyKey(k)
-		if err != nil {
-			mm.l.Error("multiparty update channel get data key error", "partyId", id, "key", k, "error", err)
-			return
-		}
+		for _, k := range um.Keys {
+			dataKey, err := key.GetPartyKey(k)
+			if err != nil {
+				mm.l.Error("multiparty update channel get data key error", "partyId", um.Id, "key", k, "error", err)
+				continue
+			}
+
+			if !mm.uv.accept(um.Origin, um.Id, k, um.Version) {
+				mm.l.Debug("multiparty update channel dropped outdated update", "partyId", um.Id, "origin", um.Origin, "key", k, "version", um.Version)
+				continue
+			}
 
-		mp.Update(dataKey)
+			// no value in the message, read it from the database
+			val, ok := um.Values[k]
+			if !ok {
+				mp.Update(dataKey)
+				continue
+			}
+
+			err = mp.Apply(dataKey, val)
+			if err != nil {
+				mm.l.Error("multiparty update channel apply value error", "partyId", um.Id, "key", k, "error", err)
+			}
+		}
 	}
 }
 
@@ -106,8 +111,12 @@ func (mm *MultiManager) NewMultiParty(ownerPlayer uuid.UUID) (*multi.Party, erro
 		return nil, err
 	}
 
-	m := mm.ownerMP.GetId().String() + "_" + id.String() + "_new"
-	err = mm.db.Publish(multi.UpdateMultiPartyChannel, m)
+	m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_New)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mm.db.PublishDurable(multi.UpdateMultiPartyChannel, m)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +164,7 @@ func (mm *MultiManager) deleteMultiParty(partyId uuid.UUID, first bool) error {
 	mm.mu.Lock()
 	delete(mm.partyMap, mp.GetId())
 	mm.mu.Unlock()
+	mm.uv.forget(mp.GetId())
 
 	if first {
 		err = mm.db.DeletePartyData(mp.GetId())
@@ -162,8 +172,12 @@ func (mm *MultiManager) deleteMultiParty(partyId uuid.UUID, first bool) error {
 			return err
 		}
 
-		m := mm.ownerMP.GetId().String() + "_" + mp.GetId().String() + "_delete"
-		err = mm.db.Publish(multi.UpdateMultiPartyChannel, m)
+		m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), mp.GetId(), multi.UpdateAction_Delete)
+		if err != nil {
+			return err
+		}
+
+		err = mm.db.PublishDurable(multi.UpdateMultiPartyChannel, m)
 		if err != nil {
 			return err
 		}
@@ -213,21 +227,42 @@ func (mm *MultiManager) GetAllMultiParties() []*multi.Party {
 }
 
 func (mm *MultiManager) GetAllMultiPartiesFromDatabase() ([]*multi.Party, error) {
-	var l []*multi.Party
+	// a moment behind is fine, the updates of the loaded parties are received
+	s := mm.db.Stale()
+	i, err := s.GetAllPartyIds()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the parties that are not loaded yet are read from the database, all in one go
+	mm.mu.RLock()
+	missing := slices.DeleteFunc(slices.Clone(i), func(id uuid.UUID) bool {
+		_, ok := mm.partyMap[id]
+		return ok
+	})
+	mm.mu.RUnlock()
 
-	i, err := mm.db.GetAllPartyIds()
+	datas, err := s.GetPartyDatas(missing)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range i {
-		mp, err := mm.GetMultiParty(id)
-		if err != nil {
-			return nil, err
+	var l []*multi.Party
+
+	mm.mu.Lock()
+	for id, data := range datas {
+		if _, ok := mm.partyMap[id]; !ok {
+			mm.partyMap[id] = multi.NewParty(id, mm.ownerMP.GetId(), mm.l, mm.db, data)
 		}
+	}
 
-		l = append(l, mp)
+	for _, id := range i {
+		mp, ok := mm.partyMap[id]
+		if ok {
+			l = append(l, mp)
+		}
 	}
+	mm.mu.Unlock()
 
 	return l, nil
 }
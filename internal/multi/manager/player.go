@@ -1,10 +1,10 @@
 package manager
 
 import (
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
@@ -12,48 +12,70 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-func (mm *MultiManager) createPlayerUpdateListener() func(msg *redis.Message) {
-	return func(msg *redis.Message) {
-		m := msg.Payload
-		s := strings.Split(m, "_")
-		if len(s) != 3 {
-			mm.l.Warn("multiplayer update channel received message with incorrect length", "message", m)
+func (mm *MultiManager) createPlayerUpdateListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
+		um, err := multi.ParseUpdateMessage(msg.Payload)
+		if err != nil {
+			mm.l.Warn("multiplayer update channel received incorrect message", "message", msg.Payload, "error", err)
 			return
 		}
 
-		originProxy := s[0]
 		// from own proxy, no update needed
-		if mm.ownerMP.GetId().String() == originProxy {
+		if um.Origin == mm.ownerMP.GetId() {
 			return
 		}
 
-		id, err := uuid.Parse(s[1])
-		if err != nil {
-			mm.l.Error("multiplayer update channel parse uuid error", "parsed uuid", s[1], "error", err)
+		// players that are not loaded get their data from the database when they are needed.
+		// players coming online are loaded, online players are always kept.
+		_, loaded := mm.pc.peek(um.Id)
+		if !loaded && um.Action != multi.UpdateAction_New && !slices.Contains(um.Keys, key.PlayerKey_Online.String()) {
 			return
 		}
 
-		k := s[2]
-
-		mp, err := mm.GetMultiPlayer(id)
+		mp, err := mm.GetMultiPlayer(um.Id)
 		if err != nil {
-			mm.l.Error("multiplayer update channel get multiplayer error", "playerId", id, "error", err)
+			mm.l.Error("multiplayer update channel get multiplayer error", "playerId", um.Id, "error", err)
 			return
 		}
 
-		mm.l.Debug("received player update request", "originProxyId", originProxy, "playerId", id, "key", k)
+		mm.l.Debug("received player update request", "originProxyId", um.Origin, "playerId", um.Id, "action", um.Action, "keys", um.Keys)
 
-		if k == "new" {
+		switch um.Action {
+		// already created
+		case multi.UpdateAction_New:
 			return
 		}
 
-		dataKey, err := key.GetPlayerKey(k)
-		if err != nil {
-			mm.l.Error("multiplayer update channel get data key error", "playerId", id, "key", k, "error", err)
-			return
-		}
+		for _, k := range um.Keys {
+			dataKey, err := key.GetPlayerKey(k)
+			if err != nil {
+				mm.l.Error("multiplayer update channel get data key error", "playerId", um.Id, "key", k, "error", err)
+				continue
+			}
+
+			if !mm.uv.accept(um.Origin, um.Id, k, um.Version) {
+				mm.l.Debug("multiplayer update channel dropped outdated update", "playerId", um.Id, "origin", um.Origin, "key", k, "version", um.Version)
+				continue
+			}
 
-		mp.Update(dataKey)
+			// no value in the message, read it from the database
+			val, ok := um.Values[k]
+			if !ok {
+				mp.Update(dataKey)
+				continue
+			}
+
+			err = mp.Apply(dataKey, val)
+			if err != nil {
+				mm.l.Error("multiplayer update channel apply value error", "playerId", um.Id, "key", k, "error", err)
+				continue
+			}
+
+			// known before the next presence refresh
+			if dataKey == key.PlayerKey_Online {
+				mm.pm.set(um.Id, mp.IsSavedOnline())
+			}
+		}
 	}
 }
 
@@ -93,14 +115,23 @@ func (mm *MultiManager) NewMultiPlayer(p proxy.Player) (*multi.Player, error) {
 		return nil, err
 	}
 
+	err = mm.db.SetPlayerUsernameIndex(id, "", p.Username())
+	if err != nil {
+		return nil, err
+	}
+
 	mp, err := mm.CreateMultiPlayerFromDatabase(id)
 	if err != nil {
 		return nil, err
 	}
 
 	// update every proxies' map
-	m := mm.ownerMP.GetId().String() + "_" + id.String() + "_new"
-	err = mm.db.Publish(multi.UpdateMultiPlayerChannel, m)
+	m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_New)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mm.db.PublishDurable(multi.UpdateMultiPlayerChannel, m)
 	if err != nil {
 		return nil, err
 	}
@@ -112,16 +143,13 @@ func (mm *MultiManager) NewMultiPlayer(p proxy.Player) (*multi.Player, error) {
 /*
 Gets a multiplayer in two ways:
 
-1. Use the map with all multiplayers.
-This method will be used the most since all existing players are in the map located.
+1. Use the cache with the loaded multiplayers.
+This method will be used the most since all online players are always in the cache.
 
-2. Create a new multiplayer based on the player data from the database.
+2. Create a new multiplayer based on the player data from the database and add it to the cache.
 */
 func (mm *MultiManager) GetMultiPlayer(id uuid.UUID) (*multi.Player, error) {
-	mm.mu.RLock()
-	mp, ok := mm.playerMap[id]
-	mm.mu.RUnlock()
-
+	mp, ok := mm.pc.get(id)
 	if ok {
 		return mp, nil
 	}
@@ -136,20 +164,30 @@ func (mm *MultiManager) CreateMultiPlayerFromDatabase(id uuid.UUID) (*multi.Play
 		return nil, err
 	}
 
-	mp := multi.NewPlayer(id, mm.ownerMP.GetId(), mm.l, mm.db, data)
-
-	mm.mu.Lock()
-	mm.playerMap[id] = mp
-	mm.mu.Unlock()
+	mp, evicted := mm.pc.add(multi.NewPlayer(id, mm.ownerMP.GetId(), mm.l, mm.db, data))
+	for _, id := range evicted {
+		mm.uv.forget(id)
+	}
 
 	return mp, nil
 }
 
+// Gets the multiplayer with the username, ignoring case. Also finds offline players.
+// Returns database.ErrDataNotFound if no player ever joined with the username.
+func (mm *MultiManager) GetMultiPlayerByName(name string) (*multi.Player, error) {
+	id, err := mm.db.GetPlayerIdByUsername(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return mm.GetMultiPlayer(id)
+}
+
+// Only returns the loaded multiplayers, which are all online players and recently used offline players.
 func (mm *MultiManager) GetAllMultiPlayers(includeVanished bool) []*multi.Player {
 	var l []*multi.Player
 
-	mm.mu.RLock()
-	for _, mp := range mm.playerMap {
+	for _, mp := range mm.pc.all() {
 		if !includeVanished {
 			if !mp.IsVanished() {
 				l = append(l, mp)
@@ -158,54 +196,112 @@ func (mm *MultiManager) GetAllMultiPlayers(includeVanished bool) []*multi.Player
 			l = append(l, mp)
 		}
 	}
-	mm.mu.RUnlock()
 
 	return l
 }
 
 func (mm *MultiManager) ConvertPlayerIdListToMultiPlayers(ids []uuid.UUID) ([]*multi.Player, error) {
-	var l []*multi.Player
+	return mm.GetMultiPlayers(ids)
+}
 
-	for _, id := range ids {
-		mp, err := mm.GetMultiPlayer(id)
-		if err != nil {
-			return nil, err
-		}
+// Gets the multiplayers in the same order as the ids. Players that are not loaded are loaded together in one go.
+// Returns database.ErrDataNotFound if a player has never joined before.
+func (mm *MultiManager) GetMultiPlayers(ids []uuid.UUID) ([]*multi.Player, error) {
+	l, missing, err := mm.getMultiPlayers(mm.db, ids)
+	if err != nil {
+		return nil, err
+	}
 
-		l = append(l, mp)
+	if len(missing) > 0 {
+		return nil, database.ErrDataNotFound
 	}
 
 	return l, nil
 }
 
-func (mm *MultiManager) GetAllMultiPlayersFromDatabase() ([]*multi.Player, error) {
-	var l []*multi.Player
+// Gets the multiplayers that are found, in the same order as the ids. Also returns the ids of the players that have never joined before.
+func (mm *MultiManager) GetFoundMultiPlayers(ids []uuid.UUID) ([]*multi.Player, []uuid.UUID, error) {
+	return mm.getMultiPlayers(mm.db, ids)
+}
 
-	i, err := mm.db.GetAllPlayerIds()
+// The players that are not loaded are read from s. The ids without player data are left out and returned.
+func (mm *MultiManager) getMultiPlayers(s database.Storage, ids []uuid.UUID) ([]*multi.Player, []uuid.UUID, error) {
+	l := make([]*multi.Player, len(ids))
+
+	var unloaded []uuid.UUID
+	for i, id := range ids {
+		mp, ok := mm.pc.get(id)
+		if !ok {
+			unloaded = append(unloaded, id)
+			continue
+		}
+
+		l[i] = mp
+	}
+
+	if len(unloaded) == 0 {
+		return l, nil, nil
+	}
+
+	datas, err := s.GetPlayerDatas(unloaded)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	for _, id := range i {
-		mp, err := mm.GetMultiPlayer(id)
-		if err != nil {
-			return nil, err
+	found := make([]*multi.Player, 0, len(ids))
+	var missing []uuid.UUID
+	for i, id := range ids {
+		if l[i] != nil {
+			found = append(found, l[i])
+			continue
+		}
+
+		data, ok := datas[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+
+		mp, evicted := mm.pc.add(multi.NewPlayer(id, mm.ownerMP.GetId(), mm.l, mm.db, data))
+		for _, id := range evicted {
+			mm.uv.forget(id)
 		}
 
-		l = append(l, mp)
+		found = append(found, mp)
 	}
 
-	return l, nil
+	return found, missing, nil
+}
+
+// Loads the players that are present, so all online players are in the cache.
+// A moment behind is fine, the updates of the loaded players are received.
+func (mm *MultiManager) loadOnlineMultiPlayers() ([]*multi.Player, error) {
+	return mm.getOnlineMultiPlayers()
 }
 
+// Returns the players that are present in the network. Players that are not loaded yet are loaded.
 func (mm *MultiManager) GetAllOnlinePlayers(includeVanished bool) []*multi.Player {
-	var l []*multi.Player
+	players, err := mm.getOnlineMultiPlayers()
+	if err != nil {
+		mm.l.Warn("get all online multiplayers error", "error", err)
+	}
 
-	for _, mp := range mm.GetAllMultiPlayers(includeVanished) {
-		if mp.IsOnline() {
+	var l []*multi.Player
+	for _, mp := range players {
+		if mp.IsOnline() && (includeVanished || !mp.IsVanished()) {
 			l = append(l, mp)
 		}
 	}
 
 	return l
 }
+
+// A present player without player data, for example when the data was deleted, is left out so the other players are still returned.
+func (mm *MultiManager) getOnlineMultiPlayers() ([]*multi.Player, error) {
+	players, missing, err := mm.getMultiPlayers(mm.db.Stale(), mm.pm.all())
+	if len(missing) > 0 {
+		mm.l.Warn("present players without player data skipped", "playerIds", missing)
+	}
+
+	return players, err
+}
@@ -0,0 +1,262 @@
+package manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Keeps which players are online in the network. Every interval, the presence of the players on this proxy is set again
+// and the presence of all players is read. The presence of players on a crashed proxy expires after the ttl.
+// The reconciler fixes the saved online value of players, which can't be trusted after a crash.
+type presenceManager struct {
+	ids map[uuid.UUID]struct{}
+	mu  sync.RWMutex
+
+	// returns the players connected to this proxy
+	source func() []uuid.UUID
+
+	t  *time.Ticker
+	rt *time.Ticker
+	d  chan bool
+	mm *MultiManager
+
+	ttl time.Duration
+}
+
+// Only one proxy at a time fixes the saved online values.
+const presenceReconcilerLock = "presence_reconciler"
+
+func (mm *MultiManager) initPresenceManager() *presenceManager {
+	pm := &presenceManager{
+		ids: make(map[uuid.UUID]struct{}),
+		t:   time.NewTicker(mm.cf.GetLivenessInterval()),
+		rt:  time.NewTicker(mm.cf.GetPresenceReconcileInterval()),
+		d:   make(chan bool),
+		mm:  mm,
+		ttl: mm.cf.GetLivenessTTL(),
+	}
+
+	pm.source = mm.ownerMP.GetPlayerIds
+	return pm
+}
+
+func (pm *presenceManager) start() {
+	pm.refresh()
+
+	go func() {
+		for {
+			select {
+			case <-pm.d:
+				return
+			case <-pm.t.C:
+				pm.refresh()
+			case <-pm.rt.C:
+				go pm.reconcile()
+			}
+		}
+	}()
+}
+
+func (pm *presenceManager) stop() {
+	pm.t.Stop()
+	pm.rt.Stop()
+	pm.d <- true
+}
+
+// Sets the presence of the players on this proxy and reads the presence of all players.
+func (pm *presenceManager) refresh() {
+	pm.mu.RLock()
+	source := pm.source
+	pm.mu.RUnlock()
+
+	own := source()
+	err := pm.mm.db.SetPresence(own, pm.ttl)
+	if err != nil {
+		pm.mm.l.Warn("presence manager set presence error", "error", err)
+	}
+
+	l, err := pm.mm.db.GetPresentPlayerIds()
+	if err != nil {
+		// the last known presence is kept
+		pm.mm.l.Warn("presence manager get presence error", "error", err)
+		return
+	}
+
+	ids := make(map[uuid.UUID]struct{}, len(l)+len(own))
+	for _, id := range l {
+		ids[id] = struct{}{}
+	}
+	for _, id := range own {
+		ids[id] = struct{}{}
+	}
+
+	pm.mu.Lock()
+	pm.ids = ids
+	pm.mu.Unlock()
+}
+
+func (pm *presenceManager) isPresent(id uuid.UUID) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	_, ok := pm.ids[id]
+	return ok
+}
+
+func (pm *presenceManager) all() []uuid.UUID {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	l := make([]uuid.UUID, 0, len(pm.ids))
+	for id := range pm.ids {
+		l = append(l, id)
+	}
+
+	return l
+}
+
+// Changes the local presence, used when an update about the player arrives before the next refresh.
+func (pm *presenceManager) set(id uuid.UUID, online bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if online {
+		pm.ids[id] = struct{}{}
+	} else {
+		delete(pm.ids, id)
+	}
+}
+
+// Sets the saved online value to the presence of the player.
+func (pm *presenceManager) reconcile() {
+	lock, err := pm.mm.db.TryLock(presenceReconcilerLock, 30*time.Second)
+	if err != nil {
+		if err != database.ErrLockHeld {
+			pm.mm.l.Warn("could not acquire presence reconciler lock", "error", err)
+		}
+		return
+	}
+	defer lock.Release()
+
+	now := time.Now()
+
+	_, err = pm.mm.db.RemoveExpiredPresence()
+	if err != nil {
+		return
+	}
+
+	present, err := pm.mm.db.GetPresentPlayerIds()
+	if err != nil {
+		return
+	}
+
+	saved, err := pm.mm.db.GetOnlinePlayerIds()
+	if err != nil {
+		return
+	}
+
+	p := make(map[uuid.UUID]bool, len(present))
+	for _, id := range present {
+		p[id] = true
+	}
+
+	s := make(map[uuid.UUID]bool, len(saved))
+	for _, id := range saved {
+		s[id] = true
+	}
+
+	fixed := 0
+	for id := range s {
+		if p[id] {
+			continue
+		}
+
+		if pm.fix(lock, id, false, now) {
+			fixed++
+		}
+	}
+
+	for id := range p {
+		if s[id] {
+			continue
+		}
+
+		if pm.fix(lock, id, true, now) {
+			fixed++
+		}
+	}
+
+	pm.mm.l.Debug("presence reconciled", "present", len(present), "saved", len(saved), "fixed", fixed, "duration", time.Since(now))
+}
+
+// Returns if the saved online value has been changed.
+func (pm *presenceManager) fix(lock *database.Lock, id uuid.UUID, online bool, now time.Time) bool {
+	err := lock.Check()
+	if err != nil {
+		return false
+	}
+
+	// the presence and the saved values are read apart, the player could have joined or left in between
+	present, err := pm.mm.db.IsPresent(id)
+	if err != nil {
+		pm.mm.l.Warn("presence reconciler get presence error", "playerId", id, "error", err)
+		return false
+	}
+
+	if present != online {
+		return false
+	}
+
+	mp, err := pm.mm.GetMultiPlayer(id)
+	if err != nil {
+		pm.mm.l.Warn("presence reconciler get multiplayer error", "playerId", id, "error", err)
+		return false
+	}
+
+	pm.mm.l.Info("presence reconciler fixing saved online value", "playerId", id, "online", online)
+	err = mp.SetOnline(online)
+	if err != nil {
+		pm.mm.l.Warn("presence reconciler set online error", "playerId", id, "error", err)
+		return false
+	}
+
+	if !online {
+		err = mp.SetLastSeen(&now)
+		if err != nil {
+			pm.mm.l.Warn("presence reconciler set last seen error", "playerId", id, "error", err)
+		}
+	}
+
+	return true
+}
+
+// Returns if the player is online somewhere in the network.
+func (mm *MultiManager) IsPlayerPresent(id uuid.UUID) bool {
+	// not started yet while the own multiproxy is created
+	if mm.pm == nil {
+		return false
+	}
+
+	return mm.pm.isPresent(id)
+}
+
+// Sets the function returning the players that are connected to this proxy. By default, the players of the own multiproxy are used.
+func (mm *MultiManager) SetPresenceSource(f func() []uuid.UUID) {
+	mm.pm.mu.Lock()
+	mm.pm.source = f
+	mm.pm.mu.Unlock()
+}
+
+// Marks the player of this proxy as online or offline right away, instead of waiting for the next refresh.
+func (mm *MultiManager) SetPlayerPresence(id uuid.UUID, online bool) error {
+	mm.pm.set(id, online)
+
+	if online {
+		return mm.db.SetPresence([]uuid.UUID{id}, mm.pm.ttl)
+	}
+
+	return mm.db.RemovePresence(id)
+}
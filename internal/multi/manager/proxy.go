@@ -1,12 +1,13 @@
 package manager
 
 import (
+	"crypto/sha1"
+	"errors"
 	"fmt"
 	"math"
-	"strings"
+	"slices"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/team-vesperis/vesperis-mp/internal/config"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
@@ -15,77 +16,88 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-func (mm *MultiManager) createProxyUpdateListener() func(msg *redis.Message) {
-	return func(msg *redis.Message) {
-		m := msg.Payload
-		s := strings.Split(m, "_")
-		if len(s) != 3 {
-			mm.l.Warn("multiproxy update channel received message with incorrect length", "message", m)
+func (mm *MultiManager) createProxyUpdateListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
+		um, err := multi.ParseUpdateMessage(msg.Payload)
+		if err != nil {
+			mm.l.Warn("multiproxy update channel received incorrect message", "message", msg.Payload, "error", err)
 			return
 		}
 
-		originProxy := s[0]
 		// from own proxy, no update needed
-		if mm.ownerMP.GetId().String() == originProxy {
+		if um.Origin == mm.ownerMP.GetId() {
 			return
 		}
 
-		id, err := uuid.Parse(s[1])
-		if err != nil {
-			mm.l.Error("multiproxy update channel parse uuid error", "parsed uuid", s[1], "error", err)
+		// a named proxy that restarted has new data under the same id
+		if um.Action == multi.UpdateAction_New {
+			mm.uv.forget(um.Id)
+			_, err := mm.CreateMultiProxyFromDatabase(um.Id)
+			if err != nil {
+				mm.l.Error("multiproxy update channel create multiproxy error", "proxyId", um.Id, "error", err)
+			}
 			return
 		}
 
-		k := s[2]
-
-		mp, err := mm.GetMultiProxy(id)
+		mp, err := mm.GetMultiProxy(um.Id)
 		if err != nil {
-			mm.l.Error("multiproxy update channel get multiproxy error", "proxyId", id, "error", err)
+			mm.l.Error("multiproxy update channel get multiproxy error", "proxyId", um.Id, "error", err)
 			return
 		}
 
-		mm.l.Debug("received proxy update request", "originProxyId", originProxy, "key", k)
+		mm.l.Debug("received proxy update request", "originProxyId", um.Origin, "proxyId", um.Id, "action", um.Action, "keys", um.Keys)
 
-		// already created
-		if k == "new" {
+		switch um.Action {
+		case multi.UpdateAction_Delete:
+			err := mm.deleteMultiProxy(um.Id, false, nil)
+			if err != nil {
+				mm.l.Error("multiproxy update channel delete multiproxy error", "proxyId", um.Id, "error", err)
+			}
 			return
 		}
 
-		if k == "delete" {
-			err := mm.deleteMultiProxy(id, false)
+		for _, k := range um.Keys {
+			dataKey, err := key.GetProxyKey(k)
 			if err != nil {
-				mm.l.Error("multiproxy update channel delete multiproxy error", "proxyId", id, "error", err)
+				mm.l.Error("multiproxy update channel get data key error", "proxyId", um.Id, "key", k, "error", err)
+				continue
 			}
-			return
-		}
 
-		dataKey, err := key.GetProxyKey(k)
-		if err != nil {
-			mm.l.Error("multiproxy update channel get data key error", "proxyId", id, "key", k, "error", err)
-			return
-		}
+			if !mm.uv.accept(um.Origin, um.Id, k, um.Version) {
+				mm.l.Debug("multiproxy update channel dropped outdated update", "proxyId", um.Id, "origin", um.Origin, "key", k, "version", um.Version)
+				continue
+			}
 
-		mp.Update(dataKey)
+			// no value in the message, read it from the database
+			val, ok := um.Values[k]
+			if !ok {
+				mp.Update(dataKey)
+				continue
+			}
+
+			err = mp.Apply(dataKey, val)
+			if err != nil {
+				mm.l.Error("multiproxy update channel apply value error", "proxyId", um.Id, "key", k, "error", err)
+			}
+		}
 	}
 }
 
+var ErrProxyNameInUse = errors.New("proxy name in use by another running proxy")
+
 func (mm *MultiManager) NewMultiProxy() (*multi.Proxy, error) {
 	now := time.Now()
 
+	name := mm.cf.GetProxyName()
+
 	var id uuid.UUID
+	var previous *data.ProxyData
 	var err error
-	for {
-		id = uuid.New()
-		_, err = mm.GetMultiBackend(id)
-		if err == nil {
-			continue
-		}
-
-		if err == database.ErrDataNotFound {
-			err = nil
-		}
-
-		break
+	if name != "" {
+		id = proxyIdFromName(name)
+		previous, err = mm.claimProxyId(id, name)
+	} else {
+		id, err = mm.newProxyId()
 	}
 
 	if err != nil {
@@ -98,12 +110,18 @@ func (mm *MultiManager) NewMultiProxy() (*multi.Proxy, error) {
 	case config.Mode_Default:
 		addr = mm.cf.GetBind()
 	case config.Mode_Kubernetes:
-		addr = fmt.Sprintf("%s.proxy.default.svc.cluster.local:25565", id.String())
+		host := name
+		if host == "" {
+			host = id.String()
+		}
+
+		addr = fmt.Sprintf("%s.%s.%s.svc.%s:%d", host, mm.cf.GetKubernetesService(), mm.cf.GetKubernetesNamespace(), mm.cf.GetKubernetesClusterDomain(), mm.cf.GetKubernetesPort())
 	default:
 		return nil, config.ErrIncorrectMode
 	}
 
-	data := &data.ProxyData{
+	pd := &data.ProxyData{
+		Name:          name,
 		Address:       addr,
 		Maintenance:   false,
 		Backends:      make([]uuid.UUID, 0),
@@ -111,7 +129,13 @@ func (mm *MultiManager) NewMultiProxy() (*multi.Proxy, error) {
 		LastHeartBeat: &now,
 	}
 
-	err = mm.db.SetProxyData(id, data)
+	// cleared below, after the multiproxy exists
+	if previous != nil {
+		pd.Backends = previous.Backends
+		pd.Players = previous.Players
+	}
+
+	err = mm.db.SetProxyData(id, pd)
 	if err != nil {
 		return nil, err
 	}
@@ -125,36 +149,258 @@ func (mm *MultiManager) NewMultiProxy() (*multi.Proxy, error) {
 		mm.ownerMP = mp
 	}
 
-	// update every proxies' map
-	m := mm.ownerMP.GetId().String() + "_" + id.String() + "_new"
-	err = mm.db.Publish(multi.UpdateMultiProxyChannel, m)
+	// update every proxies' map, proxies that still know the previous run read the data again
+	m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_New)
 	if err != nil {
 		return nil, err
 	}
 
-	mm.l.Info("created new multiproxy", "proxyId", id, "duration", time.Since(now))
+	err = mm.db.PublishDurable(multi.UpdateMultiProxyChannel, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		mm.l.Info("reclaimed multiproxy of previous run", "proxyId", id, "proxyName", name, "backendIds", previous.Backends, "playerIds", previous.Players)
+		// without a lock there is no lock to lose, so no error is returned
+		mm.clearMultiProxy(mp, now, nil)
+	}
+
+	mm.l.Info("created new multiproxy", "proxyId", id, "proxyName", mp.GetName(), "duration", time.Since(now))
 	return mp, nil
 }
 
+func (mm *MultiManager) newProxyId() (uuid.UUID, error) {
+	for {
+		id := uuid.New()
+		_, err := mm.db.GetProxyData(id)
+		if err == nil {
+			continue
+		}
+
+		if err == database.ErrDataNotFound {
+			return id, nil
+		}
+
+		return uuid.Nil, err
+	}
+}
+
+// The id of a named proxy is derived from its name, so it stays the same after a restart.
+func proxyIdFromName(name string) uuid.UUID {
+	h := sha1.Sum([]byte("vesperis-mp:proxy:" + name))
+
+	var id uuid.UUID
+	copy(id[:], h[:16])
+
+	// version 5, name based
+	id[6] = (id[6] & 0x0f) | 0x50
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id
+}
+
+// Takes over the id of a named proxy. A proxy that crashed could still have an alive key, so it is given the ttl to expire.
+// Returns the data of the previous run, nil if there is none.
+func (mm *MultiManager) claimProxyId(id uuid.UUID, name string) (*data.ProxyData, error) {
+	deadline := time.Now().Add(mm.cf.GetLivenessTTL() + mm.cf.GetLivenessInterval())
+	for {
+		claimed, err := mm.trySetProxyAlive(id, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if claimed {
+			break
+		}
+
+		// the key is still set by another proxy
+		if time.Now().After(deadline) {
+			mm.l.Error("proxy name is used by another running proxy", "proxyName", name, "proxyId", id)
+			return nil, ErrProxyNameInUse
+		}
+
+		mm.l.Info("waiting for alive key of previous run to expire", "proxyName", name, "proxyId", id)
+		time.Sleep(mm.cf.GetLivenessInterval())
+	}
+
+	previous, err := mm.db.GetProxyData(id)
+	if err == database.ErrDataNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the updates sent while the proxy was stopped are not needed, all data is loaded again
+	for _, channel := range updateChannels {
+		err := mm.db.DeleteDurableConsumer(channel, id.String())
+		if err != nil {
+			mm.l.Warn("delete previous multiproxy update consumer error", "proxyId", id, "channel", channel, "error", err)
+		}
+	}
+
+	return previous, nil
+}
+
+// Sets the alive key of the id when it is not set, so of two proxies starting with the same name only one gets the id.
+// It is set right away, so other proxies don't delete the record as crashed proxy while it is taken over.
+func (mm *MultiManager) trySetProxyAlive(id uuid.UUID, name string) (bool, error) {
+	// the cleanup lock is taken while setting the alive key, so a running cleanup finishes first.
+	// Taking the lock also raises the fence, a cleanup that lost its lock can't delete the taken over record anymore.
+	lock, err := mm.lockProxyCleanup(name, id)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Release()
+
+	return mm.db.SetAliveIfAbsent(proxyAliveKey(id), mm.cf.GetLivenessTTL())
+}
+
+// Waits for the cleanup of crashed proxies to finish and takes its lock.
+func (mm *MultiManager) lockProxyCleanup(name string, id uuid.UUID) (*database.Lock, error) {
+	deadline := time.Now().Add(proxyCleanupTTL)
+	for {
+		lock, err := mm.db.TryLock(proxyCleanupLock, 5*time.Second)
+		if err != database.ErrLockHeld {
+			return lock, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+
+		mm.l.Debug("waiting for crashed proxy cleanup to finish", "proxyName", name, "proxyId", id)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Removes the backends and players of a proxy that stopped without closing.
+// With a lock, every write is only done while the lock is held. Returns database.ErrLockLost when the lock is lost,
+// the rest is left for the proxy that holds the lock now.
+func (mm *MultiManager) clearMultiProxy(mp *multi.Proxy, now time.Time, lock *database.Lock) error {
+	check := func() error {
+		if lock == nil {
+			return nil
+		}
+
+		return lock.Check()
+	}
+
+	for _, b_id := range mp.GetBackendsIds() {
+		err := mm.deleteMultiBackend(b_id, true, lock)
+		if err == database.ErrLockLost {
+			return err
+		}
+
+		if err != nil {
+			mm.l.Warn("clear multiproxy delete multibackend error", "proxyId", mp.GetId(), "backendId", b_id, "error", err)
+		}
+	}
+
+	for _, p_id := range mp.GetPlayerIds() {
+		p, err := mm.GetMultiPlayer(p_id)
+		if err != nil {
+			mm.l.Warn("clear multiproxy get multiplayer error", "proxyId", mp.GetId(), "playerId", p_id, "error", err)
+			continue
+		}
+
+		// already on another proxy
+		if p.GetProxy() != nil && p.GetProxy() != mp {
+			continue
+		}
+
+		err = check()
+		if err == database.ErrLockLost {
+			return err
+		}
+
+		err = p.SetProxy(nil)
+		if err != nil {
+			mm.l.Warn("clear multiproxy set multiplayer's proxy error", "playerId", p_id, "error", err)
+		}
+
+		if p.IsSavedOnline() {
+			err = check()
+			if err == database.ErrLockLost {
+				return err
+			}
+
+			err = p.SetOnline(false)
+			if err != nil {
+				mm.l.Warn("clear multiproxy set multiplayer's online error", "playerId", p_id, "error", err)
+			}
+		}
+
+		err = check()
+		if err == database.ErrLockLost {
+			return err
+		}
+
+		err = p.SetLastSeen(&now)
+		if err != nil {
+			mm.l.Warn("clear multiproxy set multiplayer's last seen error", "playerId", p_id, "error", err)
+		}
+	}
+
+	// players on another proxy are not removed from the list above
+	if len(mp.GetPlayerIds()) > 0 {
+		err := check()
+		if err == database.ErrLockLost {
+			return err
+		}
+
+		err = mp.SetPlayerIds(make([]uuid.UUID, 0))
+		if err != nil {
+			mm.l.Warn("clear multiproxy set player ids error", "proxyId", mp.GetId(), "error", err)
+		}
+	}
+
+	return nil
+}
+
 func (mm *MultiManager) DeleteMultiProxy(id uuid.UUID) error {
-	return mm.deleteMultiProxy(id, true)
+	return mm.deleteMultiProxy(id, true, nil)
 }
 
-func (mm *MultiManager) deleteMultiProxy(id uuid.UUID, first bool) error {
+// With a lock, the data is only deleted while the lock is held. The proxy is kept when the delete is rejected.
+func (mm *MultiManager) deleteMultiProxy(id uuid.UUID, first bool, lock *database.Lock) error {
 	now := time.Now()
 
+	if first {
+		var err error
+		if lock != nil {
+			err = mm.db.DeleteProxyDataFenced(id, lock)
+		} else {
+			err = mm.db.DeleteProxyData(id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
 	mm.mu.Lock()
 	delete(mm.proxyMap, id)
 	mm.mu.Unlock()
+	mm.uv.forget(id)
 
 	if first {
-		err := mm.db.DeleteProxyData(id)
+
+		// the proxy won't read the updates anymore
+		for _, channel := range updateChannels {
+			err := mm.db.DeleteDurableConsumer(channel, id.String())
+			if err != nil {
+				mm.l.Warn("delete multiproxy update consumer error", "proxyId", id, "channel", channel, "error", err)
+			}
+		}
+
+		m, err := multi.NewUpdateMessage(mm.ownerMP.GetId(), id, multi.UpdateAction_Delete)
 		if err != nil {
 			return err
 		}
 
-		m := mm.ownerMP.GetId().String() + "_" + id.String() + "_delete"
-		err = mm.db.Publish(multi.UpdateMultiProxyChannel, m)
+		err = mm.db.PublishDurable(multi.UpdateMultiProxyChannel, m)
 		if err != nil {
 			return err
 		}
@@ -198,6 +444,30 @@ func (mm *MultiManager) CreateMultiProxyFromDatabase(id uuid.UUID) (*multi.Proxy
 	return mp, nil
 }
 
+// Returns the proxy with the name, the name of a proxy without configured name is its id.
+func (mm *MultiManager) GetMultiProxyByName(name string) (*multi.Proxy, error) {
+	mm.mu.RLock()
+	for _, mp := range mm.proxyMap {
+		if mp.GetName() == name {
+			mm.mu.RUnlock()
+			return mp, nil
+		}
+	}
+	mm.mu.RUnlock()
+
+	return mm.GetMultiProxy(proxyIdFromName(name))
+}
+
+// The target can be the name or the id of a proxy.
+func (mm *MultiManager) FindMultiProxy(t string) (*multi.Proxy, error) {
+	id, err := uuid.Parse(t)
+	if err == nil {
+		return mm.GetMultiProxy(id)
+	}
+
+	return mm.GetMultiProxyByName(t)
+}
+
 func (mm *MultiManager) GetAllMultiProxies() []*multi.Proxy {
 	var l []*multi.Proxy
 
@@ -211,37 +481,70 @@ func (mm *MultiManager) GetAllMultiProxies() []*multi.Proxy {
 }
 
 func (mm *MultiManager) GetAllMultiProxiesFromDatabase() ([]*multi.Proxy, error) {
-	var l []*multi.Proxy
+	// a moment behind is fine, the updates of the loaded proxies are received
+	s := mm.db.Stale()
+	i, err := s.GetAllProxyIds()
+	if err != nil {
+		return nil, err
+	}
+
+	// only the proxies that are not loaded yet are read from the database, all in one go
+	mm.mu.RLock()
+	missing := slices.DeleteFunc(slices.Clone(i), func(id uuid.UUID) bool {
+		_, ok := mm.proxyMap[id]
+		return ok
+	})
+	mm.mu.RUnlock()
 
-	i, err := mm.db.GetAllProxyIds()
+	datas, err := s.GetProxyDatas(missing)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, id := range i {
-		mp, err := mm.GetMultiProxy(id)
-		if err != nil {
-			return nil, err
+	var l []*multi.Proxy
+
+	mm.mu.Lock()
+	for id, data := range datas {
+		if _, ok := mm.proxyMap[id]; !ok {
+			mm.proxyMap[id] = multi.NewProxy(id, mm.ownerMP.GetId(), mm.l, mm.db, mm.cf, data)
 		}
+	}
 
-		l = append(l, mp)
+	for _, id := range i {
+		mp, ok := mm.proxyMap[id]
+		if ok {
+			l = append(l, mp)
+		}
 	}
+	mm.mu.Unlock()
 
 	return l, nil
 }
 
+// Returns the proxies that new players can be sent to. Proxies in maintenance are left out.
+func (mm *MultiManager) GetAvailableMultiProxies(includingThisProxy bool) []*multi.Proxy {
+	var l []*multi.Proxy
+	for _, p := range mm.GetAllMultiProxies() {
+		if p.IsInMaintenance() {
+			continue
+		}
+
+		if !includingThisProxy && p == mm.ownerMP {
+			continue
+		}
+
+		l = append(l, p)
+	}
+
+	return l
+}
+
 // can return nil if no other proxy is found
 func (mm *MultiManager) GetProxyWithLowestPlayerCount(includingThisProxy bool) *multi.Proxy {
 	var count int = math.MaxUint32
 	var proxy *multi.Proxy
 
-	for _, p := range mm.proxyMap {
-		if !includingThisProxy {
-			if p == mm.ownerMP {
-				continue
-			}
-		}
-
+	for _, p := range mm.GetAvailableMultiProxies(includingThisProxy) {
 		c := len(p.GetPlayerIds())
 		if c < count {
 			proxy = p
@@ -249,9 +552,5 @@ func (mm *MultiManager) GetProxyWithLowestPlayerCount(includingThisProxy bool) *
 		}
 	}
 
-	if proxy == nil {
-		return nil
-	}
-
 	return proxy
 }
@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/key"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Remembers the version of the last applied update per origin and key, so updates that arrive out of order are dropped.
+// The versions are based on the clock of the origin, so they are never compared between origins.
+type updateVersions struct {
+	m  map[uuid.UUID]map[updateVersionKey]uint64
+	mu sync.Mutex
+}
+
+type updateVersionKey struct {
+	origin uuid.UUID
+	k      string
+}
+
+func newUpdateVersions() *updateVersions {
+	return &updateVersions{
+		m: make(map[uuid.UUID]map[updateVersionKey]uint64),
+	}
+}
+
+// Returns if the update is newer than the last applied update of the key sent by the same origin.
+// Messages in the old format have no version and are always applied.
+func (uv *updateVersions) accept(origin, id uuid.UUID, k string, version uint64) bool {
+	if version == 0 {
+		return true
+	}
+
+	uv.mu.Lock()
+	defer uv.mu.Unlock()
+
+	versions, ok := uv.m[id]
+	if !ok {
+		versions = make(map[updateVersionKey]uint64)
+		uv.m[id] = versions
+	}
+
+	vk := updateVersionKey{origin: origin, k: k}
+	if version <= versions[vk] {
+		return false
+	}
+
+	versions[vk] = version
+	return true
+}
+
+func (uv *updateVersions) forget(id uuid.UUID) {
+	uv.mu.Lock()
+	delete(uv.m, id)
+	uv.mu.Unlock()
+}
+
+// Applies every key of the data to the multi object.
+func applyData[K ~string](d any, keys []K, apply func(k K, val json.RawMessage) error) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]any
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		v, ok := valueAtPath(doc, string(k))
+		if !ok {
+			continue
+		}
+
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		err = apply(k, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func valueAtPath(doc map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := doc[part].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		doc = next
+	}
+
+	v, ok := doc[parts[len(parts)-1]]
+	return v, ok
+}
+
+// Reads everything that is loaded again from the database. Used after the database was unreachable.
+// The resyncs read from the primary, a replica that is behind would bring back old values and miss new data.
+func (mm *MultiManager) resync() {
+	mm.loadNetworkMaintenance()
+	mm.resyncProxies()
+	mm.resyncBackends()
+	mm.resyncParties()
+	mm.resyncPlayers()
+}
+
+// Reads every loaded multiplayer again from the database. Used when update messages have been lost.
+func (mm *MultiManager) resyncPlayers() {
+	now := time.Now()
+
+	for _, mp := range mm.GetAllMultiPlayers(true) {
+		d, err := mm.db.GetPlayerData(mp.GetId())
+		if err != nil {
+			mm.l.Warn("resync multiplayer get data error", "playerId", mp.GetId(), "error", err)
+			continue
+		}
+
+		err = applyData(d, key.AllowedPlayerKeys, mp.Apply)
+		if err != nil {
+			mm.l.Warn("resync multiplayer apply data error", "playerId", mp.GetId(), "error", err)
+		}
+	}
+
+	mm.l.Info("resynced multiplayers", "duration", time.Since(now))
+}
+
+// Reads every loaded multiparty again from the database. Deleted parties are removed.
+func (mm *MultiManager) resyncParties() {
+	now := time.Now()
+
+	for _, mp := range mm.GetAllMultiParties() {
+		d, err := mm.db.GetPartyData(mp.GetId())
+		if err == database.ErrDataNotFound {
+			err = mm.deleteMultiParty(mp.GetId(), false)
+			if err != nil {
+				mm.l.Warn("resync multiparty delete error", "partyId", mp.GetId(), "error", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			mm.l.Warn("resync multiparty get data error", "partyId", mp.GetId(), "error", err)
+			continue
+		}
+
+		err = applyData(d, key.AllowedPartyKeys, mp.Apply)
+		if err != nil {
+			mm.l.Warn("resync multiparty apply data error", "partyId", mp.GetId(), "error", err)
+		}
+	}
+
+	mm.l.Info("resynced multiparties", "duration", time.Since(now))
+}
+
+// Reads every loaded multiproxy again from the database. Deleted proxies are removed.
+func (mm *MultiManager) resyncProxies() {
+	now := time.Now()
+
+	for _, mp := range mm.GetAllMultiProxies() {
+		d, err := mm.db.GetProxyData(mp.GetId())
+		if err == database.ErrDataNotFound {
+			err = mm.deleteMultiProxy(mp.GetId(), false, nil)
+			if err != nil {
+				mm.l.Warn("resync multiproxy delete error", "proxyId", mp.GetId(), "error", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			mm.l.Warn("resync multiproxy get data error", "proxyId", mp.GetId(), "error", err)
+			continue
+		}
+
+		err = applyData(d, key.AllowedProxyKeys, mp.Apply)
+		if err != nil {
+			mm.l.Warn("resync multiproxy apply data error", "proxyId", mp.GetId(), "error", err)
+		}
+	}
+
+	mm.l.Info("resynced multiproxies", "duration", time.Since(now))
+}
+
+// Reads every loaded multibackend again from the database. Deleted backends are removed.
+func (mm *MultiManager) resyncBackends() {
+	now := time.Now()
+
+	for _, mb := range mm.GetAllMultiBackends() {
+		d, err := mm.db.GetBackendData(mb.GetId())
+		if err == database.ErrDataNotFound {
+			err = mm.deleteMultiBackend(mb.GetId(), false, nil)
+			if err != nil {
+				mm.l.Warn("resync multibackend delete error", "backendId", mb.GetId(), "error", err)
+			}
+			continue
+		}
+
+		if err != nil {
+			mm.l.Warn("resync multibackend get data error", "backendId", mb.GetId(), "error", err)
+			continue
+		}
+
+		err = applyData(d, key.AllowedBackendKeys, mb.Apply)
+		if err != nil {
+			mm.l.Warn("resync multibackend apply data error", "backendId", mb.GetId(), "error", err)
+		}
+	}
+
+	mm.onBackendsChanged()
+
+	mm.l.Info("resynced multibackends", "duration", time.Since(now))
+}
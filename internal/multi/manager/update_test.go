@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"testing"
+
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+func TestUpdateVersionsAccept(t *testing.T) {
+	uv := newUpdateVersions()
+	id := uuid.New()
+	a, b := uuid.New(), uuid.New()
+
+	if !uv.accept(a, id, "online", 100) {
+		t.Fatal("first update dropped")
+	}
+
+	// an update of the same origin that arrives out of order
+	if uv.accept(a, id, "online", 90) {
+		t.Fatal("outdated update of the same origin accepted")
+	}
+
+	// the clock of another origin can be behind, its updates are not compared with the versions of a
+	if !uv.accept(b, id, "online", 50) {
+		t.Fatal("update of another origin dropped")
+	}
+
+	if !uv.accept(a, id, "proxy", 90) {
+		t.Fatal("update of another key dropped")
+	}
+
+	// messages in the old format have no version
+	if !uv.accept(a, id, "online", 0) {
+		t.Fatal("update without version dropped")
+	}
+
+	uv.forget(id)
+	if !uv.accept(a, id, "online", 10) {
+		t.Fatal("update after forget dropped")
+	}
+}
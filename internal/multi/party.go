@@ -1,8 +1,8 @@
 package multi
 
 import (
+	"encoding/json"
 	"errors"
-	"slices"
 	"sync"
 
 	"github.com/team-vesperis/vesperis-mp/internal/database"
@@ -23,11 +23,11 @@ type Party struct {
 
 	managerId uuid.UUID
 	l         *logger.Logger
-	db        *database.Database
+	db        database.Storage
 	mu        sync.RWMutex
 }
 
-func NewParty(id, managerId uuid.UUID, l *logger.Logger, db *database.Database, data *data.PartyData) *Party {
+func NewParty(id, managerId uuid.UUID, l *logger.Logger, db database.Storage, data *data.PartyData) *Party {
 	mp := &Party{
 		id:        id,
 		managerId: managerId,
@@ -54,35 +54,108 @@ func (mp *Party) save(k key.PartyKey, val any) error {
 		return err
 	}
 
-	m := mp.managerId.String() + "_" + mp.id.String() + "_" + k.String()
-	return mp.db.Publish(UpdateMultiPartyChannel, m)
+	return mp.notify(k, val)
 }
 
+// Update several values at once in a single transaction.
+// Other proxies receive one update message containing all keys.
+func (mp *Party) saveFields(fields map[key.PartyKey]any) error {
+	err := mp.db.SetPartyDataFields(mp.id, fields)
+	if err != nil {
+		return err
+	}
+
+	return mp.notifyFields(fields)
+}
+
+// Sends the new value to other proxies, so they can update it for themselves.
+func (mp *Party) notify(k key.PartyKey, val any) error {
+	return mp.notifyFields(map[key.PartyKey]any{k: val})
+}
+
+func (mp *Party) notifyFields(fields map[key.PartyKey]any) error {
+	m, err := newValuesUpdateMessage(mp.managerId, mp.id, fields)
+	if err != nil {
+		mp.l.Error("party update message create error", "partyId", mp.id, "error", err)
+		return err
+	}
+
+	return mp.db.PublishDurable(UpdateMultiPartyChannel, m)
+}
+
+// Sets several values at once. Either all values are saved or none.
+func (mp *Party) SetFields(fields map[key.PartyKey]any) error {
+	err := mp.saveFields(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(fields) {
+		val, err := json.Marshal(fields[k])
+		if err != nil {
+			return err
+		}
+
+		err = mp.Apply(k, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads the value of the key from the database and applies it.
 func (mp *Party) Update(k key.PartyKey) {
+	var val json.RawMessage
+	err := mp.db.GetPartyDataField(mp.id, k, &val)
+	if err != nil {
+		mp.l.Error("multiparty update partykey get field from database error", "key", k, "error", err)
+		return
+	}
+
+	err = mp.Apply(k, val)
+	if err != nil {
+		mp.l.Error("multiparty update partykey apply value error", "key", k, "error", err)
+	}
+}
+
+// Sets the value of the key without saving it. Used for values that other proxies changed.
+func (mp *Party) Apply(k key.PartyKey, val json.RawMessage) error {
 	var err error
 
 	switch k {
 	case key.PartyKey_PartyOwner:
 		var owner uuid.UUID
-		err = mp.db.GetPartyDataField(mp.id, key.PartyKey_PartyOwner, &owner)
+		err = json.Unmarshal(val, &owner)
+		if err != nil {
+			break
+		}
 		mp.setPartyOwner(owner, false)
 	case key.PartyKey_PartyMembers:
 		var members []uuid.UUID
-		err = mp.db.GetPartyDataField(mp.id, key.PartyKey_PartyMembers, &members)
+		err = json.Unmarshal(val, &members)
+		if err != nil {
+			break
+		}
 		mp.setPartyMembers(members, false)
 	case key.PartyKey_PartyJoinRequests:
 		var requests []uuid.UUID
-		err = mp.db.GetPartyDataField(mp.id, key.PartyKey_PartyJoinRequests, &requests)
+		err = json.Unmarshal(val, &requests)
+		if err != nil {
+			break
+		}
 		mp.setPartyJoinRequests(requests, false)
 	case key.PartyKey_PartyInvitations:
 		var invitations []uuid.UUID
-		err = mp.db.GetPartyDataField(mp.id, key.PartyKey_PartyInvitations, &invitations)
+		err = json.Unmarshal(val, &invitations)
+		if err != nil {
+			break
+		}
 		mp.setPartyInvitations(invitations, false)
 	}
 
-	if err != nil {
-		mp.l.Error("multiparty update partykey get field from database error", "error", err)
-	}
+	return err
 }
 
 func (mp *Party) GetId() uuid.UUID {
@@ -112,6 +185,20 @@ func (mp *Party) setPartyOwner(owner uuid.UUID, notify bool) error {
 	return nil
 }
 
+// Only changes the owner if the stored owner is still the expected owner. Returns if the owner has been changed.
+func (mp *Party) CompareAndSetPartyOwner(expected, owner uuid.UUID) (bool, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	ok, err := mp.db.CompareAndSetPartyDataField(mp.id, key.PartyKey_PartyOwner, expected, owner)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	mp.partyOwner = owner
+	return true, mp.notify(key.PartyKey_PartyOwner, owner)
+}
+
 func (mp *Party) GetPartyMembers() []uuid.UUID {
 	mp.mu.RLock()
 	c := append([]uuid.UUID{}, mp.partyMembers...)
@@ -141,24 +228,30 @@ func (mp *Party) AddPartyMember(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.partyMembers, id) {
-		mp.partyMembers = append(mp.partyMembers, id)
+	l, err := mp.db.AddToPartyDataList(mp.id, key.PartyKey_PartyMembers, id)
+	if err != nil {
+		return err
 	}
+	mp.partyMembers = l
 
-	return mp.save(key.PartyKey_PartyMembers, mp.partyMembers)
+	return mp.notify(key.PartyKey_PartyMembers, l)
 }
 
 func (mp *Party) RemovePartyMember(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.partyMembers, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := mp.db.RemoveFromPartyDataList(mp.id, key.PartyKey_PartyMembers, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	mp.partyMembers = slices.Delete(mp.partyMembers, i, i+1)
+	mp.partyMembers = l
 
-	return mp.save(key.PartyKey_PartyMembers, mp.partyMembers)
+	return mp.notify(key.PartyKey_PartyMembers, l)
 }
 
 func (mp *Party) GetPartyJoinRequests() []uuid.UUID {
@@ -190,24 +283,30 @@ func (mp *Party) AddPartyJoinRequest(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.partyJoinRequests, id) {
-		mp.partyJoinRequests = append(mp.partyJoinRequests, id)
+	l, err := mp.db.AddToPartyDataList(mp.id, key.PartyKey_PartyJoinRequests, id)
+	if err != nil {
+		return err
 	}
+	mp.partyJoinRequests = l
 
-	return mp.save(key.PartyKey_PartyJoinRequests, mp.partyJoinRequests)
+	return mp.notify(key.PartyKey_PartyJoinRequests, l)
 }
 
 func (mp *Party) RemovePartyJoinRequest(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.partyJoinRequests, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := mp.db.RemoveFromPartyDataList(mp.id, key.PartyKey_PartyJoinRequests, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	mp.partyJoinRequests = slices.Delete(mp.partyJoinRequests, i, i+1)
+	mp.partyJoinRequests = l
 
-	return mp.save(key.PartyKey_PartyJoinRequests, mp.partyJoinRequests)
+	return mp.notify(key.PartyKey_PartyJoinRequests, l)
 }
 
 func (mp *Party) GetPartyInvitations() []uuid.UUID {
@@ -239,22 +338,28 @@ func (mp *Party) AddPartyInvitation(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.partyInvitations, id) {
-		mp.partyInvitations = append(mp.partyInvitations, id)
+	l, err := mp.db.AddToPartyDataList(mp.id, key.PartyKey_PartyInvitations, id)
+	if err != nil {
+		return err
 	}
+	mp.partyInvitations = l
 
-	return mp.save(key.PartyKey_PartyInvitations, mp.partyInvitations)
+	return mp.notify(key.PartyKey_PartyInvitations, l)
 }
 
 func (mp *Party) RemovePartyInvitation(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.partyInvitations, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := mp.db.RemoveFromPartyDataList(mp.id, key.PartyKey_PartyInvitations, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	mp.partyInvitations = slices.Delete(mp.partyInvitations, i, i+1)
+	mp.partyInvitations = l
 
-	return mp.save(key.PartyKey_PartyInvitations, mp.partyInvitations)
+	return mp.notify(key.PartyKey_PartyInvitations, l)
 }
@@ -1,6 +1,7 @@
 package multi
 
 import (
+	"encoding/json"
 	"errors"
 	"slices"
 	"sync"
@@ -24,6 +25,9 @@ type Player struct {
 	// can be nil!
 	b *Backend
 
+	// name of the last backend, stays after the player left
+	lastBackend string
+
 	username string
 	nickname string
 
@@ -41,11 +45,11 @@ type Player struct {
 
 	managerId uuid.UUID
 	l         *logger.Logger
-	db        *database.Database
+	db        database.Storage
 	mu        sync.RWMutex
 }
 
-func NewPlayer(id, mId uuid.UUID, l *logger.Logger, db *database.Database, data *data.PlayerData) *Player {
+func NewPlayer(id, mId uuid.UUID, l *logger.Logger, db database.Storage, data *data.PlayerData) *Player {
 	mp := &Player{
 		id:        id,
 		managerId: mId,
@@ -58,6 +62,7 @@ func NewPlayer(id, mId uuid.UUID, l *logger.Logger, db *database.Database, data
 	mp.bi = newBanInfo(mp, data)
 	mp.fi = newFriendInfo(mp, data)
 
+	mp.lastBackend = data.LastBackend
 	mp.username = data.Username
 	mp.nickname = data.Nickname
 	mp.partyId = data.PartyId
@@ -74,6 +79,7 @@ var ErrPlayerNotFound = errors.New("player not found")
 type MultiManager interface {
 	GetMultiProxy(id uuid.UUID) (*Proxy, error)
 	GetMultiBackend(id uuid.UUID) (*Backend, error)
+	IsPlayerPresent(id uuid.UUID) bool
 }
 
 var ErrMultiManagerNotSet = errors.New("multi manager not set")
@@ -93,21 +99,87 @@ func (mp *Player) save(k key.PlayerKey, val any) error {
 		return err
 	}
 
-	m := mp.managerId.String() + "_" + mp.id.String() + "_" + k.String()
-	return mp.db.Publish(UpdateMultiPlayerChannel, m)
+	return mp.notify(k, val)
+}
+
+// Update several values at once in a single transaction.
+// Other proxies receive one update message containing all keys.
+func (mp *Player) saveFields(fields map[key.PlayerKey]any) error {
+	err := mp.db.SetPlayerDataFields(mp.id, fields)
+	if err != nil {
+		return err
+	}
+
+	return mp.notifyFields(fields)
+}
+
+// Sends the new value to other proxies, so they can update it for themselves.
+func (mp *Player) notify(k key.PlayerKey, val any) error {
+	return mp.notifyFields(map[key.PlayerKey]any{k: val})
+}
+
+func (mp *Player) notifyFields(fields map[key.PlayerKey]any) error {
+	m, err := newValuesUpdateMessage(mp.managerId, mp.id, fields)
+	if err != nil {
+		mp.l.Error("player update message create error", "playerId", mp.id, "error", err)
+		return err
+	}
+
+	return mp.db.PublishDurable(UpdateMultiPlayerChannel, m)
+}
+
+// Sets several values at once. Either all values are saved or none.
+func (mp *Player) SetFields(fields map[key.PlayerKey]any) error {
+	err := mp.saveFields(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(fields) {
+		val, err := json.Marshal(fields[k])
+		if err != nil {
+			return err
+		}
+
+		err = mp.Apply(k, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
+// Reads the value of the key from the database and applies it.
 func (mp *Player) Update(k key.PlayerKey) {
-	if proxyManagerInstance == nil {
+	var val json.RawMessage
+	err := mp.db.GetPlayerDataField(mp.id, k, &val)
+	if err != nil {
+		mp.l.Error("multiplayer update playerkey get field from database error", "key", k, "error", err)
 		return
 	}
 
+	err = mp.Apply(k, val)
+	if err != nil {
+		mp.l.Error("multiplayer update playerkey apply value error", "key", k, "error", err)
+	}
+}
+
+// Sets the value of the key without saving it. Used for values that other proxies changed.
+func (mp *Player) Apply(k key.PlayerKey, val json.RawMessage) error {
+	if proxyManagerInstance == nil {
+		return nil
+	}
+
 	var err error
 
 	switch k {
 	case key.PlayerKey_Proxy:
 		var proxyId uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Proxy, &proxyId)
+		err = json.Unmarshal(val, &proxyId)
+		if err != nil {
+			break
+		}
 		if proxyId == uuid.Nil {
 			mp.setProxy(nil, false)
 			break
@@ -118,9 +190,13 @@ func (mp *Player) Update(k key.PlayerKey) {
 		}
 	case key.PlayerKey_Backend:
 		var backendId uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Backend, &backendId)
+		err = json.Unmarshal(val, &backendId)
+		if err != nil {
+			break
+		}
 		if backendId == uuid.Nil {
 			mp.setBackend(nil, false)
+			break
 		}
 
 		b, err := proxyManagerInstance.GetMultiBackend(backendId)
@@ -128,90 +204,144 @@ func (mp *Player) Update(k key.PlayerKey) {
 			mp.setBackend(b, false)
 		}
 
+	case key.PlayerKey_LastBackend:
+		var lastBackend string
+		err = json.Unmarshal(val, &lastBackend)
+		if err != nil {
+			break
+		}
+		mp.setLastBackend(lastBackend, false)
+
 	case key.PlayerKey_Username:
 		var username string
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Username, &username)
+		err = json.Unmarshal(val, &username)
+		if err != nil {
+			break
+		}
 		mp.setUsername(username, false)
 
 	case key.PlayerKey_Nickname:
 		var nickname string
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Nickname, &nickname)
+		err = json.Unmarshal(val, &nickname)
+		if err != nil {
+			break
+		}
 		mp.setNickname(nickname, false)
 
 	case key.PlayerKey_Permission_Role:
 		var role string
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Permission_Role, &role)
+		err = json.Unmarshal(val, &role)
+		if err != nil {
+			break
+		}
 		mp.pmi.setRole(Role(role), false)
 
 	case key.PlayerKey_Permission_Rank:
 		var rank string
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Permission_Rank, &rank)
+		err = json.Unmarshal(val, &rank)
+		if err != nil {
+			break
+		}
 		mp.pmi.setRank(Rank(rank), false)
 
 	case key.PlayerKey_Ban_Banned:
 		var banned bool
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Ban_Banned, &banned)
+		err = json.Unmarshal(val, &banned)
+		if err != nil {
+			break
+		}
 		mp.bi.setBanned(banned, false)
 
 	case key.PlayerKey_Ban_Reason:
 		var reason string
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Ban_Reason, &reason)
+		err = json.Unmarshal(val, &reason)
+		if err != nil {
+			break
+		}
 		mp.bi.setReason(reason, false)
 
 	case key.PlayerKey_Ban_Permanently:
 		var permanently bool
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Ban_Permanently, &permanently)
+		err = json.Unmarshal(val, &permanently)
+		if err != nil {
+			break
+		}
 		mp.bi.setPermanently(permanently, false)
 
 	case key.PlayerKey_Ban_Expiration:
 		var expiration time.Time
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Ban_Expiration, &expiration)
+		err = json.Unmarshal(val, &expiration)
+		if err != nil {
+			break
+		}
 		mp.bi.setExpiration(expiration, false)
 
 	case key.PlayerKey_Online:
 		var online bool
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Online, &online)
+		err = json.Unmarshal(val, &online)
+		if err != nil {
+			break
+		}
 		mp.setOnline(online, false)
 
 	case key.PlayerKey_Vanished:
 		var vanished bool
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Vanished, &vanished)
+		err = json.Unmarshal(val, &vanished)
+		if err != nil {
+			break
+		}
 		mp.setVanished(vanished, false)
 
 	case key.PlayerKey_LastSeen:
 		var lastSeen *time.Time
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_LastSeen, &lastSeen)
+		err = json.Unmarshal(val, &lastSeen)
+		if err != nil {
+			break
+		}
 		mp.setLastSeen(lastSeen, false)
 
 	case key.PlayerKey_Friend_Friends:
 		var friends []uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Friend_Friends, &friends)
+		err = json.Unmarshal(val, &friends)
+		if err != nil {
+			break
+		}
 		mp.fi.setFriendsIds(friends, false)
 
 	case key.PlayerKey_Friend_FriendPendingRequests:
 		var pendingFriendRequests []uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Friend_FriendPendingRequests, &pendingFriendRequests)
+		err = json.Unmarshal(val, &pendingFriendRequests)
+		if err != nil {
+			break
+		}
 		mp.fi.setPendingFriendIds(pendingFriendRequests, false)
 
 	case key.PlayerKey_Friend_FriendRequests:
 		var friendRequests []uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_Friend_FriendRequests, &friendRequests)
+		err = json.Unmarshal(val, &friendRequests)
+		if err != nil {
+			break
+		}
 		mp.fi.setFriendRequestIds(friendRequests, false)
 
 	case key.PlayerKey_PartyId:
 		var partyId uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_PartyId, &partyId)
+		err = json.Unmarshal(val, &partyId)
+		if err != nil {
+			break
+		}
 		mp.setPartyId(partyId, false)
 
 	case key.PlayerKey_PartyInvitations:
 		var invitations []uuid.UUID
-		err = mp.db.GetPlayerDataField(mp.id, key.PlayerKey_PartyInvitations, &invitations)
+		err = json.Unmarshal(val, &invitations)
+		if err != nil {
+			break
+		}
 		mp.setPartyInvitations(invitations, false)
 	}
 
-	if err != nil {
-		mp.l.Error("multiplayer update playerkey get field from database error", "error", err)
-	}
+	return err
 }
 
 var ErrProxyNilWhileOnline = errors.New("proxy is nil but player is online")
@@ -275,6 +405,31 @@ func (mp *Player) setBackend(mb *Backend, notify bool) error {
 	return nil
 }
 
+// the name of the last backend the player was on. empty if the player hasn't been on a backend
+func (mp *Player) GetLastBackend() string {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	return mp.lastBackend
+}
+
+func (mp *Player) SetLastBackend(name string) error {
+	return mp.setLastBackend(name, true)
+}
+
+func (mp *Player) setLastBackend(name string, notify bool) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.lastBackend = name
+
+	if notify {
+		return mp.save(key.PlayerKey_LastBackend, name)
+	}
+
+	return nil
+}
+
 func (mp *Player) GetId() uuid.UUID {
 	return mp.id
 }
@@ -294,10 +449,16 @@ func (mp *Player) setUsername(name string, notify bool) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
+	old := mp.username
 	mp.username = name
 
 	if notify {
-		return mp.save(key.PlayerKey_Username, name)
+		err := mp.save(key.PlayerKey_Username, name)
+		if err != nil {
+			return err
+		}
+
+		return mp.db.SetPlayerUsernameIndex(mp.id, old, name)
 	}
 
 	return nil
@@ -387,24 +548,30 @@ func (mp *Player) AddPartyInvitation(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.partyInvitations, id) {
-		mp.partyInvitations = append(mp.partyInvitations, id)
+	l, err := mp.db.AddToPlayerDataList(mp.id, key.PlayerKey_PartyInvitations, id)
+	if err != nil {
+		return err
 	}
+	mp.partyInvitations = l
 
-	return mp.save(key.PlayerKey_PartyInvitations, mp.partyInvitations)
+	return mp.notify(key.PlayerKey_PartyInvitations, l)
 }
 
 func (mp *Player) RemovePartyInvitation(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.partyInvitations, id)
-	if i == -1 {
-		return ErrPartyNotFound
+	l, err := mp.db.RemoveFromPlayerDataList(mp.id, key.PlayerKey_PartyInvitations, id)
+	if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPartyNotFound
+		}
+
+		return err
 	}
-	mp.partyInvitations = slices.Delete(mp.partyInvitations, i, i+1)
+	mp.partyInvitations = l
 
-	return mp.save(key.PlayerKey_PartyInvitations, mp.partyInvitations)
+	return mp.notify(key.PlayerKey_PartyInvitations, l)
 }
 
 func (mp *Player) GetPermissionInfo() *permissionInfo {
@@ -419,7 +586,17 @@ func (mp *Player) GetFriendInfo() *friendInfo {
 	return mp.fi
 }
 
+// Derived from the presence of the player, which expires when the proxy of the player crashed.
 func (mp *Player) IsOnline() bool {
+	if proxyManagerInstance == nil {
+		return mp.IsSavedOnline()
+	}
+
+	return proxyManagerInstance.IsPlayerPresent(mp.id)
+}
+
+// The online value saved in the database. Can be outdated when a proxy crashed, use IsOnline instead.
+func (mp *Player) IsSavedOnline() bool {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
 
@@ -1,6 +1,7 @@
 package multi
 
 import (
+	"encoding/json"
 	"slices"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 
 type Proxy struct {
 	id          uuid.UUID
+	name        string
 	maintenance bool
 	address     string
 
@@ -25,13 +27,13 @@ type Proxy struct {
 	managerId uuid.UUID
 
 	l  *logger.Logger
-	db *database.Database
+	db database.Storage
 	cf *config.Config
 
 	lastHeartBeat *time.Time
 }
 
-func NewProxy(id, managerId uuid.UUID, l *logger.Logger, db *database.Database, cf *config.Config, data *data.ProxyData) *Proxy {
+func NewProxy(id, managerId uuid.UUID, l *logger.Logger, db database.Storage, cf *config.Config, data *data.ProxyData) *Proxy {
 	mp := &Proxy{
 		id:        id,
 		managerId: managerId,
@@ -41,6 +43,7 @@ func NewProxy(id, managerId uuid.UUID, l *logger.Logger, db *database.Database,
 		mu:        sync.RWMutex{},
 	}
 
+	mp.name = data.Name
 	mp.address = data.Address
 	mp.maintenance = data.Maintenance
 	mp.backends = data.Backends
@@ -58,41 +61,123 @@ func (mp *Proxy) save(k key.ProxyKey, val any) error {
 		return err
 	}
 
-	m := mp.managerId.String() + "_" + mp.id.String() + "_" + k.String()
-	return mp.db.Publish(UpdateMultiProxyChannel, m)
+	return mp.notify(k, val)
 }
 
+// Update several values at once in a single transaction.
+// Other proxies receive one update message containing all keys.
+func (mp *Proxy) saveFields(fields map[key.ProxyKey]any) error {
+	err := mp.db.SetProxyDataFields(mp.id, fields)
+	if err != nil {
+		return err
+	}
+
+	return mp.notifyFields(fields)
+}
+
+// Sends the new value to other proxies, so they can update it for themselves.
+func (mp *Proxy) notify(k key.ProxyKey, val any) error {
+	return mp.notifyFields(map[key.ProxyKey]any{k: val})
+}
+
+func (mp *Proxy) notifyFields(fields map[key.ProxyKey]any) error {
+	m, err := newValuesUpdateMessage(mp.managerId, mp.id, fields)
+	if err != nil {
+		mp.l.Error("proxy update message create error", "proxyId", mp.id, "error", err)
+		return err
+	}
+
+	return mp.db.PublishDurable(UpdateMultiProxyChannel, m)
+}
+
+// Sets several values at once. Either all values are saved or none.
+func (mp *Proxy) SetFields(fields map[key.ProxyKey]any) error {
+	err := mp.saveFields(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(fields) {
+		val, err := json.Marshal(fields[k])
+		if err != nil {
+			return err
+		}
+
+		err = mp.Apply(k, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads the value of the key from the database and applies it.
 func (mp *Proxy) Update(k key.ProxyKey) {
+	var val json.RawMessage
+	err := mp.db.GetProxyDataField(mp.id, k, &val)
+	if err != nil {
+		mp.l.Error("multiproxy update proxykey get field from database error", "key", k, "error", err)
+		return
+	}
+
+	err = mp.Apply(k, val)
+	if err != nil {
+		mp.l.Error("multiproxy update proxykey apply value error", "key", k, "error", err)
+	}
+}
+
+// Sets the value of the key without saving it. Used for values that other proxies changed.
+func (mp *Proxy) Apply(k key.ProxyKey, val json.RawMessage) error {
 	var err error
 
 	switch k {
 	case key.ProxyKey_Maintenance:
 		var maintenance bool
-		err = mp.db.GetProxyDataField(mp.id, key.ProxyKey_Maintenance, &maintenance)
+		err = json.Unmarshal(val, &maintenance)
+		if err != nil {
+			break
+		}
 		mp.setInMaintenance(maintenance, false)
 	case key.ProxyKey_BackendList:
 		var backends []uuid.UUID
-		err = mp.db.GetProxyDataField(mp.id, key.ProxyKey_BackendList, &backends)
+		err = json.Unmarshal(val, &backends)
+		if err != nil {
+			break
+		}
 		mp.setBackendsIds(backends, false)
 	case key.ProxyKey_PlayerList:
 		var players []uuid.UUID
-		err = mp.db.GetProxyDataField(mp.id, key.ProxyKey_PlayerList, &players)
+		err = json.Unmarshal(val, &players)
+		if err != nil {
+			break
+		}
 		mp.setPlayerIds(players, false)
 	case key.ProxyKey_LastHeartBeat:
 		var time time.Time
-		err = mp.db.GetProxyDataField(mp.id, key.ProxyKey_LastHeartBeat, &time)
+		err = json.Unmarshal(val, &time)
+		if err != nil {
+			break
+		}
 		mp.setLastHeartBeat(&time, false)
 	}
 
-	if err != nil {
-		mp.l.Error("multiproxy update proxykey get field from database error", "error", err)
-	}
+	return err
 }
 
 func (mp *Proxy) GetId() uuid.UUID {
 	return mp.id
 }
 
+// Returns the configured name, or the id when the proxy has no name.
+func (mp *Proxy) GetName() string {
+	if mp.name == "" {
+		return mp.id.String()
+	}
+
+	return mp.name
+}
+
 func (mp *Proxy) GetAddress() string {
 	mp.mu.RLock()
 	defer mp.mu.RUnlock()
@@ -174,24 +259,36 @@ func (mp *Proxy) AddPlayerId(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.players, id) {
-		mp.players = append(mp.players, id)
+	l, err := mp.db.AddToProxyDataList(mp.id, key.ProxyKey_PlayerList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithValue(mp.players, id)
+	} else if err != nil {
+		return err
 	}
+	mp.players = l
 
-	return mp.save(key.ProxyKey_PlayerList, mp.players)
+	return mp.notify(key.ProxyKey_PlayerList, l)
 }
 
 func (mp *Proxy) RemovePlayerId(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.players, id)
-	if i == -1 {
-		return ErrPlayerNotFound
+	l, err := mp.db.RemoveFromProxyDataList(mp.id, key.ProxyKey_PlayerList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithoutValue(mp.players, id)
+	} else if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrPlayerNotFound
+		}
+
+		return err
 	}
-	mp.players = slices.Delete(mp.players, i, i+1)
+	mp.players = l
 
-	return mp.save(key.ProxyKey_PlayerList, mp.players)
+	return mp.notify(key.ProxyKey_PlayerList, l)
 }
 
 func (mp *Proxy) IsPlayerIdOnProxy(id uuid.UUID) bool {
@@ -230,22 +327,34 @@ func (mp *Proxy) AddBackend(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	if !slices.Contains(mp.backends, id) {
-		mp.backends = append(mp.backends, id)
+	l, err := mp.db.AddToProxyDataList(mp.id, key.ProxyKey_BackendList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithValue(mp.backends, id)
+	} else if err != nil {
+		return err
 	}
+	mp.backends = l
 
-	return mp.save(key.ProxyKey_BackendList, mp.backends)
+	return mp.notify(key.ProxyKey_BackendList, l)
 }
 
 func (mp *Proxy) RemoveBackendId(id uuid.UUID) error {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
-	i := slices.Index(mp.backends, id)
-	if i == -1 {
-		return ErrBackendNotFound
+	l, err := mp.db.RemoveFromProxyDataList(mp.id, key.ProxyKey_BackendList, id)
+	if err == database.ErrWriteQueued {
+		// the database changes the list when it is reachable again
+		l = listWithoutValue(mp.backends, id)
+	} else if err != nil {
+		if err == database.ErrListValueNotFound {
+			return ErrBackendNotFound
+		}
+
+		return err
 	}
-	mp.backends = slices.Delete(mp.backends, i, i+1)
+	mp.backends = l
 
-	return mp.save(key.ProxyKey_BackendList, mp.backends)
+	return mp.notify(key.ProxyKey_BackendList, l)
 }
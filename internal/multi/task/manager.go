@@ -6,28 +6,40 @@ import (
 	"strings"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/logger"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/manager"
+	"github.com/team-vesperis/vesperis-mp/internal/proxy/registry"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
 type TaskManager struct {
-	db           *database.Database
+	db           database.Storage
 	l            *logger.Logger
 	ownerGate    *proxy.Proxy
 	multiManager *manager.MultiManager
+	registry     *registry.Registry
+	drainer      Drainer
 }
 
-func InitTaskManager(db *database.Database, l *logger.Logger, mp *multi.Proxy, proxy *proxy.Proxy, mm *manager.MultiManager) *TaskManager {
+// Moves the players of this proxy to other proxies. Set by the drain manager, the drain task uses it.
+type Drainer interface {
+	// Starts draining in the background with the timeout of the config.
+	StartDrain() error
+	CancelDrain() error
+	// The progress of the running or last drain.
+	GetDrainStatus() string
+}
+
+func InitTaskManager(db database.Storage, l *logger.Logger, mp *multi.Proxy, proxy *proxy.Proxy, mm *manager.MultiManager, r *registry.Registry) *TaskManager {
 	tm := &TaskManager{
 		db:           db,
 		l:            l,
 		ownerGate:    proxy,
 		multiManager: mm,
+		registry:     r,
 	}
 
 	tm.db.CreateListener(taskChannel, tm.createTaskListener())
@@ -46,7 +58,7 @@ func RegisterTaskType(name string, constructor func() Task) {
 	taskRegistry[name] = constructor
 }
 
-func (tm *TaskManager) GetDatabase() *database.Database {
+func (tm *TaskManager) GetDatabase() database.Storage {
 	return tm.db
 }
 
@@ -62,8 +74,21 @@ func (tm *TaskManager) GetMultiManager() *manager.MultiManager {
 	return tm.multiManager
 }
 
-func (tm *TaskManager) createTaskListener() func(msg *redis.Message) {
-	return func(msg *redis.Message) {
+func (tm *TaskManager) GetRegistry() *registry.Registry {
+	return tm.registry
+}
+
+func (tm *TaskManager) SetDrainer(d Drainer) {
+	tm.drainer = d
+}
+
+// can return nil
+func (tm *TaskManager) GetDrainer() Drainer {
+	return tm.drainer
+}
+
+func (tm *TaskManager) createTaskListener() func(msg *database.Message) {
+	return func(msg *database.Message) {
 		var tt TaskType
 		err := json.Unmarshal([]byte(msg.Payload), &tt)
 		if err != nil {
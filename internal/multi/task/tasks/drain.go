@@ -0,0 +1,68 @@
+package tasks
+
+import (
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+type DrainAction string
+
+const (
+	DrainAction_Start  DrainAction = "start"
+	DrainAction_Cancel DrainAction = "cancel"
+	DrainAction_Status DrainAction = "status"
+)
+
+type DrainTask struct {
+	TargetProxyId   uuid.UUID   `json:"targetProxyId"`
+	Action          DrainAction `json:"action"`
+	ResponseChannel string      `json:"responseChannel"`
+}
+
+func NewDrainTask(targetProxyId uuid.UUID, action DrainAction) *DrainTask {
+	return &DrainTask{
+		TargetProxyId: targetProxyId,
+		Action:        action,
+	}
+}
+
+// The info of the response is the progress of the drain.
+func (dt *DrainTask) PerformTask(tm *task.TaskManager) *task.TaskResponse {
+	dm := tm.GetDrainer()
+	if dm == nil {
+		return task.NewTaskResponse(false, ErrStringDrainNotAvailable)
+	}
+
+	var err error
+	switch dt.Action {
+	case DrainAction_Start:
+		err = dm.StartDrain()
+	case DrainAction_Cancel:
+		err = dm.CancelDrain()
+	case DrainAction_Status:
+	default:
+		return task.NewTaskResponse(false, ErrStringUnknownDrainAction)
+	}
+
+	if err != nil {
+		return task.NewTaskResponse(false, err.Error())
+	}
+
+	return task.NewTaskResponse(true, dm.GetDrainStatus())
+}
+
+func (dt *DrainTask) GetTargetProxyId() uuid.UUID {
+	return dt.TargetProxyId
+}
+
+func (dt *DrainTask) GetResponseChannel() string {
+	return dt.ResponseChannel
+}
+
+func (dt *DrainTask) SetResponseChannel(channel string) {
+	dt.ResponseChannel = channel
+}
+
+func (dt *DrainTask) GetTaskType() string {
+	return drainTask
+}
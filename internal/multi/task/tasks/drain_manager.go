@@ -0,0 +1,366 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Draining moves all players of this proxy to other proxies, so the proxy can be stopped without players noticing.
+// The proxy is put in maintenance first, so no new players are sent to it.
+// Players are moved in batches every interval and members of a party are always moved together to the same proxy.
+type DrainManager struct {
+	tm *task.TaskManager
+	cf *config.Config
+
+	p DrainProgress
+	// cancels the running drain, nil when not draining
+	cancel context.CancelFunc
+	// the maintenance of the proxy before the drain, set again when the drain is cancelled
+	maintenance bool
+	// closed when the running drain is done
+	done chan struct{}
+	// players that are being transferred, they are not moved again right away
+	pending map[uuid.UUID]time.Time
+	mu      sync.Mutex
+}
+
+var (
+	ErrAlreadyDraining = errors.New("proxy is already draining")
+	ErrNotDraining     = errors.New("proxy is not draining")
+	ErrDrainCancelled  = errors.New("drain cancelled")
+	ErrDrainDeadline   = errors.New("drain deadline passed with players left")
+)
+
+type DrainProgress struct {
+	Draining bool      `json:"draining"`
+	Started  time.Time `json:"started"`
+	Deadline time.Time `json:"deadline"`
+	// players on the proxy when the drain started
+	Total     int `json:"total"`
+	Moved     int `json:"moved"`
+	Failed    int `json:"failed"`
+	Remaining int `json:"remaining"`
+}
+
+func (dp DrainProgress) String() string {
+	if !dp.Draining {
+		if dp.Started.IsZero() {
+			return "not draining"
+		}
+
+		return fmt.Sprintf("not draining, last drain moved %d of %d players with %d left", dp.Moved, dp.Total, dp.Remaining)
+	}
+
+	return fmt.Sprintf("draining, %d of %d players left, %d moved, %d failed, deadline in %s",
+		dp.Remaining, dp.Total, dp.Moved, dp.Failed, time.Until(dp.Deadline).Round(time.Second))
+}
+
+// a transfer that takes longer is tried again
+const drainTransferTimeout = 10 * time.Second
+
+func InitDrainManager(tm *task.TaskManager, cf *config.Config) *DrainManager {
+	dm := &DrainManager{
+		tm:      tm,
+		cf:      cf,
+		pending: make(map[uuid.UUID]time.Time),
+	}
+
+	tm.SetDrainer(dm)
+	return dm
+}
+
+func (dm *DrainManager) StartDrain() error {
+	return dm.Start(dm.cf.GetDrainTimeout())
+}
+
+func (dm *DrainManager) CancelDrain() error {
+	return dm.Cancel()
+}
+
+func (dm *DrainManager) GetDrainStatus() string {
+	return dm.GetProgress().String()
+}
+
+// Starts draining in the background. The drain stops when the proxy is empty, when the timeout passed or when it is cancelled.
+func (dm *DrainManager) Start(timeout time.Duration) error {
+	ctx, err := dm.begin(timeout)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := dm.run(ctx)
+		if err != nil {
+			dm.tm.GetLogger().Warn("drain stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Drains and returns when the proxy is empty or the timeout passed. If a drain is already running, it is waited for instead.
+func (dm *DrainManager) Drain(timeout time.Duration) error {
+	ctx, err := dm.begin(timeout)
+	if err == ErrAlreadyDraining {
+		return dm.wait(timeout)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return dm.run(ctx)
+}
+
+// Stops the running drain and sets the maintenance of the proxy back to what it was before the drain.
+func (dm *DrainManager) Cancel() error {
+	dm.mu.Lock()
+	cancel := dm.cancel
+	maintenance := dm.maintenance
+	dm.mu.Unlock()
+
+	if cancel == nil {
+		return ErrNotDraining
+	}
+
+	// the running batch stops before the next player
+	cancel()
+
+	return dm.tm.GetMultiManager().GetOwnerMultiProxy().SetInMaintenance(maintenance)
+}
+
+func (dm *DrainManager) GetProgress() DrainProgress {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	p := dm.p
+	if p.Draining {
+		p.Remaining = len(dm.tm.GetOwnerGate().Players())
+	}
+
+	return p
+}
+
+func (dm *DrainManager) IsDraining() bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.p.Draining
+}
+
+func (dm *DrainManager) begin(timeout time.Duration) (context.Context, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if dm.cancel != nil {
+		return nil, ErrAlreadyDraining
+	}
+
+	// set before the drain can be cancelled, so a cancel always comes after it
+	mp := dm.tm.GetMultiManager().GetOwnerMultiProxy()
+	maintenance := mp.IsInMaintenance()
+	err := mp.SetInMaintenance(true)
+	if err != nil {
+		dm.tm.GetLogger().Error("drain set in maintenance error", "error", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(timeout))
+	dm.cancel = cancel
+	dm.maintenance = maintenance
+	dm.done = make(chan struct{})
+	dm.pending = make(map[uuid.UUID]time.Time)
+
+	players := len(dm.tm.GetOwnerGate().Players())
+	dm.p = DrainProgress{
+		Draining:  true,
+		Started:   now,
+		Deadline:  now.Add(timeout),
+		Total:     players,
+		Remaining: players,
+	}
+
+	return ctx, nil
+}
+
+func (dm *DrainManager) wait(timeout time.Duration) error {
+	dm.mu.Lock()
+	done := dm.done
+	dm.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+
+	if len(dm.tm.GetOwnerGate().Players()) > 0 {
+		return ErrDrainDeadline
+	}
+
+	return nil
+}
+
+func (dm *DrainManager) run(ctx context.Context) error {
+	l := dm.tm.GetLogger()
+	mp := dm.tm.GetMultiManager().GetOwnerMultiProxy()
+
+	defer func() {
+		dm.mu.Lock()
+		dm.cancel()
+		dm.cancel = nil
+		dm.p.Draining = false
+		dm.p.Remaining = len(dm.tm.GetOwnerGate().Players())
+		close(dm.done)
+		dm.mu.Unlock()
+	}()
+
+	p := dm.GetProgress()
+	l.Info("draining proxy", "proxyId", mp.GetId(), "proxyName", mp.GetName(), "players", p.Total, "deadline", p.Deadline)
+
+	t := time.NewTicker(dm.cf.GetDrainInterval())
+	defer t.Stop()
+
+	for {
+		players := dm.tm.GetOwnerGate().Players()
+		if len(players) == 0 {
+			p := dm.GetProgress()
+			l.Info("drained proxy", "proxyId", mp.GetId(), "moved", p.Moved, "failed", p.Failed, "duration", time.Since(p.Started))
+			return nil
+		}
+
+		moved, failed := dm.moveBatch(ctx, players)
+
+		dm.mu.Lock()
+		dm.p.Moved += moved
+		dm.p.Failed += failed
+		dm.mu.Unlock()
+
+		p := dm.GetProgress()
+		l.Info("drain progress", "remaining", p.Remaining, "total", p.Total, "moved", p.Moved, "failed", p.Failed)
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.Canceled {
+				l.Info("drain cancelled", "proxyId", mp.GetId(), "remaining", p.Remaining)
+				return ErrDrainCancelled
+			}
+
+			l.Warn("drain deadline passed", "proxyId", mp.GetId(), "remaining", p.Remaining)
+			return ErrDrainDeadline
+		case <-t.C:
+		}
+	}
+}
+
+// Moves the next batch of players. Returns the amount of moved players and of players that could not be moved.
+func (dm *DrainManager) moveBatch(ctx context.Context, players []proxy.Player) (int, int) {
+	mm := dm.tm.GetMultiManager()
+	own := mm.GetOwnerMultiProxy()
+
+	// the player counts are updated while moving, so a batch is spread over the proxies
+	counts := make(map[*multi.Proxy]int)
+	for _, p := range mm.GetAvailableMultiProxies(false) {
+		counts[p] = len(p.GetPlayerIds())
+	}
+
+	moved, failed := 0, 0
+	for _, group := range dm.nextBatch(players) {
+		target := lowestCount(counts)
+		if target == nil {
+			dm.tm.GetLogger().Warn("drain found no proxy to move players to", "players", len(players))
+			return moved, failed + len(group)
+		}
+		counts[target] += len(group)
+
+		for _, p := range group {
+			if ctx.Err() != nil {
+				return moved, failed
+			}
+
+			tr := dm.tm.BuildTask(NewTransferTask(p.ID(), own.GetId(), target.GetId(), uuid.Nil))
+			if !tr.IsSuccessful() {
+				dm.tm.GetLogger().Warn("drain transfer not successful", "playerId", p.ID(), "proxyId", target.GetId(), "error", tr.GetInfo())
+				failed++
+				continue
+			}
+
+			dm.mu.Lock()
+			dm.pending[p.ID()] = time.Now()
+			dm.mu.Unlock()
+			moved++
+		}
+	}
+
+	return moved, failed
+}
+
+// Groups the players by party and returns the groups of the next batch. A party is never split over batches.
+func (dm *DrainManager) nextBatch(players []proxy.Player) [][]proxy.Player {
+	mm := dm.tm.GetMultiManager()
+
+	dm.mu.Lock()
+	for id, at := range dm.pending {
+		if time.Since(at) > drainTransferTimeout {
+			delete(dm.pending, id)
+		}
+	}
+
+	var order []uuid.UUID
+	groups := make(map[uuid.UUID][]proxy.Player)
+	for _, p := range players {
+		if _, ok := dm.pending[p.ID()]; ok {
+			continue
+		}
+
+		// players without a party are a group of their own
+		k := p.ID()
+		mp, err := mm.GetMultiPlayer(p.ID())
+		if err == nil && mp.GetPartyId() != uuid.Nil {
+			k = mp.GetPartyId()
+		}
+
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], p)
+	}
+	dm.mu.Unlock()
+
+	size := dm.cf.GetDrainBatchSize()
+	var batch [][]proxy.Player
+	n := 0
+	for _, k := range order {
+		if n > 0 && n+len(groups[k]) > size {
+			break
+		}
+
+		batch = append(batch, groups[k])
+		n += len(groups[k])
+	}
+
+	return batch
+}
+
+func lowestCount(counts map[*multi.Proxy]int) *multi.Proxy {
+	var proxy *multi.Proxy
+	count := math.MaxInt
+
+	for p, c := range counts {
+		if c < count {
+			proxy = p
+			count = c
+		}
+	}
+
+	return proxy
+}
@@ -11,6 +11,7 @@ func Init() {
 	task.RegisterTaskType(transferTask, func() task.Task { return &TransferTask{} })
 	task.RegisterTaskType(banTask, func() task.Task { return &BanTask{} })
 	task.RegisterTaskType(refreshTask, func() task.Task { return &RefreshTask{} })
+	task.RegisterTaskType(drainTask, func() task.Task { return &DrainTask{} })
 }
 
 // task types
@@ -21,10 +22,16 @@ const (
 	transferTask        = "transfer"
 	banTask             = "ban"
 	refreshTask         = "refresh"
+	drainTask           = "drain"
 )
 
 const (
 	ErrStringBackendNotFound = "backend not found"
 	ErrStringProxyNotFound   = "proxy not found"
 	ErrStringTargetNotFound  = "target not found"
+
+	ErrStringProxyInMaintenance   = "proxy in maintenance"
+	ErrStringBackendInMaintenance = "backend in maintenance"
+	ErrStringDrainNotAvailable    = "drain not available"
+	ErrStringUnknownDrainAction   = "unknown drain action"
 )
@@ -2,12 +2,16 @@ package tasks
 
 import (
 	"context"
+	"slices"
 
 	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/balancer"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/common/minecraft/key"
 	"go.minekube.com/gate/pkg/edition/java/cookie"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
@@ -47,6 +51,37 @@ func (tt *TransferTask) PerformTask(tm *task.TaskManager) *task.TaskResponse {
 		return task.NewTaskResponse(false, err.Error())
 	}
 
+	// proxies and backends in maintenance only take players that can bypass it
+	bypass := false
+	player, err := tm.GetMultiManager().GetMultiPlayer(tt.TargetPlayerId)
+	if err == nil {
+		bypass = tm.GetMultiManager().CanBypassMaintenance(player)
+	}
+
+	if tt.TransferBackendId != uuid.Nil && !bypass {
+		mb, err := tm.GetMultiManager().GetMultiBackend(tt.TransferBackendId)
+		if err == nil && mb.IsInMaintenance() {
+			return task.NewTaskResponse(false, ErrStringBackendInMaintenance)
+		}
+	}
+
+	// the registry of this proxy can have the backend of the other proxy, then no proxy transfer is needed
+	if tt.TransferBackendId != uuid.Nil && mp.GetId() != tt.TargetProxyId && connectWithRegistry(tm, t, tt.TransferBackendId) {
+		return task.NewTaskResponse(true, "")
+	}
+
+	if mp.IsInMaintenance() && mp.GetId() != tt.TargetProxyId && !bypass {
+		return task.NewTaskResponse(false, ErrStringProxyInMaintenance)
+	}
+
+	// within this proxy the balancer chooses the backend, other proxies choose it when the player joins
+	if tt.TransferBackendId == uuid.Nil && mp.GetId() == tt.TargetProxyId {
+		mb := chooseTransferBackend(tm, mp, player, bypass)
+		if mb != nil {
+			tt.TransferBackendId = mb.GetId()
+		}
+	}
+
 	tr := tm.BuildTask(NewTransferRequestTask(mp.GetId(), tt.TransferBackendId))
 	if !tr.IsSuccessful() {
 		return tr
@@ -54,8 +89,8 @@ func (tt *TransferTask) PerformTask(tm *task.TaskManager) *task.TaskResponse {
 
 	// tr.GetInfo() will be one of four things:
 	// 0, given backend is not found
-	// 1, given backend is found but not responding
-	// 2, given backend is found and responding
+	// 1, given backend is found but offline in the last health check
+	// 2, given backend is found and available
 	// 3, no backend is specified
 
 	if tr.GetInfo() == "0" {
@@ -72,7 +107,7 @@ func (tt *TransferTask) PerformTask(tm *task.TaskManager) *task.TaskResponse {
 		if tt.TargetProxyId == tt.TransferProxyId {
 			mb, err := tm.GetMultiManager().GetMultiBackend(tt.TransferBackendId)
 			if err == nil {
-				_, err := t.CreateConnectionRequest(tm.GetOwnerGate().Server(mb.GetName())).Connect(context.Background())
+				_, err := t.CreateConnectionRequest(tm.GetRegistry().GetServer(mb)).Connect(context.Background())
 				if err == nil {
 					tm.GetLogger().Info("player internal transfer successful", "playerId", t.ID(), "backendId", mb.GetId())
 					return task.NewTaskResponse(true, "")
@@ -106,6 +141,96 @@ func (tt *TransferTask) PerformTask(tm *task.TaskManager) *task.TaskResponse {
 	return task.NewTaskResponse(true, "")
 }
 
+// Connects the player to the backend of another proxy through the registry. Returns false when the player still needs a proxy transfer.
+func connectWithRegistry(tm *task.TaskManager, t proxy.Player, backendId uuid.UUID) bool {
+	mb, err := tm.GetMultiManager().GetMultiBackend(backendId)
+	if err != nil || !mb.IsAvailable() {
+		return false
+	}
+
+	s := tm.GetRegistry().GetServer(mb)
+	if s == nil {
+		return false
+	}
+
+	_, err = t.CreateConnectionRequest(s).Connect(context.Background())
+	if err != nil {
+		tm.GetLogger().Warn("transfer with registry create connection request error", "playerId", t.ID(), "targetBackendId", backendId, "error", err)
+		return false
+	}
+
+	tm.GetLogger().Info("player transfer with registry successful", "playerId", t.ID(), "backendId", backendId, "backendProxyId", mb.GetMultiProxy().GetId())
+	return true
+}
+
+// Returns the backend of the proxy the balancer chooses, leaving out the current backend of the player.
+// Backends in the group of the current backend are chosen first. Can return nil.
+func chooseTransferBackend(tm *task.TaskManager, mp *multi.Proxy, player *multi.Player, bypass bool) *multi.Backend {
+	l := tm.GetMultiManager().GetAllMultiBackendsUnderMultiProxy(mp)
+
+	if player != nil && player.GetBackend() != nil {
+		group := player.GetBackend().GetGroup()
+		mb := chooseBackend(tm, inGroup(l, group), group, player, bypass)
+		if mb != nil {
+			return mb
+		}
+	}
+
+	return chooseBackend(tm, l, balancer.DefaultGroup, player, bypass)
+}
+
+// Returns the backend in the group the balancer chooses, out of every proxy that takes players. Backends on the current
+// proxy of the player, or in the registry when it is enabled, are chosen first, so the player doesn't need a proxy transfer. Can return nil.
+func ChooseGroupBackend(tm *task.TaskManager, group string, player *multi.Player, bypass bool) *multi.Backend {
+	mm := tm.GetMultiManager()
+	available := mm.GetAvailableMultiProxies(true)
+
+	var own, other []*multi.Backend
+	for _, mb := range mm.GetBackendsInGroup(group) {
+		if player != nil && (mb.GetMultiProxy() == player.GetProxy() || tm.GetRegistry().IsEnabled()) {
+			own = append(own, mb)
+		} else if bypass || slices.Contains(available, mb.GetMultiProxy()) {
+			other = append(other, mb)
+		}
+	}
+
+	mb := chooseBackend(tm, own, group, player, bypass)
+	if mb != nil {
+		return mb
+	}
+
+	return chooseBackend(tm, other, group, player, bypass)
+}
+
+// The balancer chooses one of the backends that are not in maintenance, not offline and not the current backend of the player.
+func chooseBackend(tm *task.TaskManager, l []*multi.Backend, group string, player *multi.Player, bypass bool) *multi.Backend {
+	var candidates []*multi.Backend
+	for _, mb := range l {
+		if mb.IsInMaintenance() && !bypass || !mb.IsAvailable() {
+			continue
+		}
+
+		if player != nil && player.GetBackend() == mb {
+			continue
+		}
+
+		candidates = append(candidates, mb)
+	}
+
+	return tm.GetMultiManager().GetBalancer().Choose(group, player, candidates)
+}
+
+func inGroup(l []*multi.Backend, group string) []*multi.Backend {
+	var g []*multi.Backend
+	for _, mb := range l {
+		if mb.IsInGroup(group) {
+			g = append(g, mb)
+		}
+	}
+
+	return g
+}
+
 func (tt *TransferTask) GetTargetProxyId() uuid.UUID {
 	return tt.TargetProxyId
 }
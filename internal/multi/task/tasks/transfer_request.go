@@ -2,7 +2,6 @@ package tasks
 
 import (
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
-	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
@@ -29,7 +28,8 @@ func (trt *TransferRequestTask) PerformTask(tm *task.TaskManager) *task.TaskResp
 		return task.NewTaskResponse(true, "0")
 	}
 
-	if !util.IsBackendResponding(b.GetAddress()) {
+	// the health manager of the owner proxy checks the backend, so nothing is dialed here
+	if !b.IsAvailable() {
 		return task.NewTaskResponse(true, "1")
 	}
 
@@ -0,0 +1,171 @@
+package multi
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// Format of the update messages. Needs to be raised when the message changes in a way older proxies can't read.
+const UpdateFormat = 1
+
+// Separates the keys of an old (non json) update message in which several keys changed at once.
+// Example: proxyId_playerId_ban.banned,ban.reason
+const UpdateKeySeparator = ","
+
+type UpdateAction string
+
+const (
+	UpdateAction_Update UpdateAction = "update"
+	UpdateAction_New    UpdateAction = "new"
+	UpdateAction_Delete UpdateAction = "delete"
+)
+
+var ErrIncorrectUpdateMessage = errors.New("incorrect update message")
+
+// The message sent on the update channels. It contains the changed values,
+// so other proxies can apply them without reading the database again.
+type UpdateMessage struct {
+	Format int          `json:"format"`
+	Origin uuid.UUID    `json:"origin"`
+	Id     uuid.UUID    `json:"id"`
+	Action UpdateAction `json:"action"`
+
+	// Increases with every message sent by the origin. Based on the time, so it also increases after a restart.
+	// Only compared with the versions of the same origin, the clocks of the proxies can differ.
+	Version uint64 `json:"version"`
+
+	Keys []string `json:"keys,omitempty"`
+
+	// The new values of the keys. A key without value has to be read from the database.
+	Values map[string]json.RawMessage `json:"values,omitempty"`
+}
+
+var lastUpdateVersion atomic.Uint64
+
+// Returns a version higher than every version returned before.
+func nextUpdateVersion() uint64 {
+	for {
+		last := lastUpdateVersion.Load()
+		v := max(uint64(time.Now().UnixNano()), last+1)
+		if lastUpdateVersion.CompareAndSwap(last, v) {
+			return v
+		}
+	}
+}
+
+func newUpdateMessage(origin, id uuid.UUID, action UpdateAction) *UpdateMessage {
+	return &UpdateMessage{
+		Format:  UpdateFormat,
+		Origin:  origin,
+		Id:      id,
+		Action:  action,
+		Version: nextUpdateVersion(),
+	}
+}
+
+// Creates the message for a new or deleted object.
+func NewUpdateMessage(origin, id uuid.UUID, action UpdateAction) (string, error) {
+	return newUpdateMessage(origin, id, action).encode()
+}
+
+// Creates the message for changed values.
+func newValuesUpdateMessage[K ~string](origin, id uuid.UUID, fields map[K]any) (string, error) {
+	um := newUpdateMessage(origin, id, UpdateAction_Update)
+	um.Values = make(map[string]json.RawMessage, len(fields))
+
+	for _, k := range sortedKeys(fields) {
+		val, err := json.Marshal(fields[k])
+		if err != nil {
+			return "", err
+		}
+
+		um.Keys = append(um.Keys, string(k))
+		um.Values[string(k)] = val
+	}
+
+	return um.encode()
+}
+
+func (um *UpdateMessage) encode() (string, error) {
+	b, err := json.Marshal(um)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// Reads an update message. Messages in the old format (origin_id_key) are still accepted,
+// they don't contain values or a version.
+func ParseUpdateMessage(m string) (*UpdateMessage, error) {
+	if strings.HasPrefix(m, "{") {
+		var um UpdateMessage
+		err := json.Unmarshal([]byte(m), &um)
+		if err != nil {
+			return nil, err
+		}
+
+		if um.Format > UpdateFormat {
+			return nil, ErrIncorrectUpdateMessage
+		}
+
+		return &um, nil
+	}
+
+	s := strings.Split(m, "_")
+	if len(s) != 3 {
+		return nil, ErrIncorrectUpdateMessage
+	}
+
+	origin, err := uuid.Parse(s[0])
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(s[1])
+	if err != nil {
+		return nil, err
+	}
+
+	um := &UpdateMessage{
+		Origin: origin,
+		Id:     id,
+		Action: UpdateAction_Update,
+	}
+
+	switch UpdateAction(s[2]) {
+	case UpdateAction_New, UpdateAction_Delete:
+		um.Action = UpdateAction(s[2])
+	default:
+		um.Keys = strings.Split(s[2], UpdateKeySeparator)
+	}
+
+	return um, nil
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// The list with the value added, like the database would return it.
+func listWithValue(l []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	if slices.Contains(l, id) {
+		return l
+	}
+
+	return append(slices.Clone(l), id)
+}
+
+// The list without the value, like the database would return it.
+func listWithoutValue(l []uuid.UUID, id uuid.UUID) []uuid.UUID {
+	return slices.DeleteFunc(slices.Clone(l), func(v uuid.UUID) bool {
+		return v == id
+	})
+}
@@ -1,16 +1,201 @@
 package util
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
+	"strconv"
 	"time"
 )
 
 const ErrStringBackendNotResponding = "backend not responding"
 
-func IsBackendResponding(backend string) bool {
-	conn, err := net.DialTimeout("tcp", backend, time.Second*5)
-	if err == nil {
-		conn.Close()
+var ErrIncorrectPingResponse = errors.New("incorrect server list ping response")
+
+// The answer of a backend to a server list ping.
+type ServerListPing struct {
+	// time between sending the ping and receiving the pong
+	Latency     time.Duration
+	Version     string
+	Protocol    int
+	PlayerCount int
+	MaxPlayers  int
+}
+
+type statusResponse struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+}
+
+// the largest status response allowed by the protocol
+const maxStatusLength = 32767 * 4
+
+// Does the server list ping of the minecraft protocol, like a client does for the server list.
+func PingBackend(addr string, timeout time.Duration) (*ServerListPing, error) {
+	host, p, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	// handshake with next state status, protocol -1 is used when the version is not known
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, 0x00)
+	writeVarInt(&handshake, -1)
+	writeVarInt(&handshake, int32(len(host)))
+	handshake.WriteString(host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, 1)
+
+	// status request
+	var request bytes.Buffer
+	writeVarInt(&request, 0x00)
+
+	err = writePackets(conn, handshake.Bytes(), request.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	payload, err := readPacket(r, 0x00)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := bytes.NewReader(payload)
+	l, err := readVarInt(pr)
+	if err != nil {
+		return nil, err
+	}
+
+	if l < 0 || int(l) > pr.Len() {
+		return nil, ErrIncorrectPingResponse
+	}
+
+	var status statusResponse
+	err = json.Unmarshal(payload[len(payload)-pr.Len():][:l], &status)
+	if err != nil {
+		return nil, err
 	}
-	return err == nil
+
+	// ping with the current time, the pong returns the same value
+	var ping bytes.Buffer
+	writeVarInt(&ping, 0x01)
+	now := time.Now()
+	binary.Write(&ping, binary.BigEndian, now.UnixMilli())
+
+	err = writePackets(conn, ping.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = readPacket(r, 0x01)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerListPing{
+		Latency:     time.Since(now),
+		Version:     status.Version.Name,
+		Protocol:    status.Version.Protocol,
+		PlayerCount: status.Players.Online,
+		MaxPlayers:  status.Players.Max,
+	}, nil
+}
+
+// Writes every packet with its length in front.
+func writePackets(w io.Writer, packets ...[]byte) error {
+	var b bytes.Buffer
+	for _, p := range packets {
+		writeVarInt(&b, int32(len(p)))
+		b.Write(p)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Reads a packet and returns its payload. The packet must have the id.
+func readPacket(r *bufio.Reader, id int32) ([]byte, error) {
+	l, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l <= 0 || l > maxStatusLength {
+		return nil, ErrIncorrectPingResponse
+	}
+
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bytes.NewReader(b)
+	pid, err := readVarInt(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if pid != id {
+		return nil, ErrIncorrectPingResponse
+	}
+
+	return b[len(b)-br.Len():], nil
+}
+
+func writeVarInt(b *bytes.Buffer, v int32) {
+	u := uint32(v)
+	for {
+		if u&^0x7f == 0 {
+			b.WriteByte(byte(u))
+			return
+		}
+
+		b.WriteByte(byte(u&0x7f) | 0x80)
+		u >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+
+	return 0, ErrIncorrectPingResponse
 }
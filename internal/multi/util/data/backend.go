@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"go.minekube.com/gate/pkg/util/uuid"
 )
@@ -14,6 +15,40 @@ type BackendData struct {
 	Proxy       uuid.UUID   `json:"proxy"`
 	Maintenance bool        `json:"maintenance"`
 	Players     []uuid.UUID `json:"players"`
+	Group       string      `json:"group"`
+	Tags        []string    `json:"tags"`
+	// added with the backend command instead of the gate config
+	Managed bool `json:"managed,omitempty"`
+	// the discovery provider that found the backend
+	Discovery string `json:"discovery,omitempty"`
+
+	Health *BackendHealthData `json:"health,omitempty"`
+}
+
+// A backend added with the backend command. Every proxy registers it in gate, also after a restart.
+type ManagedBackendData struct {
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Group   string   `json:"group"`
+	Tags    []string `json:"tags"`
+}
+
+// The group and tags set with the backend command, kept by the name of the backend. Nil tags are not changed.
+type BackendOverrideData struct {
+	Group string   `json:"group,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+// The result of the last server list ping of the backend.
+type BackendHealthData struct {
+	// unknown, online or offline
+	Status      string     `json:"status"`
+	LatencyMs   int64      `json:"latencyMs"`
+	Version     string     `json:"version"`
+	Protocol    int        `json:"protocol"`
+	PlayerCount int        `json:"playerCount"`
+	MaxPlayers  int        `json:"maxPlayers"`
+	CheckedAt   *time.Time `json:"checkedAt"`
 }
 
 func (bd BackendData) Value() (driver.Value, error) {
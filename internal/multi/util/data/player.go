@@ -12,6 +12,8 @@ import (
 type PlayerData struct {
 	Proxy   uuid.UUID `json:"proxy"`
 	Backend uuid.UUID `json:"backend"`
+	// The name of the last backend the player was on.
+	LastBackend string `json:"lastBackend"`
 
 	Username string `json:"username"`
 	Nickname string `json:"nickname"`
@@ -65,36 +67,3 @@ func (pd *PlayerData) Scan(value interface{}) error {
 		return errors.New("unsupported type for PlayerData Scan")
 	}
 }
-
-func (pd *PlayerData) InitializeDefaults() bool {
-	initialized := false
-
-	if pd.Permission == nil {
-		pd.Permission = &PermissionData{
-			Role: "default",
-			Rank: "default",
-		}
-		initialized = true
-	}
-
-	if pd.Ban == nil {
-		pd.Ban = &BanData{
-			Banned:      false,
-			Reason:      "",
-			Permanently: false,
-			Expiration:  time.Time{},
-		}
-		initialized = true
-	}
-
-	if pd.Friend == nil {
-		pd.Friend = &FriendData{
-			Friends:               make([]uuid.UUID, 0),
-			FriendRequests:        make([]uuid.UUID, 0),
-			FriendPendingRequests: make([]uuid.UUID, 0),
-		}
-		initialized = true
-	}
-
-	return initialized
-}
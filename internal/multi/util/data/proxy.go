@@ -10,6 +10,7 @@ import (
 )
 
 type ProxyData struct {
+	Name          string      `json:"name,omitempty"`
 	Address       string      `json:"address"`
 	Maintenance   bool        `json:"maintenance"`
 	Backends      []uuid.UUID `json:"backends"`
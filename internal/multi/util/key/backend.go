@@ -16,11 +16,17 @@ var ErrIncorrectBackendKey = errors.New("incorrect backend key")
 const (
 	BackendKey_Maintenance BackendKey = "maintenance"
 	BackendKey_PlayerList  BackendKey = "players"
+	BackendKey_Health      BackendKey = "health"
+	BackendKey_Group       BackendKey = "group"
+	BackendKey_Tags        BackendKey = "tags"
 )
 
 var AllowedBackendKeys = []BackendKey{
 	BackendKey_Maintenance,
 	BackendKey_PlayerList,
+	BackendKey_Health,
+	BackendKey_Group,
+	BackendKey_Tags,
 }
 
 func GetBackendKey(s string) (BackendKey, error) {
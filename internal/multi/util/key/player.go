@@ -19,6 +19,9 @@ const (
 	PlayerKey_Username PlayerKey = "username"
 	PlayerKey_Nickname PlayerKey = "nickname"
 
+	// name of the last backend the player was on, kept after leaving
+	PlayerKey_LastBackend PlayerKey = "lastBackend"
+
 	PlayerKey_Friend_Friends               PlayerKey = "friend.friends"
 	PlayerKey_Friend_FriendRequests        PlayerKey = "friend.friendRequests"
 	PlayerKey_Friend_FriendPendingRequests PlayerKey = "friend.friendPendingRequests"
@@ -42,6 +45,7 @@ const (
 var AllowedPlayerKeys = []PlayerKey{
 	PlayerKey_Proxy,
 	PlayerKey_Backend,
+	PlayerKey_LastBackend,
 	PlayerKey_Username,
 	PlayerKey_Nickname,
 
@@ -0,0 +1,311 @@
+package commands
+
+import (
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/manager"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"github.com/team-vesperis/vesperis-mp/internal/proxy/registry"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// without dots, the name is used as key in the config
+var backendNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,63}$`)
+
+// The backend command adds and removes backends on every proxy and changes the group and the tags of a backend.
+// The group is used to choose where players are sent to.
+func (cm *CommandManager) backendCommand(name string) brigodier.LiteralNodeBuilder {
+	return brigodier.Literal(name).
+		Requires(cm.requireAdmin()).
+		Executes(cm.executeIncorrectUsage("/backend <add|remove|list|info|group|tag> ...")).
+		Then(brigodier.Literal("add").
+			Executes(cm.executeIncorrectUsage("/backend add <name> <address> [group]")).
+			Then(brigodier.Argument("name", brigodier.SingleWord).
+				Executes(cm.executeIncorrectUsage("/backend add <name> <address> [group]")).
+				// the rest of the line, a word argument can't hold the colon of the port
+				Then(brigodier.Argument("address", brigodier.StringPhrase).
+					Executes(cm.executeBackendAdd())))).
+		Then(brigodier.Literal("remove").
+			Executes(cm.executeIncorrectUsage("/backend remove <name>")).
+			Then(brigodier.Argument("name", brigodier.SingleWord).
+				Suggests(cm.suggestManagedBackends()).
+				Executes(cm.executeBackendRemove()))).
+		Then(brigodier.Literal("list").
+			Executes(cm.executeBackendList())).
+		Then(brigodier.Literal("info").
+			Executes(cm.executeIncorrectUsage("/backend info <backend>")).
+			Then(brigodier.Argument("backend", brigodier.SingleWord).
+				Suggests(cm.suggestAllMultiBackends(false)).
+				Executes(cm.executeBackendInfo()))).
+		Then(brigodier.Literal("group").
+			Executes(cm.executeIncorrectUsage("/backend group <backend> <group>")).
+			Then(brigodier.Argument("backend", brigodier.SingleWord).
+				Suggests(cm.suggestAllMultiBackends(false)).
+				Executes(cm.executeIncorrectUsage("/backend group <backend> <group>")).
+				Then(brigodier.Argument("group", brigodier.SingleWord).
+					Suggests(cm.suggestAllBackendGroups()).
+					Executes(cm.executeBackendGroup())))).
+		Then(brigodier.Literal("tag").
+			Executes(cm.executeIncorrectUsage("/backend tag <backend> <add|remove> <tag>")).
+			Then(brigodier.Argument("backend", brigodier.SingleWord).
+				Suggests(cm.suggestAllMultiBackends(false)).
+				Executes(cm.executeIncorrectUsage("/backend tag <backend> <add|remove> <tag>")).
+				Then(brigodier.Literal("add").
+					Executes(cm.executeIncorrectUsage("/backend tag <backend> add <tag>")).
+					Then(brigodier.Argument("tag", brigodier.SingleWord).
+						Executes(cm.executeBackendTag(true)))).
+				Then(brigodier.Literal("remove").
+					Executes(cm.executeIncorrectUsage("/backend tag <backend> remove <tag>")).
+					Then(brigodier.Argument("tag", brigodier.SingleWord).
+						Suggests(cm.suggestBackendTags()).
+						Executes(cm.executeBackendTag(false))))))
+}
+
+// The address argument holds the address and the optional group.
+// The address can be given without port, then the default minecraft port is used.
+func (cm *CommandManager) executeBackendAdd() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		name := c.String("name")
+		if !backendNameRegex.MatchString(name) {
+			c.SendMessage(util.TextWarn("Invalid name. Only letters, numbers, dashes and underscores are allowed."))
+			return nil
+		}
+
+		args := strings.Fields(c.String("address"))
+		if len(args) == 0 || len(args) > 2 {
+			c.SendMessage(util.TextWarn("Incorrect usage: /backend add <name> <address> [group]"))
+			return nil
+		}
+
+		address := args[0]
+		_, _, err := net.SplitHostPort(address)
+		if err != nil {
+			address = net.JoinHostPort(address, "25565")
+		}
+
+		md := data.ManagedBackendData{
+			Name:    name,
+			Address: address,
+		}
+
+		if len(args) == 2 {
+			md.Group, err = config.GetBackendGroupName(strings.ToLower(args[1]))
+			if err != nil {
+				c.SendMessage(util.TextWarn("Invalid group. Only letters, numbers, dashes and underscores are allowed."))
+				return nil
+			}
+		}
+
+		err = cm.tm.GetRegistry().AddBackend(md)
+		if err != nil {
+			if err == registry.ErrBackendNameTaken || err == manager.ErrManagedBackendExists {
+				c.SendMessage(util.TextWarn("There is already a backend with that name."))
+				return nil
+			}
+
+			var addrErr *net.AddrError
+			var dnsErr *net.DNSError
+			if errors.As(err, &addrErr) || errors.As(err, &dnsErr) {
+				c.SendMessage(util.TextWarn("Invalid address."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not add backend.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Added backend " + name + " with address " + address + ". Every proxy registers it."))
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeBackendRemove() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		name := c.String("name")
+
+		err := cm.tm.GetRegistry().RemoveBackend(name)
+		if err != nil {
+			if err == manager.ErrManagedBackendNotFound {
+				c.SendMessage(util.TextWarn("Backend not found. Only backends added with /backend add can be removed."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not remove backend.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Removed backend " + name + " from every proxy."))
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeBackendList() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		for _, group := range cm.mm.GetAllBackendGroups() {
+			c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue), "Group: ", group))
+
+			l := cm.mm.GetBackendsInGroup(group)
+			slices.SortFunc(l, func(a, b *multi.Backend) int {
+				return strings.Compare(a.GetName()+a.GetMultiProxy().GetName(), b.GetName()+b.GetMultiProxy().GetName())
+			})
+
+			for _, mb := range l {
+				c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue),
+					" - ", mb.GetName(),
+					" proxy: ", mb.GetMultiProxy().GetName(),
+					" status: ", string(mb.GetStatus()),
+					" players: ", strconv.Itoa(len(mb.GetPlayerIds()))))
+			}
+		}
+
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeBackendInfo() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		mb, err := cm.findBackendForCommand(c, "Could not get backend info.")
+		if mb == nil {
+			return err
+		}
+
+		h := mb.GetHealth()
+		checked := "never"
+		if h.CheckedAt != nil {
+			checked = time.Since(*h.CheckedAt).Round(time.Second).String() + " ago"
+		}
+
+		colors := util.ColorList(util.ColorLightGreen, util.ColorLightBlue)
+		c.SendMessage(util.TextAlternatingColors(colors, "Backend: ", mb.GetName()))
+		c.SendMessage(util.TextAlternatingColors(colors, "Id: ", mb.GetId().String()))
+		c.SendMessage(util.TextAlternatingColors(colors, "Address: ", mb.GetAddress()))
+		c.SendMessage(util.TextAlternatingColors(colors, "Proxy: ", mb.GetMultiProxy().GetName()))
+		c.SendMessage(util.TextAlternatingColors(colors, "Group: ", mb.GetGroup()))
+		c.SendMessage(util.TextAlternatingColors(colors, "Tags: ", strings.Join(mb.GetTags(), ", ")))
+		c.SendMessage(util.TextAlternatingColors(colors, "Added with command: ", strconv.FormatBool(mb.IsManaged())))
+		if mb.GetDiscovery() != "" {
+			c.SendMessage(util.TextAlternatingColors(colors, "Discovered by: ", mb.GetDiscovery()))
+		}
+		c.SendMessage(util.TextAlternatingColors(colors, "Maintenance: ", strconv.FormatBool(mb.IsInMaintenance())))
+		c.SendMessage(util.TextAlternatingColors(colors, "Players: ", strconv.Itoa(len(mb.GetPlayerIds()))))
+		c.SendMessage(util.TextAlternatingColors(colors, "Status: ", h.Status, " checked: ", checked))
+		c.SendMessage(util.TextAlternatingColors(colors, "Latency: ", strconv.FormatInt(h.LatencyMs, 10)+"ms"))
+		c.SendMessage(util.TextAlternatingColors(colors, "Version: ", h.Version, " protocol: ", strconv.Itoa(h.Protocol)))
+		c.SendMessage(util.TextAlternatingColors(colors, "Online: ", strconv.Itoa(h.PlayerCount)+"/"+strconv.Itoa(h.MaxPlayers)))
+		return nil
+	})
+}
+
+func (cm *CommandManager) suggestManagedBackends() brigodier.SuggestionProvider {
+	return command.SuggestFunc(func(c *command.Context, b *brigodier.SuggestionsBuilder) *brigodier.Suggestions {
+		r := b.RemainingLowerCase
+
+		for _, name := range cm.mm.GetManagedBackendNames() {
+			if strings.HasPrefix(strings.ToLower(name), r) {
+				b.Suggest(name)
+			}
+		}
+
+		return b.Build()
+	})
+}
+
+// sends a message when the backend is not found. can return nil
+func (cm *CommandManager) findBackendForCommand(c *command.Context, errorMessage string) (*multi.Backend, error) {
+	mb, err := cm.mm.FindMultiBackend(c.String("backend"))
+	if err != nil {
+		if err == database.ErrDataNotFound || err == multi.ErrBackendNotFound {
+			c.SendMessage(util.TextWarn("Backend not found."))
+			return nil, nil
+		}
+
+		c.SendMessage(util.TextInternalError(errorMessage, err))
+		return nil, err
+	}
+
+	return mb, nil
+}
+
+func (cm *CommandManager) executeBackendGroup() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		group, err := config.GetBackendGroupName(strings.ToLower(c.String("group")))
+		if err != nil {
+			c.SendMessage(util.TextWarn("Invalid group. Only letters, numbers, dashes and underscores are allowed."))
+			return nil
+		}
+
+		mb, err := cm.findBackendForCommand(c, "Could not change group.")
+		if mb == nil {
+			return err
+		}
+
+		err = cm.mm.SetBackendGroup(mb, group)
+		if err != nil {
+			c.SendMessage(util.TextInternalError("Could not change group.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Backend " + mb.GetName() + " is now in group " + group + "."))
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeBackendTag(add bool) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		tag := c.String("tag")
+
+		mb, err := cm.findBackendForCommand(c, "Could not change tags.")
+		if mb == nil {
+			return err
+		}
+
+		err = cm.mm.ChangeBackendTag(mb, tag, add)
+		if err != nil {
+			if err == multi.ErrTagNotFound {
+				c.SendMessage(util.TextWarn("Backend doesn't have that tag."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not change tags.", err))
+			return err
+		}
+
+		if add {
+			c.SendMessage(util.TextSuccessful("Added tag " + tag + " to backend " + mb.GetName() + "."))
+		} else {
+			c.SendMessage(util.TextSuccessful("Removed tag " + tag + " from backend " + mb.GetName() + "."))
+		}
+
+		return nil
+	})
+}
+
+func (cm *CommandManager) suggestBackendTags() brigodier.SuggestionProvider {
+	return command.SuggestFunc(func(c *command.Context, b *brigodier.SuggestionsBuilder) *brigodier.Suggestions {
+		r := b.RemainingLowerCase
+
+		mb, err := cm.mm.FindMultiBackend(c.String("backend"))
+		if err != nil {
+			return b.Build()
+		}
+
+		for _, t := range mb.GetTags() {
+			if strings.HasPrefix(strings.ToLower(t), r) {
+				b.Suggest(t)
+			}
+		}
+
+		return b.Build()
+	})
+}
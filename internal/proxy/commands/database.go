@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"strconv"
+
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/brigodier"
@@ -40,5 +42,25 @@ func (cm CommandManager) databaseCommand(name string) brigodier.LiteralNodeBuild
 
 						c.SendMessage(util.TextSuccessful("Successfully set value in database."))
 						return nil
-					})))))
+					}))))).
+		Then(brigodier.Literal("cache").
+			Executes(command.Command(func(c *command.Context) error {
+				s := cm.mm.GetPlayerCacheStats()
+				c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue),
+					"Player cache: ", strconv.Itoa(s.Size)+"/"+strconv.Itoa(s.MaxSize),
+					" Hits: ", strconv.FormatUint(s.Hits, 10),
+					" Misses: ", strconv.FormatUint(s.Misses, 10),
+					" Evictions: ", strconv.FormatUint(s.Evictions, 10)))
+				return nil
+			}))).
+		Then(brigodier.Literal("health").
+			Executes(command.Command(func(c *command.Context) error {
+				h := cm.db.Health()
+				c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue),
+					"Health: ", string(h.Health),
+					" Data: ", string(h.Data),
+					" Messaging: ", string(h.Messaging),
+					" Queued writes: ", strconv.Itoa(h.Journal)))
+				return nil
+			})))
 }
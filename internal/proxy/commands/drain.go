@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// The drain command moves all players of a proxy to other proxies, for example before restarting it.
+func (cm *CommandManager) drainCommand(name string) brigodier.LiteralNodeBuilder {
+	return brigodier.Literal(name).
+		Requires(cm.requireAdmin()).
+		Executes(cm.executeIncorrectUsage("/drain <proxy> [start|cancel|status]")).
+		Then(brigodier.Argument("proxy", brigodier.SingleWord).
+			Suggests(cm.suggestAllMultiProxies(false)).
+			Executes(cm.executeDrain(tasks.DrainAction_Status)).
+			Then(brigodier.Literal("start").
+				Executes(cm.executeDrain(tasks.DrainAction_Start))).
+			Then(brigodier.Literal("cancel").
+				Executes(cm.executeDrain(tasks.DrainAction_Cancel))).
+			Then(brigodier.Literal("status").
+				Executes(cm.executeDrain(tasks.DrainAction_Status))))
+}
+
+func (cm *CommandManager) executeDrain(action tasks.DrainAction) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		mp, err := cm.mm.FindMultiProxy(c.String("proxy"))
+		if err != nil {
+			if err == database.ErrDataNotFound {
+				c.SendMessage(util.TextWarn("Proxy not found."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not drain.", err))
+			return err
+		}
+
+		tr := cm.tm.BuildTask(tasks.NewDrainTask(mp.GetId(), action))
+		if !tr.IsSuccessful() {
+			if tr.GetInfo() == tasks.ErrAlreadyDraining.Error() {
+				c.SendMessage(util.TextWarn("Proxy is already draining."))
+				return nil
+			}
+
+			if tr.GetInfo() == tasks.ErrNotDraining.Error() {
+				c.SendMessage(util.TextWarn("Proxy is not draining."))
+				return nil
+			}
+
+			err := errors.New(tr.GetInfo())
+			c.SendMessage(util.TextInternalError("Could not drain.", err))
+			return err
+		}
+
+		switch action {
+		case tasks.DrainAction_Start:
+			c.SendMessage(util.TextSuccessful("Started draining proxy " + mp.GetName() + "."))
+		case tasks.DrainAction_Cancel:
+			c.SendMessage(util.TextSuccessful("Cancelled draining proxy " + mp.GetName() + "."))
+		}
+
+		c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue), "Proxy "+mp.GetName()+": ", tr.GetInfo()))
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"strconv"
+
+	"github.com/team-vesperis/vesperis-mp/internal/database"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
+	"go.minekube.com/brigodier"
+	"go.minekube.com/gate/pkg/command"
+)
+
+// The maintenance command keeps players out of the network, a proxy or a backend. Players with a bypass role can still join.
+func (cm *CommandManager) maintenanceCommand(name string) brigodier.LiteralNodeBuilder {
+	return brigodier.Literal(name).
+		Requires(cm.requireAdmin()).
+		Executes(cm.executeMaintenanceStatus()).
+		Then(brigodier.Literal("network").
+			Executes(cm.executeIncorrectUsage("/maintenance network <on|off>")).
+			Then(brigodier.Literal("on").
+				Executes(cm.executeNetworkMaintenance(true))).
+			Then(brigodier.Literal("off").
+				Executes(cm.executeNetworkMaintenance(false)))).
+		Then(brigodier.Literal("proxy").
+			Executes(cm.executeIncorrectUsage("/maintenance proxy <proxy> <on|off>")).
+			Then(brigodier.Argument("proxy", brigodier.SingleWord).
+				Suggests(cm.suggestAllMultiProxies(false)).
+				Executes(cm.executeIncorrectUsage("/maintenance proxy <proxy> <on|off>")).
+				Then(brigodier.Literal("on").
+					Executes(cm.executeProxyMaintenance(true))).
+				Then(brigodier.Literal("off").
+					Executes(cm.executeProxyMaintenance(false))))).
+		Then(brigodier.Literal("backend").
+			Executes(cm.executeIncorrectUsage("/maintenance backend <backend> <on|off>")).
+			Then(brigodier.Argument("backend", brigodier.SingleWord).
+				Suggests(cm.suggestAllMultiBackends(false)).
+				Executes(cm.executeIncorrectUsage("/maintenance backend <backend> <on|off>")).
+				Then(brigodier.Literal("on").
+					Executes(cm.executeBackendMaintenance(true))).
+				Then(brigodier.Literal("off").
+					Executes(cm.executeBackendMaintenance(false)))))
+}
+
+func (cm *CommandManager) executeMaintenanceStatus() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue),
+			"Network maintenance: ", strconv.FormatBool(cm.mm.IsNetworkInMaintenance())))
+
+		for _, mp := range cm.mm.GetAllMultiProxies() {
+			if mp.IsInMaintenance() {
+				c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue), "Proxy in maintenance: ", mp.GetName()))
+			}
+		}
+
+		for _, mb := range cm.mm.GetAllMultiBackends() {
+			if mb.IsInMaintenance() {
+				c.SendMessage(util.TextAlternatingColors(util.ColorList(util.ColorLightGreen, util.ColorLightBlue), "Backend in maintenance: ", mb.GetName()+" ("+mb.GetId().String()+")"))
+			}
+		}
+
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeNetworkMaintenance(maintenance bool) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		err := cm.mm.SetNetworkInMaintenance(maintenance)
+		if err != nil {
+			c.SendMessage(util.TextInternalError("Could not change maintenance.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Network maintenance " + maintenanceState(maintenance) + "."))
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeProxyMaintenance(maintenance bool) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		mp, err := cm.mm.FindMultiProxy(c.String("proxy"))
+		if err != nil {
+			if err == database.ErrDataNotFound {
+				c.SendMessage(util.TextWarn("Proxy not found."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not change maintenance.", err))
+			return err
+		}
+
+		err = mp.SetInMaintenance(maintenance)
+		if err != nil {
+			c.SendMessage(util.TextInternalError("Could not change maintenance.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Maintenance of proxy " + mp.GetName() + " " + maintenanceState(maintenance) + "."))
+		return nil
+	})
+}
+
+func (cm *CommandManager) executeBackendMaintenance(maintenance bool) brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		mb, err := cm.mm.FindMultiBackend(c.String("backend"))
+		if err != nil {
+			if err == database.ErrDataNotFound || err == multi.ErrBackendNotFound {
+				c.SendMessage(util.TextWarn("Backend not found."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not change maintenance.", err))
+			return err
+		}
+
+		err = mb.SetInMaintenance(maintenance)
+		if err != nil {
+			c.SendMessage(util.TextInternalError("Could not change maintenance.", err))
+			return err
+		}
+
+		c.SendMessage(util.TextSuccessful("Maintenance of backend " + mb.GetName() + " " + maintenanceState(maintenance) + "."))
+		return nil
+	})
+}
+
+func maintenanceState(maintenance bool) string {
+	if maintenance {
+		return "enabled"
+	}
+
+	return "disabled"
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/manager"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/brigodier"
 	"go.minekube.com/common/minecraft/color"
@@ -21,18 +22,20 @@ import (
 type CommandManager struct {
 	m  *command.Manager
 	l  *logger.Logger
-	db *database.Database
+	db database.Storage
 	mm *manager.MultiManager
 	tm *task.TaskManager
+	dm *tasks.DrainManager
 }
 
-func Init(p *proxy.Proxy, l *logger.Logger, db *database.Database, mm *manager.MultiManager, tm *task.TaskManager) (*CommandManager, error) {
+func Init(p *proxy.Proxy, l *logger.Logger, db database.Storage, mm *manager.MultiManager, tm *task.TaskManager, dm *tasks.DrainManager) (*CommandManager, error) {
 	cm := &CommandManager{
 		m:  p.Command(),
 		l:  l,
 		db: db,
 		mm: mm,
 		tm: tm,
+		dm: dm,
 	}
 
 	cm.registerCommands()
@@ -43,6 +46,9 @@ func (cm *CommandManager) registerCommands() {
 	cm.m.Register(cm.databaseCommand("database"))
 	cm.m.Register(cm.databaseCommand("db"))
 	cm.m.Register(cm.refreshCommand("refresh"))
+	cm.m.Register(cm.drainCommand("drain"))
+	cm.m.Register(cm.maintenanceCommand("maintenance"))
+	cm.m.Register(cm.backendCommand("backend"))
 
 	cm.m.Register(cm.vanishCommand("vanish"))
 	cm.m.Register(cm.vanishCommand("v"))
@@ -103,25 +109,14 @@ var (
 
 func (cm *CommandManager) getMultiPlayerFromTarget(t string) (*multi.Player, error) {
 	// target can be a player name or an uuid
+	var mp *multi.Player
 	id, err := uuid.Parse(t)
 	if err != nil {
-		// try to get the id from a player name
-		l := cm.mm.GetAllMultiPlayers(false)
-
-		id = uuid.Nil
-		for _, mp := range l {
-			if t == mp.GetUsername() {
-				id = mp.GetId()
-				break
-			}
-		}
-
-		if id == uuid.Nil {
-			return nil, ErrTargetNotFound
-		}
+		mp, err = cm.mm.GetMultiPlayerByName(t)
+	} else {
+		mp, err = cm.mm.GetMultiPlayer(id)
 	}
 
-	mp, err := cm.mm.GetMultiPlayer(id)
 	if err != nil {
 		if err == database.ErrDataNotFound {
 			return nil, ErrTargetNotFound
@@ -204,9 +199,9 @@ func (cm *CommandManager) suggestAllMultiProxies(hideOwn bool) brigodier.Suggest
 				continue
 			}
 
-			id := mp.GetId().String()
-			if strings.HasPrefix(strings.ToLower(id), r) {
-				b.Suggest(id)
+			name := mp.GetName()
+			if strings.HasPrefix(strings.ToLower(name), r) {
+				b.Suggest(name)
 			}
 		}
 
@@ -249,21 +244,30 @@ func (cm *CommandManager) suggestAllMultiBackends(hideOwn bool) brigodier.Sugges
 	})
 }
 
-func (cm *CommandManager) suggestAllMultiBackendsUnderProxy(hideOwn bool) brigodier.SuggestionProvider {
+func (cm *CommandManager) suggestAllBackendGroups() brigodier.SuggestionProvider {
 	return command.SuggestFunc(func(c *command.Context, b *brigodier.SuggestionsBuilder) *brigodier.Suggestions {
 		r := b.RemainingLowerCase
 
-		ownProxyName := c.String("proxyId")
-		if ownProxyName == "" {
-			return b.Build()
+		for _, g := range cm.mm.GetAllBackendGroups() {
+			if strings.HasPrefix(g, r) {
+				b.Suggest(g)
+			}
 		}
 
-		id, err := uuid.Parse(ownProxyName)
-		if err != nil {
+		return b.Build()
+	})
+}
+
+func (cm *CommandManager) suggestAllMultiBackendsUnderProxy(hideOwn bool) brigodier.SuggestionProvider {
+	return command.SuggestFunc(func(c *command.Context, b *brigodier.SuggestionsBuilder) *brigodier.Suggestions {
+		r := b.RemainingLowerCase
+
+		ownProxyName := c.String("proxy")
+		if ownProxyName == "" {
 			return b.Build()
 		}
 
-		mp, err := cm.mm.GetMultiProxy(id)
+		mp, err := cm.mm.FindMultiProxy(ownProxyName)
 		if err != nil {
 			return b.Build()
 		}
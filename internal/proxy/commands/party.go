@@ -476,7 +476,8 @@ func (cm *CommandManager) leaveParty(mp *multi.Player, c *command.Context) (bool
 		}
 	} else {
 		if party.GetPartyOwner() == mp.GetId() {
-			err = party.SetPartyOwner(party.GetPartyMembers()[0])
+			// another proxy could have changed the owner in the meantime
+			_, err = party.CompareAndSetPartyOwner(mp.GetId(), party.GetPartyMembers()[0])
 			if err != nil {
 				c.SendMessage(util.TextInternalError("Could not leave party.", err))
 				return false, err
@@ -15,7 +15,7 @@ func (cm *CommandManager) refreshCommand(name string) brigodier.LiteralNodeBuild
 	return brigodier.Literal(name).
 		Requires(cm.requireAdmin()).
 		Executes(cm.executeRefresh(false)).
-		Then(brigodier.Argument("proxyId", brigodier.SingleWord).
+		Then(brigodier.Argument("proxy", brigodier.SingleWord).
 			Suggests(cm.suggestAllMultiProxies(false)).
 			Executes(cm.executeRefresh(true)))
 }
@@ -24,15 +24,7 @@ func (cm *CommandManager) executeRefresh(withTarget bool) brigodier.Command {
 	return command.Command(func(c *command.Context) error {
 		var proxyId uuid.UUID
 		if withTarget {
-			proxyString := c.String("proxyId")
-			var err error
-			proxyId, err = uuid.Parse(proxyString)
-			if err != nil {
-				c.SendMessage(util.TextWarn("Invalid Proxy UUID"))
-				return nil
-			}
-
-			_, err = cm.mm.GetMultiProxy(proxyId)
+			mp, err := cm.mm.FindMultiProxy(c.String("proxy"))
 			if err != nil {
 				if err == database.ErrDataNotFound {
 					c.SendMessage(util.TextWarn("Proxy not found."))
@@ -43,6 +35,7 @@ func (cm *CommandManager) executeRefresh(withTarget bool) brigodier.Command {
 				return err
 			}
 
+			proxyId = mp.GetId()
 		} else {
 			proxyId = cm.mm.GetOwnerMultiProxy().GetId()
 		}
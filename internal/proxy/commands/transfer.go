@@ -2,8 +2,11 @@ package commands
 
 import (
 	"errors"
+	"strings"
 
+	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/brigodier"
@@ -13,12 +16,17 @@ import (
 
 func (cm *CommandManager) transferCommand(name string) brigodier.LiteralNodeBuilder {
 	return brigodier.Literal(name).
-		Executes(cm.executeIncorrectUsage("/transfer <target> <proxyId> <backendId>")).
+		Executes(cm.executeIncorrectUsage("/transfer <target> <proxy> <backendId>")).
 		Requires(cm.requireAdmin()).
 		Then(brigodier.Argument("target", brigodier.SingleWord).
-			Executes(cm.executeIncorrectUsage("/transfer <target> <proxyId> <backendId>")).
+			Executes(cm.executeIncorrectUsage("/transfer <target> <proxy> <backendId>")).
 			Suggests(cm.suggestAllMultiPlayers(true, false)).
-			Then(brigodier.Argument("proxyId", brigodier.SingleWord).
+			Then(brigodier.Literal("group").
+				Executes(cm.executeIncorrectUsage("/transfer <target> group <group>")).
+				Then(brigodier.Argument("group", brigodier.SingleWord).
+					Suggests(cm.suggestAllBackendGroups()).
+					Executes(cm.executeGroupTransfer()))).
+			Then(brigodier.Argument("proxy", brigodier.SingleWord).
 				Suggests(cm.suggestAllMultiProxies(false)).
 				Executes(cm.executeTransfer(false)).
 				Then(brigodier.Argument("backendId", brigodier.SingleWord).
@@ -28,12 +36,18 @@ func (cm *CommandManager) transferCommand(name string) brigodier.LiteralNodeBuil
 
 func (cm *CommandManager) executeTransfer(withBackend bool) brigodier.Command {
 	return command.Command(func(c *command.Context) error {
-		proxyString := c.String("proxyId")
-		proxyId, err := uuid.Parse(proxyString)
+		// the proxy can be given by name or id
+		tp, err := cm.mm.FindMultiProxy(c.String("proxy"))
 		if err != nil {
-			c.SendMessage(util.TextWarn("Invalid Proxy UUID"))
-			return nil
+			if err == database.ErrDataNotFound {
+				c.SendMessage(util.TextWarn("Proxy not found."))
+				return nil
+			}
+
+			c.SendMessage(util.TextInternalError("Could not transfer.", err))
+			return err
 		}
+		proxyId := tp.GetId()
 
 		backendId := uuid.Nil
 		if withBackend {
@@ -85,28 +99,84 @@ func (cm *CommandManager) executeTransfer(withBackend bool) brigodier.Command {
 		}
 
 		tr := cm.tm.BuildTask(tasks.NewTransferTask(t.GetId(), mp.GetId(), proxyId, backendId))
+		return cm.sendTransferResponse(c, tr)
+	})
+}
 
-		if !tr.IsSuccessful() {
-			if tr.GetInfo() == tasks.ErrStringProxyNotFound {
-				c.SendMessage(util.TextWarn("Proxy not found."))
-				return nil
-			}
-
-			if tr.GetInfo() == tasks.ErrStringBackendNotFound {
-				c.SendMessage(util.TextWarn("Backend not found."))
-				return nil
-			}
+// The balancer chooses a backend in the group over every proxy. A backend on the proxy of the target is chosen first.
+func (cm *CommandManager) executeGroupTransfer() brigodier.Command {
+	return command.Command(func(c *command.Context) error {
+		group := strings.ToLower(c.String("group"))
 
-			if tr.GetInfo() == util.ErrStringBackendNotResponding {
-				c.SendMessage(util.TextWarn("Backend was found but is not responding."))
+		t, err := cm.getMultiPlayerFromTarget(c.String("target"))
+		if err != nil {
+			if err == ErrTargetNotFound {
+				c.SendMessage(TextTargetNotFound)
 				return nil
 			}
 
-			err := errors.New(tr.GetInfo())
 			c.SendMessage(util.TextInternalError("Could not transfer.", err))
 			return err
 		}
 
-		return nil
+		if !t.IsOnline() {
+			c.SendMessage(TextTargetIsOffline)
+			return nil
+		}
+
+		mp := t.GetProxy()
+		if mp == nil {
+			c.SendMessage(util.TextInternalError("Could not transfer.", multi.ErrProxyNilWhileOnline))
+			return multi.ErrProxyNilWhileOnline
+		}
+
+		if len(cm.mm.GetBackendsInGroup(group)) < 1 {
+			c.SendMessage(util.TextWarn("Group not found."))
+			return nil
+		}
+
+		mb := tasks.ChooseGroupBackend(cm.tm, group, t, cm.mm.CanBypassMaintenance(t))
+		if mb == nil {
+			c.SendMessage(util.TextWarn("No available backend in that group."))
+			return nil
+		}
+
+		tr := cm.tm.BuildTask(tasks.NewTransferTask(t.GetId(), mp.GetId(), mb.GetMultiProxy().GetId(), mb.GetId()))
+		return cm.sendTransferResponse(c, tr)
 	})
 }
+
+func (cm *CommandManager) sendTransferResponse(c *command.Context, tr *task.TaskResponse) error {
+	if !tr.IsSuccessful() {
+		if tr.GetInfo() == tasks.ErrStringProxyNotFound {
+			c.SendMessage(util.TextWarn("Proxy not found."))
+			return nil
+		}
+
+		if tr.GetInfo() == tasks.ErrStringBackendNotFound {
+			c.SendMessage(util.TextWarn("Backend not found."))
+			return nil
+		}
+
+		if tr.GetInfo() == tasks.ErrStringProxyInMaintenance {
+			c.SendMessage(util.TextWarn("Proxy is in maintenance."))
+			return nil
+		}
+
+		if tr.GetInfo() == tasks.ErrStringBackendInMaintenance {
+			c.SendMessage(util.TextWarn("Backend is in maintenance."))
+			return nil
+		}
+
+		if tr.GetInfo() == util.ErrStringBackendNotResponding {
+			c.SendMessage(util.TextWarn("Backend was found but is not responding."))
+			return nil
+		}
+
+		err := errors.New(tr.GetInfo())
+		c.SendMessage(util.TextInternalError("Could not transfer.", err))
+		return err
+	}
+
+	return nil
+}
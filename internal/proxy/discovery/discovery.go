@@ -0,0 +1,226 @@
+package discovery
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+)
+
+// A backend found by a provider.
+type Backend struct {
+	Name    string
+	Address string
+	Group   string
+	Tags    []string
+}
+
+// Finds the backends of the network. Every call returns all backends the provider knows about right now.
+type Provider interface {
+	Name() string
+	Discover(ctx context.Context) ([]Backend, error)
+}
+
+// Adds the found backends to the proxy and removes them again when they are gone.
+type Registrar interface {
+	AddDiscoveredBackend(provider string, b Backend) error
+	RemoveDiscoveredBackend(name string) error
+}
+
+// Asks the providers for the backends every interval and passes the changes to the registrar.
+// The providers are created again every interval, so changes in the config are used right away.
+type Manager struct {
+	r  Registrar
+	cf *config.Config
+	l  *logger.Logger
+
+	// the added backends by name
+	backends map[string]Backend
+	// the provider of the added backends by name
+	providers map[string]string
+	// the last backends of every provider, used when a provider fails
+	last map[string][]Backend
+	mu   sync.Mutex
+
+	started bool
+	t       *time.Ticker
+	d       chan bool
+}
+
+func Init(r Registrar, cf *config.Config, l *logger.Logger) *Manager {
+	return &Manager{
+		r:         r,
+		cf:        cf,
+		l:         l,
+		backends:  make(map[string]Backend),
+		providers: make(map[string]string),
+		last:      make(map[string][]Backend),
+		d:         make(chan bool),
+	}
+}
+
+// Discovers the backends right away and then every interval.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return
+	}
+	m.started = true
+	m.t = time.NewTicker(m.cf.GetDiscoveryInterval())
+	m.mu.Unlock()
+
+	go func() {
+		m.Discover()
+
+		for {
+			select {
+			case <-m.d:
+				return
+			case <-m.t.C:
+				m.Discover()
+			}
+		}
+	}()
+}
+
+// Stops discovering and removes the discovered backends.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	started := m.started
+	m.started = false
+	m.mu.Unlock()
+
+	// not sent while holding the lock, a running discover needs it to finish
+	if started {
+		m.t.Stop()
+		m.d <- true
+	}
+
+	m.apply(make(map[string]Backend), make(map[string]string))
+}
+
+// Asks every provider for its backends and adds and removes the backends that changed.
+func (m *Manager) Discover() {
+	now := time.Now()
+
+	wanted := make(map[string]Backend)
+	providers := make(map[string]string)
+	for _, p := range m.getProviders() {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cf.GetDiscoveryInterval())
+		l, err := p.Discover(ctx)
+		cancel()
+
+		// keep the backends of the provider, it could be a short failure
+		if err != nil {
+			m.l.Warn("discovery provider error", "provider", p.Name(), "error", err)
+			m.mu.Lock()
+			l = m.last[p.Name()]
+			m.mu.Unlock()
+		} else {
+			m.mu.Lock()
+			m.last[p.Name()] = l
+			m.mu.Unlock()
+		}
+
+		for _, b := range l {
+			if b.Name == "" || b.Address == "" {
+				m.l.Warn("discovery provider returned backend without name or address", "provider", p.Name(), "name", b.Name, "address", b.Address)
+				continue
+			}
+
+			if _, ok := wanted[b.Name]; ok {
+				m.l.Warn("discovery backend name used twice, only the first is used", "provider", p.Name(), "name", b.Name)
+				continue
+			}
+
+			wanted[b.Name] = b
+			providers[b.Name] = p.Name()
+		}
+	}
+
+	m.apply(wanted, providers)
+	m.l.Debug("discovered backends", "backends", len(wanted), "duration", time.Since(now))
+}
+
+func (m *Manager) apply(wanted map[string]Backend, providers map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, b := range m.backends {
+		w, ok := wanted[name]
+		if ok && equal(w, b) && providers[name] == m.providers[name] {
+			continue
+		}
+
+		err := m.r.RemoveDiscoveredBackend(name)
+		if err != nil {
+			m.l.Warn("remove discovered backend error", "name", name, "error", err)
+			continue
+		}
+
+		delete(m.backends, name)
+		delete(m.providers, name)
+		m.l.Info("removed discovered backend", "name", name, "address", b.Address)
+	}
+
+	for name, b := range wanted {
+		if _, ok := m.backends[name]; ok {
+			continue
+		}
+
+		err := m.r.AddDiscoveredBackend(providers[name], b)
+		if err != nil {
+			m.l.Warn("add discovered backend error", "provider", providers[name], "name", name, "address", b.Address, "error", err)
+			continue
+		}
+
+		m.backends[name] = b
+		m.providers[name] = providers[name]
+		m.l.Info("added discovered backend", "provider", providers[name], "name", name, "address", b.Address)
+	}
+}
+
+// Returns the discovered backends by name.
+func (m *Manager) GetBackends() map[string]Backend {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := make(map[string]Backend, len(m.backends))
+	for name, b := range m.backends {
+		c[name] = b
+	}
+
+	return c
+}
+
+func (m *Manager) getProviders() []Provider {
+	var l []Provider
+	for _, dp := range m.cf.GetDiscoveryProviders() {
+		switch dp {
+		case config.DiscoveryProvider_Static:
+			l = append(l, NewStaticProvider(m.cf.GetDiscoveryStaticBackends()))
+		case config.DiscoveryProvider_File:
+			l = append(l, NewFileProvider(m.cf.GetDiscoveryFile()))
+		case config.DiscoveryProvider_DNS:
+			l = append(l, NewDNSProvider(m.cf.GetDiscoverySRVRecords(), m.cf.GetDiscoveryDNSResolver()))
+		case config.DiscoveryProvider_Kubernetes:
+			l = append(l, NewKubernetesProvider(KubernetesOptions{
+				APIServer: m.cf.GetDiscoveryKubernetesAPIServer(),
+				Namespace: m.cf.GetDiscoveryKubernetesNamespace(),
+				TokenFile: m.cf.GetDiscoveryKubernetesTokenFile(),
+				CAFile:    m.cf.GetDiscoveryKubernetesCAFile(),
+				Services:  m.cf.GetDiscoveryKubernetesServices(),
+			}))
+		}
+	}
+
+	return l
+}
+
+func equal(a, b Backend) bool {
+	return a.Name == b.Name && a.Address == b.Address && a.Group == b.Group && slices.Equal(a.Tags, b.Tags)
+}
@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+)
+
+// Keeps the backends like the proxy would register them in gate.
+type testRegistrar struct {
+	backends map[string]Backend
+	fail     map[string]bool
+}
+
+func (r *testRegistrar) AddDiscoveredBackend(provider string, b Backend) error {
+	if r.fail[b.Name] {
+		return errors.New("add failed")
+	}
+
+	r.backends[b.Name] = b
+	return nil
+}
+
+func (r *testRegistrar) RemoveDiscoveredBackend(name string) error {
+	delete(r.backends, name)
+	return nil
+}
+
+func TestManagerApply(t *testing.T) {
+	// the logger writes its files in the working directory
+	t.Chdir(t.TempDir())
+	l, err := logger.Init()
+	if err != nil {
+		t.Fatalf("logger init: %v", err)
+	}
+
+	r := &testRegistrar{backends: make(map[string]Backend), fail: make(map[string]bool)}
+	m := Init(r, nil, l)
+
+	lobby := Backend{Name: "lobby-1", Address: "10.0.0.1:25565", Group: "lobby"}
+	games := Backend{Name: "games-1", Address: "10.0.0.2:25565"}
+	m.apply(map[string]Backend{lobby.Name: lobby, games.Name: games}, map[string]string{lobby.Name: "static", games.Name: "dns"})
+
+	if len(r.backends) != 2 || len(m.GetBackends()) != 2 {
+		t.Fatalf("add: got registered %v, discovered %v", r.backends, m.GetBackends())
+	}
+
+	// the changed backend is removed and added again, the missing one is removed
+	moved := lobby
+	moved.Address = "10.0.0.3:25565"
+	m.apply(map[string]Backend{moved.Name: moved}, map[string]string{moved.Name: "static"})
+
+	if len(r.backends) != 1 || r.backends[moved.Name].Address != moved.Address {
+		t.Fatalf("change: got registered %v", r.backends)
+	}
+
+	// a backend that could not be added is tried again the next time
+	r.fail[games.Name] = true
+	m.apply(map[string]Backend{moved.Name: moved, games.Name: games}, map[string]string{moved.Name: "static", games.Name: "dns"})
+	if _, ok := m.GetBackends()[games.Name]; ok {
+		t.Fatal("failed add: backend kept as discovered")
+	}
+
+	r.fail[games.Name] = false
+	m.apply(map[string]Backend{moved.Name: moved, games.Name: games}, map[string]string{moved.Name: "static", games.Name: "dns"})
+	if _, ok := r.backends[games.Name]; !ok {
+		t.Fatal("retried add: backend not registered")
+	}
+
+	m.apply(make(map[string]Backend), make(map[string]string))
+	if len(r.backends) != 0 || len(m.GetBackends()) != 0 {
+		t.Fatalf("remove all: got registered %v, discovered %v", r.backends, m.GetBackends())
+	}
+}
@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+// Returns the targets of srv records. Every target is named after the name of the record and the first label of the host,
+// the port is added when the name is already used.
+type DNSProvider struct {
+	records  []config.DiscoverySRVRecord
+	resolver *net.Resolver
+}
+
+// The resolver is the host:port of the dns server, empty uses the resolver of the system.
+func NewDNSProvider(records []config.DiscoverySRVRecord, resolver string) *DNSProvider {
+	r := net.DefaultResolver
+	if resolver != "" {
+		r = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, resolver)
+			},
+		}
+	}
+
+	return &DNSProvider{records: records, resolver: r}
+}
+
+func (p *DNSProvider) Name() string {
+	return string(config.DiscoveryProvider_DNS)
+}
+
+func (p *DNSProvider) Discover(ctx context.Context) ([]Backend, error) {
+	var backends []Backend
+	names := make(map[string]bool)
+	for _, r := range p.records {
+		_, srvs, err := p.resolver.LookupSRV(ctx, "", "", r.Record)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			port := strconv.Itoa(int(srv.Port))
+
+			name := r.Name + "-" + strings.Split(host, ".")[0]
+			if names[name] {
+				name += "-" + port
+			}
+			names[name] = true
+
+			backends = append(backends, Backend{
+				Name:    name,
+				Address: net.JoinHostPort(host, port),
+				Group:   r.Group,
+				Tags:    r.Tags,
+			})
+		}
+	}
+
+	return backends, nil
+}
@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+type testSRV struct {
+	target   string
+	port     uint16
+	priority uint16
+}
+
+// Answers the srv queries for one record over udp. Returns the host:port of the server.
+func startTestDNSServer(t *testing.T, record string, srvs []testSRV) string {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := c.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			resp := testDNSResponse(buf[:n], record, srvs)
+			if resp != nil {
+				c.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	return c.LocalAddr().String()
+}
+
+func testDNSResponse(q []byte, record string, srvs []testSRV) []byte {
+	if len(q) < 12 {
+		return nil
+	}
+
+	// the question starts after the header and ends after the type and class
+	end := 12
+	var labels []string
+	for end < len(q) && q[end] != 0 {
+		l := int(q[end])
+		labels = append(labels, string(q[end+1:end+1+l]))
+		end += l + 1
+	}
+	end += 5
+	if end > len(q) {
+		return nil
+	}
+
+	var answers []testSRV
+	if binary.BigEndian.Uint16(q[end-4:]) == 33 && strings.EqualFold(strings.Join(labels, ".")+".", record) {
+		answers = srvs
+	}
+
+	resp := make([]byte, 12, 512)
+	copy(resp, q[:2])
+	// response, authoritative, recursion desired and available
+	binary.BigEndian.PutUint16(resp[2:], 0x8580)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, q[12:end]...)
+
+	for _, srv := range answers {
+		var target []byte
+		for _, l := range strings.Split(strings.TrimSuffix(srv.target, "."), ".") {
+			target = append(target, byte(len(l)))
+			target = append(target, l...)
+		}
+		target = append(target, 0)
+
+		// the name points to the question
+		resp = append(resp, 0xc0, 12)
+		resp = binary.BigEndian.AppendUint16(resp, 33)
+		resp = binary.BigEndian.AppendUint16(resp, 1)
+		resp = binary.BigEndian.AppendUint32(resp, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(6+len(target)))
+		resp = binary.BigEndian.AppendUint16(resp, srv.priority)
+		resp = binary.BigEndian.AppendUint16(resp, 0)
+		resp = binary.BigEndian.AppendUint16(resp, srv.port)
+		resp = append(resp, target...)
+	}
+
+	return resp
+}
+
+func TestDNSProvider(t *testing.T) {
+	record := "_minecraft._tcp.lobby.example.com."
+	addr := startTestDNSServer(t, record, []testSRV{
+		{target: "lobby-1.example.com.", port: 25565, priority: 0},
+		{target: "lobby-1.example.org.", port: 25566, priority: 1},
+	})
+
+	records := []config.DiscoverySRVRecord{
+		{Name: "lobby", Record: record, Group: "lobby", Tags: []string{"eu"}},
+	}
+
+	l, err := NewDNSProvider(records, addr).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	want := []Backend{
+		{Name: "lobby-lobby-1", Address: "lobby-1.example.com:25565", Group: "lobby", Tags: []string{"eu"}},
+		{Name: "lobby-lobby-1-25566", Address: "lobby-1.example.org:25566", Group: "lobby", Tags: []string{"eu"}},
+	}
+
+	// the targets are sorted by priority, so the second one gets the port in its name
+	if !slices.EqualFunc(l, want, equal) {
+		t.Fatalf("discover: got %+v, want %+v", l, want)
+	}
+}
@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+var ErrIncorrectDiscoveryFile = errors.New("incorrect discovery file, only json and yaml are allowed")
+
+// Returns the backends in a json or yaml file. The file has a backends list, in the same format as the static backends.
+// The file is read on every call, so changes are picked up while running.
+type FileProvider struct {
+	path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+func (p *FileProvider) Name() string {
+	return string(config.DiscoveryProvider_File)
+}
+
+func (p *FileProvider) Discover(ctx context.Context) ([]Backend, error) {
+	v := viper.New()
+	switch strings.ToLower(filepath.Ext(p.path)) {
+	case ".json":
+		v.SetConfigType("json")
+	case ".yml", ".yaml":
+		v.SetConfigType("yaml")
+	default:
+		return nil, ErrIncorrectDiscoveryFile
+	}
+
+	v.SetConfigFile(p.path)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []config.DiscoveryBackend
+	err = v.UnmarshalKey("backends", &l)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromConfig(l), nil
+}
@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	files := map[string]string{
+		"backends.yml": `backends:
+  - name: lobby-1
+    address: 10.0.0.1:25565
+    group: lobby
+    tags: [eu]
+  - name: games-1
+    address: 10.0.0.2:25565
+`,
+		"backends.json": `{"backends": [
+  {"name": "lobby-1", "address": "10.0.0.1:25565", "group": "lobby", "tags": ["eu"]},
+  {"name": "games-1", "address": "10.0.0.2:25565"}
+]}`,
+	}
+
+	want := []Backend{
+		{Name: "lobby-1", Address: "10.0.0.1:25565", Group: "lobby", Tags: []string{"eu"}},
+		{Name: "games-1", Address: "10.0.0.2:25565"},
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			err := os.WriteFile(path, []byte(content), 0o644)
+			if err != nil {
+				t.Fatalf("write file: %v", err)
+			}
+
+			l, err := NewFileProvider(path).Discover(context.Background())
+			if err != nil {
+				t.Fatalf("discover: %v", err)
+			}
+
+			if !slices.EqualFunc(l, want, equal) {
+				t.Fatalf("discover: got %+v, want %+v", l, want)
+			}
+		})
+	}
+
+	_, err := NewFileProvider(filepath.Join(t.TempDir(), "backends.txt")).Discover(context.Background())
+	if err != ErrIncorrectDiscoveryFile {
+		t.Fatalf("discover txt file: got %v, want %v", err, ErrIncorrectDiscoveryFile)
+	}
+}
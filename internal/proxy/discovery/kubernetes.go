@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+var (
+	ErrIncorrectKubernetesResponse = errors.New("incorrect kubernetes api response")
+	ErrIncorrectKubernetesCA       = errors.New("no certificates in kubernetes ca file")
+)
+
+type KubernetesOptions struct {
+	// the url of the api server
+	APIServer string
+	Namespace string
+	// the token of the service account, not used when the file doesn't exist
+	TokenFile string
+	// the certificate of the api server, the certificates of the system are used when the file doesn't exist
+	CAFile   string
+	Services []config.DiscoveryKubernetesService
+}
+
+// Returns the ready addresses of the endpoints of kubernetes services. Every address is named after its pod,
+// or after the service and the ip when it has no pod.
+type KubernetesProvider struct {
+	o KubernetesOptions
+}
+
+func NewKubernetesProvider(o KubernetesOptions) *KubernetesProvider {
+	return &KubernetesProvider{o: o}
+}
+
+func (p *KubernetesProvider) Name() string {
+	return string(config.DiscoveryProvider_Kubernetes)
+}
+
+// only the fields that are used
+type kubernetesEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP        string `json:"ip"`
+			TargetRef *struct {
+				Name string `json:"name"`
+			} `json:"targetRef"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+func (p *KubernetesProvider) Discover(ctx context.Context) ([]Backend, error) {
+	c, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// read every time, the token of the service account is rotated
+	var token string
+	b, err := os.ReadFile(p.o.TokenFile)
+	if err == nil {
+		token = strings.TrimSpace(string(b))
+	}
+
+	var backends []Backend
+	for _, s := range p.o.Services {
+		e, err := p.getEndpoints(ctx, c, token, s.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, subset := range e.Subsets {
+			port := 0
+			for _, sp := range subset.Ports {
+				if s.Port == "" || s.Port == sp.Name || s.Port == strconv.Itoa(sp.Port) {
+					port = sp.Port
+					break
+				}
+			}
+
+			if port == 0 {
+				continue
+			}
+
+			for _, a := range subset.Addresses {
+				name := s.Name + "-" + strings.ReplaceAll(a.IP, ".", "-")
+				if a.TargetRef != nil && a.TargetRef.Name != "" {
+					name = a.TargetRef.Name
+				}
+
+				backends = append(backends, Backend{
+					Name:    name,
+					Address: net.JoinHostPort(a.IP, strconv.Itoa(port)),
+					Group:   s.Group,
+					Tags:    s.Tags,
+				})
+			}
+		}
+	}
+
+	return backends, nil
+}
+
+func (p *KubernetesProvider) getEndpoints(ctx context.Context, c *http.Client, token, service string) (*kubernetesEndpoints, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints/%s", p.o.APIServer, url.PathEscape(p.o.Namespace), url.PathEscape(service))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s for service %s", ErrIncorrectKubernetesResponse, resp.Status, service)
+	}
+
+	e := &kubernetesEndpoints{}
+	err = json.NewDecoder(resp.Body).Decode(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (p *KubernetesProvider) getClient() (*http.Client, error) {
+	c := &http.Client{Timeout: 10 * time.Second}
+
+	b, err := os.ReadFile(p.o.CAFile)
+	if err != nil {
+		return c, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, ErrIncorrectKubernetesCA
+	}
+
+	c.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}
+
+	return c, nil
+}
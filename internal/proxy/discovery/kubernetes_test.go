@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+const testEndpoints = `{
+  "kind": "Endpoints",
+  "subsets": [{
+    "addresses": [
+      {"ip": "10.1.0.5", "targetRef": {"kind": "Pod", "name": "lobby-0"}},
+      {"ip": "10.1.0.6"}
+    ],
+    "ports": [
+      {"name": "metrics", "port": 9090},
+      {"name": "minecraft", "port": 25565}
+    ]
+  }]
+}`
+
+func TestKubernetesProvider(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/api/v1/namespaces/mc/endpoints/lobby" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testEndpoints))
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	err := os.WriteFile(tokenFile, []byte("token\n"), 0o644)
+	if err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+
+	o := KubernetesOptions{
+		APIServer: s.URL,
+		Namespace: "mc",
+		TokenFile: tokenFile,
+		CAFile:    filepath.Join(dir, "ca.crt"),
+		Services: []config.DiscoveryKubernetesService{
+			{Name: "lobby", Port: "minecraft", Group: "lobby", Tags: []string{"eu"}},
+		},
+	}
+
+	l, err := NewKubernetesProvider(o).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	want := []Backend{
+		{Name: "lobby-0", Address: "10.1.0.5:25565", Group: "lobby", Tags: []string{"eu"}},
+		{Name: "lobby-10-1-0-6", Address: "10.1.0.6:25565", Group: "lobby", Tags: []string{"eu"}},
+	}
+	if !slices.EqualFunc(l, want, equal) {
+		t.Fatalf("discover: got %+v, want %+v", l, want)
+	}
+
+	o.Services = []config.DiscoveryKubernetesService{{Name: "games"}}
+	_, err = NewKubernetesProvider(o).Discover(context.Background())
+	if err == nil {
+		t.Fatal("discover missing service: no error")
+	}
+}
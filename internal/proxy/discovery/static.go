@@ -0,0 +1,38 @@
+package discovery
+
+import (
+	"context"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+)
+
+// Returns the backends set in the config.
+type StaticProvider struct {
+	backends []config.DiscoveryBackend
+}
+
+func NewStaticProvider(backends []config.DiscoveryBackend) *StaticProvider {
+	return &StaticProvider{backends: backends}
+}
+
+func (p *StaticProvider) Name() string {
+	return string(config.DiscoveryProvider_Static)
+}
+
+func (p *StaticProvider) Discover(ctx context.Context) ([]Backend, error) {
+	return fromConfig(p.backends), nil
+}
+
+func fromConfig(l []config.DiscoveryBackend) []Backend {
+	backends := make([]Backend, 0, len(l))
+	for _, b := range l {
+		backends = append(backends, Backend{
+			Name:    b.Name,
+			Address: b.Address,
+			Group:   b.Group,
+			Tags:    b.Tags,
+		})
+	}
+
+	return backends
+}
@@ -1,10 +1,19 @@
 package listeners
 
-import "go.minekube.com/gate/pkg/edition/java/proxy"
+import (
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
 
 // also works on startup
 func (lm *ListenerManager) onRegister(e *proxy.ServerRegisteredEvent) {
 	si := e.Server().ServerInfo()
+
+	// the backend of another proxy, it already exists
+	if lm.tm.GetRegistry().IsRegistryServer(si.Name()) {
+		return
+	}
+
 	lm.l.Info("registering multibackend ", "name", si.Name())
 
 	_, err := lm.mm.NewMultiBackend(si.Name(), si.Addr().String())
@@ -16,10 +25,13 @@ func (lm *ListenerManager) onRegister(e *proxy.ServerRegisteredEvent) {
 
 func (lm *ListenerManager) onUnRegister(e *proxy.ServerUnregisteredEvent) {
 	si := e.ServerInfo()
+	if lm.tm.GetRegistry().IsRegistryServer(si.Name()) {
+		return
+	}
+
 	lm.l.Info("unregister multibackend", "name", si.Name())
 
-	addr := e.ServerInfo().Addr().String()
-	mb, err := lm.mm.GetMultiBackendUsingAddress(addr)
+	mb, err := lm.getOwnMultiBackendUsingName(si.Name())
 	if err != nil {
 		lm.l.Error("unregister server get multibackend error", "error", err)
 		return
@@ -31,3 +43,23 @@ func (lm *ListenerManager) onUnRegister(e *proxy.ServerUnregisteredEvent) {
 		return
 	}
 }
+
+func (lm *ListenerManager) getOwnMultiBackendUsingName(name string) (*multi.Backend, error) {
+	for _, mb := range lm.mm.GetAllMultiBackendsUnderMultiProxy(lm.mm.GetOwnerMultiProxy()) {
+		if mb.GetName() == name {
+			return mb, nil
+		}
+	}
+
+	return nil, multi.ErrBackendNotFound
+}
+
+// the registry knows which backend the server is, the address is used for servers it doesn't know
+func (lm *ListenerManager) getMultiBackendOfServer(s proxy.RegisteredServer) (*multi.Backend, error) {
+	mb := lm.tm.GetRegistry().GetBackend(s)
+	if mb != nil {
+		return mb, nil
+	}
+
+	return lm.mm.GetMultiBackendUsingAddress(s.ServerInfo().Addr().String())
+}
@@ -15,6 +15,12 @@ func (lm *ListenerManager) onProxyJoin(e *proxy.PostLoginEvent) {
 		return
 	}
 
+	// before the saved value, so the reconciler doesn't see an online player without presence
+	err = lm.mm.SetPlayerPresence(p.ID(), true)
+	if err != nil {
+		lm.l.Warn("player post login set presence error", "playerId", p.ID(), "error", err)
+	}
+
 	err = mp.SetOnline(true)
 	if err != nil {
 		lm.l.Error("player login set online error", "playerId", p.ID(), "error", err)
@@ -46,11 +52,11 @@ func (lm *ListenerManager) onProxyJoin(e *proxy.PostLoginEvent) {
 
 func (lm *ListenerManager) onServerJoin(e *proxy.ServerPostConnectEvent) {
 	p := e.Player()
-	si := p.CurrentServer().Server().ServerInfo()
+	s := p.CurrentServer().Server()
 
 	util.PlayLevelUpSound(p)
 
-	mb, err := lm.mm.GetMultiBackendUsingAddress(si.Addr().String())
+	mb, err := lm.getMultiBackendOfServer(s)
 	if err != nil {
 		lm.l.Error("player server post connect get multibackend error", "playerId", p.ID(), "error", err)
 		p.Disconnect(loginDenyComponent)
@@ -78,8 +84,14 @@ func (lm *ListenerManager) onServerJoin(e *proxy.ServerPostConnectEvent) {
 		return
 	}
 
+	// used by the sticky balancing strategy
+	err = mp.SetLastBackend(mb.GetName())
+	if err != nil {
+		lm.l.Warn("player server post connect set last backend error", "playerId", p.ID(), "backendId", mb.GetId(), "error", err)
+	}
+
 	if e.PreviousServer() != nil {
-		mb, err := lm.mm.GetMultiBackendUsingAddress(e.PreviousServer().ServerInfo().Addr().String())
+		mb, err := lm.getMultiBackendOfServer(e.PreviousServer())
 		if err != nil {
 			lm.l.Error("player server post connect get multibackend error", "playerId", p.ID(), "error", err)
 			p.Disconnect(loginDenyComponent)
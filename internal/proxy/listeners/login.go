@@ -1,6 +1,7 @@
 package listeners
 
 import (
+	"errors"
 	"time"
 
 	"github.com/team-vesperis/vesperis-mp/internal/database"
@@ -11,18 +12,45 @@ import (
 
 var loginDenyComponent = util.TextError("There was an error logging in. Please try again later.")
 
+// Shown when the player is not loaded and the database can't be reached, so the player can't be checked.
+var unavailableDenyComponent = util.TextError("We can't verify your account right now. Please try again in a few minutes.")
+
 func (lm *ListenerManager) onLogin(e *proxy.LoginEvent) {
 	p := e.Player()
 	id := p.ID()
 
 	mp, err := lm.mm.GetMultiPlayer(id)
 	if err != nil {
+		if errors.Is(err, database.ErrStorageUnavailable) {
+			lm.l.Warn("player login denied, database unavailable", "playerId", id)
+			e.Deny(unavailableDenyComponent)
+			return
+		}
+
 		if err != database.ErrDataNotFound {
 			lm.l.Error("player login get multiplayer error", "playerId", id, "error", err)
 			e.Deny(loginDenyComponent)
 			return
 		}
 
+		// player hasn't joined before, created after the maintenance checks so a denied login saves nothing
+		mp = nil
+	}
+
+	if lm.mm.IsNetworkInMaintenance() && !lm.mm.CanBypassMaintenance(mp) {
+		lm.l.Info("player login denied, network in maintenance", "playerId", id)
+		e.Deny(lm.maintenanceComponent())
+		return
+	}
+
+	// a proxy in maintenance sends the player to another proxy when choosing the initial server, if there is one
+	if lm.mm.GetOwnerMultiProxy().IsInMaintenance() && !lm.mm.CanBypassMaintenance(mp) && lm.mm.GetProxyWithLowestPlayerCount(false) == nil {
+		lm.l.Info("player login denied, proxy in maintenance", "playerId", id)
+		e.Deny(lm.maintenanceComponent())
+		return
+	}
+
+	if mp == nil {
 		// player hasn't joined before -> creating default mp
 		mp, err = lm.mm.NewMultiPlayer(p)
 		if err != nil {
@@ -99,6 +127,12 @@ func (lm *ListenerManager) onDisconnect(e *proxy.DisconnectEvent) {
 		return
 	}
 
+	// before the saved value, so the reconciler doesn't see a player with presence that is saved as offline
+	err = lm.mm.SetPlayerPresence(id, false)
+	if err != nil {
+		lm.l.Warn("player disconnect remove presence error", "playerId", id, "error", err)
+	}
+
 	now := time.Now()
 	err = mp.SetLastSeen(&now)
 	if err != nil {
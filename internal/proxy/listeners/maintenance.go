@@ -0,0 +1,48 @@
+package listeners
+
+import (
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
+	"go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+func (lm *ListenerManager) maintenanceComponent() component.Component {
+	return util.TextError(lm.cf.GetMaintenanceMessage())
+}
+
+// Returns if players without bypass role are kept out of this proxy.
+func (lm *ListenerManager) isProxyInMaintenance() bool {
+	return lm.mm.IsNetworkInMaintenance() || lm.mm.GetOwnerMultiProxy().IsInMaintenance()
+}
+
+// Returns if the player can't connect to the server because its backend is in maintenance.
+func (lm *ListenerManager) isServerClosedFor(s proxy.RegisteredServer, mp *multi.Player) bool {
+	mb := lm.tm.GetRegistry().GetBackend(s)
+	return mb != nil && lm.isBackendClosedFor(mb, mp)
+}
+
+// mp can be nil
+func (lm *ListenerManager) isBackendClosedFor(mb *multi.Backend, mp *multi.Player) bool {
+	return mb.IsInMaintenance() && (mp == nil || !lm.mm.CanBypassMaintenance(mp))
+}
+
+// Players can't connect to backends in maintenance, unless they can bypass it.
+func (lm *ListenerManager) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
+	if !e.Allowed() || e.Server() == nil {
+		return
+	}
+
+	p := e.Player()
+	mp, err := lm.mm.GetMultiPlayer(p.ID())
+	if err != nil {
+		lm.l.Warn("server pre connect get multiplayer error", "playerId", p.ID(), "error", err)
+		mp = nil
+	}
+
+	if lm.isServerClosedFor(e.Server(), mp) {
+		lm.l.Info("player connect denied, backend in maintenance", "playerId", p.ID(), "server", e.Server().ServerInfo().Name())
+		e.Deny()
+		p.SendMessage(lm.maintenanceComponent())
+	}
+}
@@ -4,23 +4,28 @@ import (
 	"time"
 
 	"github.com/robinbraemer/event"
+	"github.com/team-vesperis/vesperis-mp/internal/config"
 	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/logger"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/manager"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
 )
 
 type ListenerManager struct {
 	m         event.Manager
 	l         *logger.Logger
-	db        *database.Database
+	db        database.Storage
 	mm        *manager.MultiManager
 	ownerGate *proxy.Proxy
 	tm        *task.TaskManager
+	dm        *tasks.DrainManager
+	cf        *config.Config
 }
 
-func Init(m event.Manager, l *logger.Logger, db *database.Database, mm *manager.MultiManager, ownerGate *proxy.Proxy, tm *task.TaskManager) (*ListenerManager, error) {
+func Init(m event.Manager, l *logger.Logger, cf *config.Config, db database.Storage, mm *manager.MultiManager, ownerGate *proxy.Proxy, tm *task.TaskManager, dm *tasks.DrainManager) (*ListenerManager, error) {
 	now := time.Now()
 	lm := &ListenerManager{
 		m:         m,
@@ -29,6 +34,8 @@ func Init(m event.Manager, l *logger.Logger, db *database.Database, mm *manager.
 		mm:        mm,
 		ownerGate: ownerGate,
 		tm:        tm,
+		dm:        dm,
+		cf:        cf,
 	}
 
 	err := lm.initFavicon()
@@ -41,6 +48,16 @@ func Init(m event.Manager, l *logger.Logger, db *database.Database, mm *manager.
 		return nil, err
 	}
 
+	// the players connected to gate are the most reliable
+	mm.SetPresenceSource(func() []uuid.UUID {
+		var l []uuid.UUID
+		for _, p := range ownerGate.Players() {
+			l = append(l, p.ID())
+		}
+
+		return l
+	})
+
 	lm.registerListeners()
 
 	lm.l.Info("initialized listener manager", "duration", time.Since(now))
@@ -58,6 +75,8 @@ func (lm *ListenerManager) registerListeners() {
 	event.Subscribe(lm.m, 0, lm.onUnRegister)
 
 	event.Subscribe(lm.m, 0, lm.onChooseInitialServer)
+	event.Subscribe(lm.m, 0, lm.onServerPreConnect)
+	event.Subscribe(lm.m, 0, lm.onKickedFromServer)
 	event.Subscribe(lm.m, 0, lm.onPreShutdown)
 
 	event.Subscribe(lm.m, 5, lm.sendResourcePack)
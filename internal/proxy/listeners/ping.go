@@ -1,6 +1,7 @@
 package listeners
 
 import (
+	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/common/minecraft/component"
 	"go.minekube.com/gate/pkg/edition/java/ping"
@@ -14,6 +15,11 @@ var fav favicon.Favicon
 func (lm *ListenerManager) initFavicon() error {
 	var f string
 	err := lm.db.GetData("favicon", &f)
+	if err == database.ErrDataNotFound {
+		lm.l.Warn("no favicon found in the database, proxy will not show one")
+		return nil
+	}
+
 	if err != nil {
 		lm.l.Error("get favicon string from database error", "error", err)
 		return err
@@ -60,5 +66,13 @@ func (lm *ListenerManager) onPing(e *proxy.PingEvent) {
 		Favicon: fav,
 	}
 
+	if lm.isProxyInMaintenance() {
+		ping.Description = &component.Text{
+			Content: lm.cf.GetMaintenanceMotd(),
+			S:       util.StyleColorRed,
+		}
+		ping.Version.Name = "Maintenance"
+	}
+
 	e.SetPing(ping)
 }
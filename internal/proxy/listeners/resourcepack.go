@@ -3,6 +3,7 @@ package listeners
 import (
 	"encoding/hex"
 
+	"github.com/team-vesperis/vesperis-mp/internal/database"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
 	"go.minekube.com/gate/pkg/util/uuid"
@@ -13,6 +14,11 @@ var rp proxy.ResourcePackInfo
 func (lm *ListenerManager) initResourcePack() error {
 	var val string
 	err := lm.db.GetData("resourcepack_hash", &val)
+	if err == database.ErrDataNotFound {
+		lm.l.Warn("no resourcepack found in the database, players will not receive one")
+		return nil
+	}
+
 	if err != nil {
 		lm.l.Error("get resourcepack hash from database error", "error", err)
 		return err
@@ -45,5 +51,9 @@ func (lm *ListenerManager) initResourcePack() error {
 }
 
 func (lm *ListenerManager) sendResourcePack(e *proxy.ServerPostConnectEvent) {
+	if rp.URL == "" {
+		return
+	}
+
 	go e.Player().SendResourcePack(rp)
 }
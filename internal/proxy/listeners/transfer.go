@@ -4,6 +4,8 @@ import (
 	"context"
 	"time"
 
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/balancer"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/task/tasks"
 	"github.com/team-vesperis/vesperis-mp/internal/multi/util"
 	"go.minekube.com/gate/pkg/edition/java/cookie"
@@ -11,29 +13,35 @@ import (
 	"go.minekube.com/gate/pkg/util/uuid"
 )
 
-// send players to other proxies
+// send players to other proxies. players that are left when the drain deadline passed are disconnected
 func (lm *ListenerManager) onPreShutdown(e *proxy.PreShutdownEvent) {
-	for _, p := range lm.ownerGate.Players() {
-		proxy := lm.mm.GetProxyWithLowestPlayerCount(false)
-		if proxy == nil {
-			p.Disconnect(util.TextError("The proxy you were on has closed and there was no other proxy to connect to."))
-			continue
-		}
-
-		tr := lm.tm.BuildTask(tasks.NewTransferTask(p.ID(), lm.mm.GetOwnerMultiProxy().GetId(), proxy.GetId(), uuid.Nil))
-		if !tr.IsSuccessful() {
-			lm.l.Error("transfer not successful", "error", tr.GetInfo())
-			p.Disconnect(util.TextError("The proxy you were on has closed and there was no other proxy to connect to."))
-			continue
-		}
+	err := lm.dm.Drain(lm.cf.GetDrainShutdownTimeout())
+	if err != nil {
+		lm.l.Warn("drain before shutdown error", "error", err)
+	}
 
-		lm.l.Info("transferring player", "playerId", p.ID(), "proxyId", proxy.GetId())
+	for _, p := range lm.ownerGate.Players() {
+		p.Disconnect(util.TextError("The proxy you were on has closed and there was no other proxy to connect to."))
 	}
 }
 
 // check if player has cookie specifying which server he needs.
 func (lm *ListenerManager) onChooseInitialServer(e *proxy.PlayerChooseInitialServerEvent) {
 	p := e.Player()
+
+	mp, err := lm.mm.GetMultiPlayer(p.ID())
+	if err != nil {
+		lm.l.Warn("choose initial server get multiplayer error", "playerId", p.ID(), "error", err)
+		mp = nil
+	}
+
+	// a draining proxy or a proxy in maintenance doesn't take new players
+	if lm.dm.IsDraining() || (lm.mm.GetOwnerMultiProxy().IsInMaintenance() && (mp == nil || !lm.mm.CanBypassMaintenance(mp))) {
+		lm.l.Info("proxy in maintenance, sending player to other proxy", "playerId", p.ID())
+		lm.sendNoAvailableServers(p)
+		return
+	}
+
 	if len(lm.ownerGate.Servers()) < 1 {
 		lm.l.Warn("no servers under gate proxy", "playerId", p.ID())
 		lm.sendNoAvailableServers(p)
@@ -53,57 +61,113 @@ func (lm *ListenerManager) onChooseInitialServer(e *proxy.PlayerChooseInitialSer
 				lm.l.Error("transfer manager clearing cookie error", "error", err)
 			}
 
-			server_name := string(c.Payload)
-			s := lm.ownerGate.Server(server_name)
-			if s != nil {
+			// the payload is the id of the backend
+			s := lm.getServerFromCookie(c.Payload)
+			if s != nil && !lm.isServerClosedFor(s, mp) {
 				e.SetInitialServer(s)
 			} else {
-				lm.chooseRandomServer(p, e)
+				lm.chooseServer(p, mp, e)
 			}
 		} else {
-			lm.chooseRandomServer(p, e)
+			lm.chooseServer(p, mp, e)
 		}
 	}
 }
 
-func (lm *ListenerManager) chooseRandomServer(p proxy.Player, e *proxy.PlayerChooseInitialServerEvent) {
-	// for _, mb := range tm.mm.GetAllMultiBackendsUnderMultiProxy(tm.mm.GetOwnerMultiProxy()) {
-	// 	//if util.IsBackendResponding(mb.GetAddress()) {
-	// 	server := tm.p.Server(mb.GetId().String())
-	// 	if server != nil {
-	// 		l = append(l, server)
-	// 	}
-	// 	//}
-	// }
-
-	var l []proxy.RegisteredServer
-	for _, s := range lm.ownerGate.Servers() {
-		if util.IsBackendResponding(s.ServerInfo().Addr().String()) {
-			l = append(l, s)
-		}
+// can return nil
+func (lm *ListenerManager) getServerFromCookie(payload []byte) proxy.RegisteredServer {
+	id, err := uuid.Parse(string(payload))
+	if err != nil {
+		return nil
 	}
 
-	if len(l) < 1 {
-		lm.l.Warn("no servers under gate proxy", "playerId", p.ID())
+	mb, err := lm.mm.GetMultiBackend(id)
+	if err != nil {
+		return nil
+	}
+
+	return lm.tm.GetRegistry().GetServer(mb)
+}
+
+// the balancer chooses one of the backends in the initial group. mp can be nil
+func (lm *ListenerManager) chooseServer(p proxy.Player, mp *multi.Player, e *proxy.PlayerChooseInitialServerEvent) {
+	group := lm.cf.GetInitialGroup()
+
+	mb := lm.chooseBackend(group, mp, nil)
+	if mb == nil {
+		lm.l.Warn("no servers under gate proxy", "playerId", p.ID(), "group", group)
 		lm.sendNoAvailableServers(p)
 		return
 	}
 
-	randomIndex := time.Now().UnixNano() % int64(len(l))
-	e.SetInitialServer(l[randomIndex])
+	e.SetInitialServer(lm.tm.GetRegistry().GetServer(mb))
+}
+
+// Returns the backend the balancer chooses out of the backends this proxy can send players to. An empty group means any group.
+// Backends in maintenance or offline are left out, unless the player can bypass the maintenance, and so is the excluded backend.
+// Backends of this proxy are chosen first when prefer own backends is enabled. mp and exclude can be nil, can return nil
+func (lm *ListenerManager) chooseBackend(group string, mp *multi.Player, exclude *multi.Backend) *multi.Backend {
+	r := lm.tm.GetRegistry()
+
+	var own, other []*multi.Backend
+	for _, mb := range r.GetReachableBackends() {
+		if group != "" && !mb.IsInGroup(group) || mb == exclude {
+			continue
+		}
+
+		if lm.isBackendClosedFor(mb, mp) || r.GetServer(mb) == nil {
+			continue
+		}
+
+		// uses the last health check, backends that were never checked are tried as well
+		if !mb.IsAvailable() {
+			continue
+		}
+
+		if mb.GetMultiProxy() == lm.mm.GetOwnerMultiProxy() || !lm.cf.IsPreferOwnBackendsEnabled() {
+			own = append(own, mb)
+		} else {
+			other = append(other, mb)
+		}
+	}
+
+	if group == "" {
+		group = balancer.DefaultGroup
+	}
+
+	mb := lm.mm.GetBalancer().Choose(group, mp, own)
+	if mb != nil {
+		return mb
+	}
+
+	return lm.mm.GetBalancer().Choose(group, mp, other)
 }
 
 func (lm *ListenerManager) sendNoAvailableServers(p proxy.Player) {
 	go func() {
 		time.Sleep(200 * time.Millisecond)
 
-		proxy := lm.mm.GetProxyWithLowestPlayerCount(false)
+		// a proxy with a backend in the initial group is chosen first, the player is sent to that backend right away
+		var proxy *multi.Proxy
+		backendId := uuid.Nil
+		if group := lm.cf.GetInitialGroup(); group != "" {
+			mb := tasks.ChooseGroupBackend(lm.tm, group, nil, false)
+			if mb != nil && mb.GetMultiProxy() != lm.mm.GetOwnerMultiProxy() {
+				proxy = mb.GetMultiProxy()
+				backendId = mb.GetId()
+			}
+		}
+
+		if proxy == nil {
+			proxy = lm.mm.GetProxyWithLowestPlayerCount(false)
+		}
+
 		if proxy == nil {
 			p.Disconnect(util.TextError("No available server. Please try again."))
 			return
 		}
 
-		tr := lm.tm.BuildTask(tasks.NewTransferTask(p.ID(), lm.mm.GetOwnerMultiProxy().GetId(), proxy.GetId(), uuid.Nil))
+		tr := lm.tm.BuildTask(tasks.NewTransferTask(p.ID(), lm.mm.GetOwnerMultiProxy().GetId(), proxy.GetId(), backendId))
 		if !tr.IsSuccessful() {
 			lm.l.Error("transfer not successful", "playerId", p.ID(), "error", tr.GetInfo())
 			p.Disconnect(util.TextError("No available server. Please try again."))
@@ -113,3 +177,25 @@ func (lm *ListenerManager) sendNoAvailableServers(p proxy.Player) {
 		lm.l.Info("transferring player", "playerId", p.ID(), "proxyId", proxy.GetId())
 	}()
 }
+
+// players that are kicked from a backend are sent to a backend in the fallback group, if there is one
+func (lm *ListenerManager) onKickedFromServer(e *proxy.KickedFromServerEvent) {
+	p := e.Player()
+	mp, err := lm.mm.GetMultiPlayer(p.ID())
+	if err != nil {
+		lm.l.Warn("kicked from server get multiplayer error", "playerId", p.ID(), "error", err)
+		mp = nil
+	}
+
+	group := lm.cf.GetFallbackGroup()
+	mb := lm.chooseBackend(group, mp, lm.tm.GetRegistry().GetBackend(e.Server()))
+	if mb == nil {
+		return
+	}
+
+	lm.l.Info("sending kicked player to fallback backend", "playerId", p.ID(), "backendId", mb.GetId(), "group", group)
+	e.SetResult(&proxy.RedirectPlayerKickResult{
+		Server:  lm.tm.GetRegistry().GetServer(mb),
+		Message: e.OriginalReason(),
+	})
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"net"
+
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"github.com/team-vesperis/vesperis-mp/internal/proxy/discovery"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Registers a backend found by a discovery provider in gate. The register listener creates the backend,
+// with the group and tags of the provider.
+func (r *Registry) AddDiscoveredBackend(provider string, b discovery.Backend) error {
+	addr, err := net.ResolveTCPAddr("tcp", b.Address)
+	if err != nil {
+		return err
+	}
+
+	// the same server is already in gate
+	if r.getOwnServerWithAddress(addr.String()) != nil {
+		r.l.Debug("registry skipped discovered backend, address already registered", "name", b.Name, "address", b.Address)
+		return nil
+	}
+
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+
+	// a backend of another proxy can have the name, the own backend goes first
+	for id, n := range r.getServers() {
+		if n == b.Name {
+			r.unregister(id)
+		}
+	}
+
+	if r.ownerGate.Server(b.Name) != nil {
+		return ErrBackendNameTaken
+	}
+
+	group := b.Group
+	if group != "" {
+		group, err = config.GetBackendGroupName(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mm.SetDiscoveredBackend(provider, data.ManagedBackendData{
+		Name:    b.Name,
+		Address: b.Address,
+		Group:   group,
+		Tags:    b.Tags,
+	})
+
+	_, err = r.ownerGate.Register(proxy.NewServerInfo(b.Name, addr))
+	if err != nil {
+		r.mm.RemoveDiscoveredBackend(b.Name)
+		return err
+	}
+
+	return nil
+}
+
+// Unregisters the backend added with AddDiscoveredBackend.
+func (r *Registry) RemoveDiscoveredBackend(name string) error {
+	provider, _ := r.mm.GetDiscoveredBackend(name)
+	if provider == "" {
+		return nil
+	}
+
+	s := r.ownerGate.Server(name)
+	if s != nil {
+		r.ownerGate.Unregister(s.ServerInfo())
+	}
+
+	r.mm.RemoveDiscoveredBackend(name)
+	return nil
+}
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"errors"
+	"net"
+
+	"github.com/team-vesperis/vesperis-mp/internal/multi/util/data"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+var ErrBackendNameTaken = errors.New("backend name taken")
+
+// Adds the backend to every proxy. It is saved, so the proxies add it again after a restart.
+// The other proxies add it when they receive the new backend of this proxy.
+func (r *Registry) AddBackend(md data.ManagedBackendData) error {
+	if r.ownerGate.Server(md.Name) != nil && !r.IsRegistryServer(md.Name) {
+		return ErrBackendNameTaken
+	}
+
+	_, err := net.ResolveTCPAddr("tcp", md.Address)
+	if err != nil {
+		return err
+	}
+
+	err = r.mm.AddManagedBackend(md)
+	if err != nil {
+		return err
+	}
+
+	r.Sync()
+	return nil
+}
+
+// Removes the backend added with AddBackend from every proxy.
+func (r *Registry) RemoveBackend(name string) error {
+	err := r.mm.RemoveManagedBackend(name)
+	if err != nil {
+		return err
+	}
+
+	r.Sync()
+	return nil
+}
+
+// Registers the managed backends that are missing in gate and unregisters the managed backends that have been removed.
+func (r *Registry) syncManaged() {
+	m, err := r.mm.GetManagedBackends()
+	if err != nil {
+		r.l.Warn("registry get managed backends error", "error", err)
+		return
+	}
+
+	for _, mb := range r.mm.GetAllMultiBackendsUnderMultiProxy(r.mm.GetOwnerMultiProxy()) {
+		if _, ok := m[mb.GetName()]; ok || !mb.IsManaged() {
+			continue
+		}
+
+		s := r.ownerGate.Server(mb.GetName())
+		if s != nil {
+			r.ownerGate.Unregister(s.ServerInfo())
+			r.l.Info("registry unregistered removed managed backend", "backendId", mb.GetId(), "name", mb.GetName())
+		}
+	}
+
+	for name, md := range m {
+		// a backend of another proxy can have the name, the own backend goes first
+		for id, n := range r.getServers() {
+			if n == name {
+				r.unregister(id)
+			}
+		}
+
+		if r.ownerGate.Server(name) != nil {
+			continue
+		}
+
+		addr, err := net.ResolveTCPAddr("tcp", md.Address)
+		if err != nil {
+			r.l.Warn("registry resolve managed backend address error", "name", name, "address", md.Address, "error", err)
+			continue
+		}
+
+		_, err = r.ownerGate.Register(proxy.NewServerInfo(name, addr))
+		if err != nil {
+			r.l.Warn("registry register managed backend error", "name", name, "error", err)
+			continue
+		}
+
+		r.l.Info("registry registered managed backend", "name", name, "address", md.Address)
+	}
+}
@@ -0,0 +1,307 @@
+package registry
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robinbraemer/event"
+	"github.com/team-vesperis/vesperis-mp/internal/config"
+	"github.com/team-vesperis/vesperis-mp/internal/logger"
+	"github.com/team-vesperis/vesperis-mp/internal/multi"
+	"github.com/team-vesperis/vesperis-mp/internal/multi/manager"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+	"go.minekube.com/gate/pkg/util/uuid"
+)
+
+// The backends of the network are saved in the database and known by every proxy. The registry registers the backends of
+// the other proxies in gate, so a player can be sent to any backend without a proxy transfer. The proxy a backend belongs
+// to is only a hint of where players are sent first.
+type Registry struct {
+	ownerGate *proxy.Proxy
+	mm        *manager.MultiManager
+	cf        *config.Config
+	l         *logger.Logger
+
+	// the gate server names of the backends registered by the registry, by backend id
+	servers map[uuid.UUID]string
+	// only one sync runs at a time
+	syncing sync.Mutex
+	mu      sync.RWMutex
+
+	// the servers of the gate config are registered when gate starts, their names go first
+	ready atomic.Bool
+
+	t *time.Ticker
+	d chan bool
+}
+
+func Init(ownerGate *proxy.Proxy, mm *manager.MultiManager, cf *config.Config, l *logger.Logger) *Registry {
+	now := time.Now()
+	r := &Registry{
+		ownerGate: ownerGate,
+		mm:        mm,
+		cf:        cf,
+		l:         l,
+		servers:   make(map[uuid.UUID]string),
+		t:         time.NewTicker(cf.GetRegistrySyncInterval()),
+		d:         make(chan bool),
+	}
+
+	mm.SetBackendsChangedListener(r.Sync)
+	event.Subscribe(ownerGate.Event(), 0, r.onReady)
+
+	r.l.Info("initialized registry", "duration", time.Since(now))
+	return r
+}
+
+func (r *Registry) onReady(e *proxy.ReadyEvent) {
+	r.ready.Store(true)
+	r.Sync()
+
+	go r.start()
+}
+
+func (r *Registry) start() {
+	for {
+		select {
+		case <-r.d:
+			return
+		case <-r.t.C:
+			r.Sync()
+		}
+	}
+}
+
+// Stops syncing and unregisters the backends of the other proxies.
+func (r *Registry) Close() {
+	r.mm.SetBackendsChangedListener(nil)
+	r.t.Stop()
+	if r.ready.Load() {
+		r.d <- true
+	}
+
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+
+	for id := range r.getServers() {
+		r.unregister(id)
+	}
+}
+
+func (r *Registry) IsEnabled() bool {
+	return r.cf.IsSharedRegistryEnabled()
+}
+
+// Returns if the gate server has been registered by the registry.
+func (r *Registry) IsRegistryServer(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, n := range r.servers {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the gate server players are sent to for the backend. Backends of other proxies are only found when they
+// are registered or when this proxy has a backend with the same address. Can return nil.
+func (r *Registry) GetServer(mb *multi.Backend) proxy.RegisteredServer {
+	if mb.GetMultiProxy() == r.mm.GetOwnerMultiProxy() {
+		return r.ownerGate.Server(mb.GetName())
+	}
+
+	if !r.IsEnabled() {
+		return nil
+	}
+
+	r.mu.RLock()
+	name, ok := r.servers[mb.GetId()]
+	r.mu.RUnlock()
+
+	if ok {
+		return r.ownerGate.Server(name)
+	}
+
+	return r.getOwnServerWithAddress(mb.GetAddress())
+}
+
+// Returns the backend of the gate server. Can return nil.
+func (r *Registry) GetBackend(s proxy.RegisteredServer) *multi.Backend {
+	name := s.ServerInfo().Name()
+
+	r.mu.RLock()
+	for id, n := range r.servers {
+		if n != name {
+			continue
+		}
+		r.mu.RUnlock()
+
+		mb, err := r.mm.GetMultiBackend(id)
+		if err != nil {
+			return nil
+		}
+
+		return mb
+	}
+	r.mu.RUnlock()
+
+	for _, mb := range r.mm.GetAllMultiBackendsUnderMultiProxy(r.mm.GetOwnerMultiProxy()) {
+		if mb.GetName() == name {
+			return mb
+		}
+	}
+
+	return nil
+}
+
+// Returns the backends players on this proxy can be sent to. Without the registry only the backends of this proxy.
+func (r *Registry) GetReachableBackends() []*multi.Backend {
+	if !r.IsEnabled() {
+		return r.mm.GetAllMultiBackendsUnderMultiProxy(r.mm.GetOwnerMultiProxy())
+	}
+
+	var l []*multi.Backend
+	for _, mb := range r.mm.GetAllMultiBackends() {
+		if r.GetServer(mb) != nil {
+			l = append(l, mb)
+		}
+	}
+
+	return l
+}
+
+// Registers the managed backends and the backends of the other proxies that are missing in gate and unregisters the backends that are gone.
+func (r *Registry) Sync() {
+	if !r.ready.Load() {
+		return
+	}
+
+	r.syncing.Lock()
+	defer r.syncing.Unlock()
+
+	now := time.Now()
+	r.syncManaged()
+
+	wanted := make(map[uuid.UUID]*multi.Backend)
+	if r.IsEnabled() {
+		for _, mb := range r.mm.GetAllMultiBackends() {
+			if mb.GetMultiProxy() == r.mm.GetOwnerMultiProxy() {
+				continue
+			}
+
+			// the same server is already in gate
+			if r.getOwnServerWithAddress(mb.GetAddress()) != nil {
+				continue
+			}
+
+			wanted[mb.GetId()] = mb
+		}
+	}
+
+	servers := r.getServers()
+	for id := range servers {
+		if _, ok := wanted[id]; !ok {
+			r.unregister(id)
+		}
+	}
+
+	added := 0
+	for id, mb := range wanted {
+		if _, ok := servers[id]; ok {
+			continue
+		}
+
+		if r.register(mb) {
+			added++
+		}
+	}
+
+	r.l.Debug("registry synced backends", "backends", len(wanted), "added", added, "duration", time.Since(now))
+}
+
+// The backend is registered with its own name, or with the name of its proxy added when the name is taken.
+func (r *Registry) register(mb *multi.Backend) bool {
+	name := mb.GetName()
+	if r.ownerGate.Server(name) != nil {
+		name = mb.GetName() + "-" + mb.GetMultiProxy().GetName()
+	}
+
+	if r.ownerGate.Server(name) != nil {
+		r.l.Warn("registry could not register backend, name taken", "backendId", mb.GetId(), "name", name)
+		return false
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", mb.GetAddress())
+	if err != nil {
+		r.l.Warn("registry resolve backend address error", "backendId", mb.GetId(), "address", mb.GetAddress(), "error", err)
+		return false
+	}
+
+	// set before registering, so the register listener knows the server is not from this proxy
+	r.mu.Lock()
+	r.servers[mb.GetId()] = name
+	r.mu.Unlock()
+
+	_, err = r.ownerGate.Register(proxy.NewServerInfo(name, addr))
+	if err != nil {
+		r.mu.Lock()
+		delete(r.servers, mb.GetId())
+		r.mu.Unlock()
+
+		r.l.Warn("registry register backend error", "backendId", mb.GetId(), "name", name, "error", err)
+		return false
+	}
+
+	r.l.Info("registry registered backend", "backendId", mb.GetId(), "name", name, "proxyId", mb.GetMultiProxy().GetId())
+	return true
+}
+
+func (r *Registry) unregister(id uuid.UUID) {
+	r.mu.RLock()
+	name := r.servers[id]
+	r.mu.RUnlock()
+
+	s := r.ownerGate.Server(name)
+	if s != nil {
+		r.ownerGate.Unregister(s.ServerInfo())
+	}
+
+	// removed after unregistering, so the unregister listener knows the server is not from this proxy
+	r.mu.Lock()
+	delete(r.servers, id)
+	r.mu.Unlock()
+
+	r.l.Info("registry unregistered backend", "backendId", id, "name", name)
+}
+
+func (r *Registry) getServers() map[uuid.UUID]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := make(map[uuid.UUID]string, len(r.servers))
+	for id, name := range r.servers {
+		m[id] = name
+	}
+
+	return m
+}
+
+// can return nil
+func (r *Registry) getOwnServerWithAddress(addr string) proxy.RegisteredServer {
+	for _, s := range r.ownerGate.Servers() {
+		if r.IsRegistryServer(s.ServerInfo().Name()) {
+			continue
+		}
+
+		if s.ServerInfo().Addr().String() == addr {
+			return s
+		}
+	}
+
+	return nil
+}